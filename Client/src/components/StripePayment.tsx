@@ -14,52 +14,35 @@ const stripeKey = import.meta.env.VITE_STRIPE_PUBLISHABLE_KEY || '';
 const stripePromise = stripeKey ? loadStripe(stripeKey) : null;
 
 interface StripePaymentProps {
+  amount: number; // Shown until the server has priced the cart
+  cartItems: Array<{
+    product_id: number;
+    quantity: number;
+  }>;
+  shippingCity: string;
+  shippingState: string;
+  couponCode?: string;
+  onSuccess: (paymentData: any) => void;
+  onError: (error: string) => void;
+}
+
+interface PaymentFormProps {
   amount: number;
+  currency: string;
+  clientSecret: string;
   onSuccess: (paymentData: any) => void;
   onError: (error: string) => void;
 }
 
+const formatAmount = (amount: number, currency: string) =>
+  `${currency.toUpperCase()} ${amount.toFixed(2)}`;
+
 // Payment form component
-function PaymentForm({ amount, onSuccess, onError }: StripePaymentProps) {
+function PaymentForm({ amount, currency, clientSecret, onSuccess, onError }: PaymentFormProps) {
   const stripe = useStripe();
   const elements = useElements();
   const { user } = useUser();
   const [isProcessing, setIsProcessing] = useState(false);
-  const [clientSecret, setClientSecret] = useState('');
-
-  // Create payment intent when component mounts
-  useEffect(() => {
-    const createPaymentIntent = async () => {
-      try {
-        const response = await fetch('/api/create-payment-intent', {
-          method: 'POST',
-          headers: {
-            'Content-Type': 'application/json',
-          },
-          credentials: 'include',
-          body: JSON.stringify({
-            amount: Math.round(amount * 100), // Convert to cents
-            currency: 'usd',
-            description: `Injera Order - ${user?.name || 'Customer'}`,
-          }),
-        });
-
-        const result = await response.json();
-
-        if (!response.ok) {
-          throw new Error(result.error || 'Failed to create payment intent');
-        }
-
-        setClientSecret(result.data.client_secret);
-        console.log('✅ Stripe payment intent created:', result);
-      } catch (err: any) {
-        console.error('❌ Failed to create payment intent:', err);
-        onError(err.message || 'Failed to initialize payment');
-      }
-    };
-
-    createPaymentIntent();
-  }, [amount, user, onError]);
 
   const handleSubmit = async (event: React.FormEvent) => {
     event.preventDefault();
@@ -98,7 +81,7 @@ function PaymentForm({ amount, onSuccess, onError }: StripePaymentProps) {
           id: paymentIntent.id,
           status: paymentIntent.status,
           amount: amount,
-          currency: 'usd',
+          currency: currency,
           payment_method: 'stripe',
         });
       }
@@ -148,7 +131,7 @@ function PaymentForm({ amount, onSuccess, onError }: StripePaymentProps) {
             Processing...
           </span>
         ) : (
-          `Pay $${amount.toFixed(2)} with Stripe`
+          `Pay ${formatAmount(amount, currency)} with Stripe`
         )}
       </button>
 
@@ -160,7 +143,66 @@ function PaymentForm({ amount, onSuccess, onError }: StripePaymentProps) {
 }
 
 // Main Stripe payment component
-export default function StripePayment({ amount, onSuccess, onError }: StripePaymentProps) {
+export default function StripePayment({
+  amount,
+  cartItems,
+  shippingCity,
+  shippingState,
+  couponCode,
+  onSuccess,
+  onError,
+}: StripePaymentProps) {
+  const { user } = useUser();
+  const [clientSecret, setClientSecret] = useState('');
+  // The server prices the cart and charges its own total, so show that once it's known
+  const [charged, setCharged] = useState<{ amount: number; currency: string } | null>(null);
+
+  // Create a payment intent for the cart, again whenever the cart or destination changes
+  useEffect(() => {
+    if (!stripePromise || cartItems.length === 0) {
+      return;
+    }
+
+    const createPaymentIntent = async () => {
+      setClientSecret('');
+      setCharged(null);
+      try {
+        const response = await fetch('/api/create-payment-intent', {
+          method: 'POST',
+          headers: {
+            'Content-Type': 'application/json',
+          },
+          credentials: 'include',
+          body: JSON.stringify({
+            items: cartItems,
+            coupon_code: couponCode || '',
+            shipping_city: shippingCity,
+            shipping_state: shippingState,
+            description: `Injera Order - ${user?.name || 'Customer'}`,
+          }),
+        });
+
+        const result = await response.json();
+
+        if (!response.ok) {
+          throw new Error(result.error || 'Failed to create payment intent');
+        }
+
+        setClientSecret(result.clientSecret);
+        setCharged({ amount: result.amount, currency: result.currency });
+        console.log('✅ Stripe payment intent created:', result.paymentIntentId);
+      } catch (err: any) {
+        console.error('❌ Failed to create payment intent:', err);
+        onError(err.message || 'Failed to initialize payment');
+      }
+    };
+
+    createPaymentIntent();
+  }, [cartItems, shippingCity, shippingState, couponCode, user?.name, onError]);
+
+  const displayAmount = charged?.amount ?? amount;
+  const displayCurrency = charged?.currency ?? 'etb';
+
   // Don't render if Stripe is not configured
   if (!stripePromise) {
     return (
@@ -195,7 +237,7 @@ export default function StripePayment({ amount, onSuccess, onError }: StripePaym
       <div className="space-y-2 text-sm text-gray-600">
         <div className="flex justify-between">
           <span>Amount:</span>
-          <span className="font-semibold">${amount.toFixed(2)}</span>
+          <span className="font-semibold">{formatAmount(displayAmount, displayCurrency)}</span>
         </div>
         <div className="flex justify-between">
           <span>Payment Method:</span>
@@ -205,7 +247,9 @@ export default function StripePayment({ amount, onSuccess, onError }: StripePaym
 
       <Elements stripe={stripePromise}>
         <PaymentForm
-          amount={amount}
+          amount={displayAmount}
+          currency={displayCurrency}
+          clientSecret={clientSecret}
           onSuccess={onSuccess}
           onError={onError}
         />
@@ -1,4 +1,4 @@
-import { useState, useEffect } from "react";
+import { useState, useEffect, useCallback, useMemo } from "react";
 import { useNavigate } from "react-router-dom";
 import { ArrowLeft, User, CreditCard } from "lucide-react";
 import { useCart } from "../contexts/CartContext";
@@ -50,6 +50,11 @@ export default function Checkout() {
     setCurrentStep('payment');
   };
 
+  const cartItems = useMemo(() => cart.map(item => ({
+    product_id: item.product.id,
+    quantity: item.quantity
+  })), [cart]);
+
   const handlePaymentSuccess = async (paymentData: any) => {
     console.log('Payment successful:', paymentData);
     
@@ -64,10 +69,7 @@ export default function Checkout() {
         notes: formData.notes,
         payment_method: selectedPaymentMethod,
         payment_id: paymentData.id || paymentData.tx_ref || 'unknown',
-        items: cart.map(item => ({
-          product_id: item.product.id,
-          quantity: item.quantity
-        }))
+        items: cartItems
       };
 
       console.log('Creating order:', orderData);
@@ -104,9 +106,10 @@ export default function Checkout() {
     }
   };
 
-  const handlePaymentError = (error: string) => {
+  // Stable so the payment components don't start a new payment on every render
+  const handlePaymentError = useCallback((error: string) => {
     setError(error);
-  };
+  }, []);
 
   if (cart.length === 0) {
     return (
@@ -331,15 +334,15 @@ export default function Checkout() {
                       shipping_phone: formData.shippingPhone,
                       notes: formData.notes
                     }}
-                    cartItems={cart.map(item => ({
-                      product_id: item.product.id,
-                      quantity: item.quantity
-                    }))}
+                    cartItems={cartItems}
                     onError={handlePaymentError}
                   />
                 ) : (
                   <StripePayment
                     amount={getTotalPrice()}
+                    cartItems={cartItems}
+                    shippingCity={formData.shippingCity}
+                    shippingState={formData.shippingState}
                     onSuccess={handlePaymentSuccess}
                     onError={handlePaymentError}
                   />
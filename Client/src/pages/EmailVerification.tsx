@@ -42,7 +42,7 @@ export default function EmailVerification() {
         headers: {
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify({ code: verificationCode }),
+        body: JSON.stringify({ email, code: verificationCode }),
       });
       
       const data = await response.json();
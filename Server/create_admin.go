@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// runCreateAdmin creates an admin account, or promotes an existing user to admin.
+// Admins can't sign up through the API, so this is how the first one is made:
+//
+//	injera-server create-admin -email admin@example.com [-name "Site Admin"] [-password ...]
+//
+// Without -password, ADMIN_PASSWORD is used, and failing that a random password is printed.
+func runCreateAdmin(args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := flags.String("email", os.Getenv("ADMIN_EMAIL"), "email address of the admin (default $ADMIN_EMAIL)")
+	name := flags.String("name", "Administrator", "name for a new account")
+	password := flags.String("password", os.Getenv("ADMIN_PASSWORD"), "password for a new account (default $ADMIN_PASSWORD)")
+	flags.Parse(args)
+
+	*email = strings.ToLower(strings.TrimSpace(*email))
+	if *email == "" || !strings.Contains(*email, "@") {
+		return errors.New("create-admin needs a valid -email")
+	}
+
+	config.ConnectDatabase()
+	runMigrations()
+
+	var user models.User
+	err := config.DB.Where("LOWER(email) = ?", *email).First(&user).Error
+	if err == nil {
+		if user.Role == models.RoleAdmin {
+			fmt.Printf("✅ %s is already an admin\n", user.Email)
+			return nil
+		}
+		if err := config.DB.Model(&user).Updates(map[string]interface{}{
+			"role":           models.RoleAdmin,
+			"email_verified": true,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to promote %s: %w", user.Email, err)
+		}
+		fmt.Printf("✅ %s promoted from %s to admin\n", user.Email, user.Role)
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to look up %s: %w", *email, err)
+	}
+
+	generated := false
+	if *password == "" {
+		token, _, err := services.NewSecureToken()
+		if err != nil {
+			return err
+		}
+		*password = token[:20]
+		generated = true
+	}
+	if len(*password) < 8 {
+		return errors.New("the admin password must be at least 8 characters")
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(*password), 12)
+	if err != nil {
+		return err
+	}
+	user = models.User{
+		Name:          *name,
+		Email:         *email,
+		Password:      string(hashed),
+		Role:          models.RoleAdmin,
+		Locale:        services.DefaultLocale,
+		EmailVerified: true,
+	}
+	// Verified users have no verification token; omitting it stores NULL rather than
+	// an empty string that would clash with the unique index
+	if err := config.DB.Omit("VerificationToken").Create(&user).Error; err != nil {
+		return fmt.Errorf("failed to create admin: %w", err)
+	}
+
+	fmt.Printf("✅ Admin account created for %s\n", user.Email)
+	if generated {
+		fmt.Printf("🔑 Generated password: %s (change it after logging in)\n", *password)
+	}
+	return nil
+}
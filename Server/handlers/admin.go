@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminActionInput is the body of admin actions that must say why they were taken
+type AdminActionInput struct {
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// pagination reads ?page (from 1) and ?limit (at most 100, default 25)
+func pagination(c *fiber.Ctx) (page, limit int) {
+	page = c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit = c.QueryInt("limit", 25)
+	if limit <= 0 || limit > 100 {
+		limit = 25
+	}
+	return page, limit
+}
+
+// countBy counts the rows of model grouped by column, e.g. orders by status
+func countBy(model interface{}, column string) map[string]int64 {
+	var rows []struct {
+		Key   string
+		Count int64
+	}
+	config.DB.Model(model).Select(column + " AS key, COUNT(*) AS count").Group(column).Scan(&rows)
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Key] = row.Count
+	}
+	return counts
+}
+
+// GetAdminStats returns the marketplace KPIs for the admin dashboard
+func GetAdminStats(c *fiber.Ctx) error {
+	now := time.Now()
+	monthAgo := now.AddDate(0, 0, -30)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var users, newUsers, suspended, awaitingApproval int64
+	config.DB.Model(&models.User{}).Count(&users)
+	config.DB.Model(&models.User{}).Where("created_at >= ?", monthAgo).Count(&newUsers)
+	config.DB.Model(&models.User{}).Where("suspended_at IS NOT NULL").Count(&suspended)
+	config.DB.Model(&models.SellerApplication{}).
+		Where("status = ?", models.SellerApplicationDocumentsSubmitted).
+		Count(&awaitingApproval)
+
+	var orders, ordersToday int64
+	config.DB.Model(&models.Order{}).Count(&orders)
+	config.DB.Model(&models.Order{}).Where("created_at >= ?", today).Count(&ordersToday)
+
+	var revenue struct {
+		Total     float64
+		LastMonth float64
+		Refunded  float64
+	}
+	config.DB.Model(&models.Order{}).Select(`
+			COALESCE(SUM(total) FILTER (WHERE payment_status = ?), 0) AS total,
+			COALESCE(SUM(total) FILTER (WHERE payment_status = ? AND created_at >= ?), 0) AS last_month,
+			COALESCE(SUM(refunded_amount), 0) AS refunded`,
+		models.PaymentStatusPaid, models.PaymentStatusPaid, monthAgo).
+		Scan(&revenue)
+
+	var deadEmails int64
+	config.DB.Model(&models.EmailOutbox{}).Where("status = ?", models.EmailStatusDead).Count(&deadEmails)
+
+	return c.JSON(fiber.Map{
+		"users": fiber.Map{
+			"total":            users,
+			"by_role":          countBy(&models.User{}, "role"),
+			"new_last_30_days": newUsers,
+			"suspended":        suspended,
+		},
+		"sellers_awaiting_approval": awaitingApproval,
+		"products": fiber.Map{
+			"by_status": countBy(&models.Product{}, "status"),
+		},
+		"orders": fiber.Map{
+			"total":     orders,
+			"today":     ordersToday,
+			"by_status": countBy(&models.Order{}, "status"),
+		},
+		"revenue": fiber.Map{
+			"gross_merchandise_value": roundMoney(revenue.Total),
+			"last_30_days":            roundMoney(revenue.LastMonth),
+			"refunded":                roundMoney(revenue.Refunded),
+		},
+		"dead_emails":  deadEmails,
+		"generated_at": now,
+	})
+}
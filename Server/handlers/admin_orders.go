@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stripe/stripe-go/v75"
+	"github.com/stripe/stripe-go/v75/refund"
+	"gorm.io/gorm"
+)
+
+// AdminRefundInput refunds all of an order, or Amount of it
+type AdminRefundInput struct {
+	Amount float64 `json:"amount" validate:"omitempty,gt=0"`
+	Reason string  `json:"reason" validate:"required,max=500"`
+}
+
+// AdminOrderStatusInput sets an order's status regardless of the usual transitions
+type AdminOrderStatusInput struct {
+	Status string `json:"status" validate:"required,oneof=pending confirmed shipped delivered cancelled"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// GetAdminOrders lists all orders, newest first. ?q matches the order number or the
+// buyer's email; ?status, ?payment_status and ?seller_id filter.
+func GetAdminOrders(c *fiber.Ctx) error {
+	page, limit := pagination(c)
+
+	query := config.DB.Model(&models.Order{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := "%" + strings.ToLower(q) + "%"
+		query = query.Where("LOWER(order_number) LIKE ? OR user_id IN (SELECT id FROM users WHERE LOWER(email) LIKE ?)", like, like)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if paymentStatus := c.Query("payment_status"); paymentStatus != "" {
+		query = query.Where("payment_status = ?", paymentStatus)
+	}
+	if sellerID := c.QueryInt("seller_id"); sellerID > 0 {
+		query = query.Where("id IN (SELECT order_id FROM order_items WHERE seller_id = ?)", sellerID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var orders []models.Order
+	if err := query.Preload("User").Preload("OrderItems").
+		Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&orders).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch orders"})
+	}
+
+	return c.JSON(fiber.Map{"orders": orders, "total": total, "page": page, "limit": limit})
+}
+
+// GetAdminOrder returns any order together with the admin actions taken on it
+func GetAdminOrder(c *fiber.Ctx) error {
+	var order models.Order
+	if err := config.DB.Preload("User").Preload("OrderItems.Product", withRemovedProducts).Preload("TaxLines").
+		Where("id = ?", c.Params("id")).
+		First(&order).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+
+	var history []models.AuditLog
+	config.DB.Where("target_type = ? AND target_id = ?", "order", order.ID).Order("created_at DESC").Find(&history)
+
+	return c.JSON(fiber.Map{"order": order, "audit_log": history})
+}
+
+// AdminCancelOrder cancels an order that hasn't been delivered, puts its items back in
+// stock and emails the buyer. Paid orders still need to be refunded separately.
+func AdminCancelOrder(c *fiber.Ctx) error {
+	var input AdminActionInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var order models.Order
+	if err := config.DB.Preload("OrderItems").Where("id = ?", c.Params("id")).First(&order).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+	if order.Status == models.OrderStatusDelivered || order.Status == models.OrderStatusCancelled {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("A %s order can't be cancelled", order.Status)})
+	}
+
+	previous := order.Status
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Only cancel if nobody changed the status in the meantime
+		result := tx.Model(&models.Order{}).Where("id = ? AND status = ?", order.ID, previous).
+			Updates(map[string]interface{}{"status": models.OrderStatusCancelled, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		for _, item := range order.OrderItems {
+			if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
+				Update("stock", gorm.Expr("stock + ?", item.Quantity)).Error; err != nil {
+				return err
+			}
+		}
+		if err := queueOrderStatusEmail(tx, order, models.OrderStatusCancelled); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "order.cancel", "order", order.ID, input.Reason, fiber.Map{
+			"from":           previous,
+			"payment_status": order.PaymentStatus,
+		})
+	})
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(409).JSON(fiber.Map{"error": "Order status changed, please reload and try again"})
+	}
+	if err != nil {
+		log.Printf("❌ Failed to cancel order %s: %v", order.OrderNumber, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to cancel order"})
+	}
+
+	log.Printf("🛑 Order %s cancelled by admin %d", order.OrderNumber, c.Locals("user_id").(uint))
+	return c.JSON(fiber.Map{
+		"message":         "Order cancelled",
+		"refund_required": order.PaymentStatus == models.PaymentStatusPaid,
+	})
+}
+
+// AdminRefundOrder refunds all or part of a paid order and emails the buyer. Partial
+// refunds leave the order paid until the refunds add up to its total. Stripe payments are
+// refunded through Stripe; other payments are recorded as refunded and have to be paid
+// back through the payment provider's dashboard.
+func AdminRefundOrder(c *fiber.Ctx) error {
+	var input AdminRefundInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var order models.Order
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&order).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+	if order.PaymentStatus != models.PaymentStatusPaid {
+		return c.Status(409).JSON(fiber.Map{"error": "Only paid orders can be refunded"})
+	}
+
+	previous := order.RefundedAmount
+	remaining := roundMoney(order.Total - previous)
+	amount := remaining
+	if input.Amount > 0 {
+		amount = roundMoney(input.Amount)
+	}
+	if amount > remaining {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Refund can't be more than the %.2f left to refund", remaining)})
+	}
+
+	refunded := roundMoney(previous + amount)
+	status := models.PaymentStatusPaid
+	if refunded >= order.Total {
+		status = models.PaymentStatusRefunded
+	}
+
+	gateway := "manual"
+	refundID := ""
+	useStripe := order.PaymentMethod == "stripe" && strings.HasPrefix(order.PaymentID, "pi_")
+	if useStripe {
+		stripeKey := os.Getenv("STRIPE_SECRET_KEY")
+		if stripeKey == "" {
+			return c.Status(500).JSON(fiber.Map{"error": "Stripe configuration not found"})
+		}
+		stripe.Key = stripeKey
+		gateway = "stripe"
+	}
+
+	// The order is claimed before any money moves: the conditional update only matches
+	// if nobody refunded it since we read it, and holds the row until Stripe answers.
+	var stripeErr error
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND payment_status = ? AND refunded_amount = ?", order.ID, models.PaymentStatusPaid, previous).
+			Updates(map[string]interface{}{"refunded_amount": refunded, "payment_status": status})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if useStripe {
+			params := &stripe.RefundParams{
+				PaymentIntent: stripe.String(order.PaymentID),
+				Amount:        stripe.Int64(int64(math.Round(amount * 100))),
+				Reason:        stripe.String(string(stripe.RefundReasonRequestedByCustomer)),
+			}
+			// Keyed on how much was refunded before, so a retry of this refund can't
+			// be charged twice while the next partial refund still goes through
+			params.SetIdempotencyKey(fmt.Sprintf("order-%d-refund-%d", order.ID, int64(math.Round(previous*100))))
+			issued, err := refund.New(params)
+			if err != nil {
+				stripeErr = err
+				return err
+			}
+			refundID = issued.ID
+		}
+
+		order.RefundedAmount = refunded
+		order.PaymentStatus = status
+		if err := queueRefundIssuedEmail(tx, order, amount); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "order.refund", "order", order.ID, input.Reason, fiber.Map{
+			"amount":          amount,
+			"refunded_amount": refunded,
+			"gateway":         gateway,
+			"refund_id":       refundID,
+		})
+	})
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(409).JSON(fiber.Map{"error": "Order was refunded in the meantime, please reload and try again"})
+	}
+	if stripeErr != nil {
+		log.Printf("❌ Stripe refund for order %s failed: %v", order.OrderNumber, stripeErr)
+		return c.Status(502).JSON(fiber.Map{"error": "Stripe refused the refund", "details": stripeErr.Error()})
+	}
+	if err != nil {
+		// The Stripe webhook still records the refund once it goes through
+		log.Printf("❌ Failed to record refund for order %s (gateway %s, refund %s): %v", order.OrderNumber, gateway, refundID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record refund"})
+	}
+
+	log.Printf("💸 Order %s refunded %.2f by admin %d via %s", order.OrderNumber, amount, c.Locals("user_id").(uint), gateway)
+	response := fiber.Map{
+		"message":         "Order refunded",
+		"amount":          amount,
+		"refunded_amount": refunded,
+		"payment_status":  status,
+		"gateway":         gateway,
+	}
+	if gateway == "manual" {
+		response["note"] = "Pay the buyer back through the " + order.PaymentMethod + " dashboard"
+	} else {
+		response["refund_id"] = refundID
+	}
+	return c.JSON(response)
+}
+
+// AdminOverrideOrderStatus sets an order's status directly, for fixing orders stuck in
+// the wrong state. Unlike cancelling, it doesn't touch stock.
+func AdminOverrideOrderStatus(c *fiber.Ctx) error {
+	var input AdminOrderStatusInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var order models.Order
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&order).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+
+	newStatus := models.OrderStatus(input.Status)
+	if order.Status == newStatus {
+		return c.Status(409).JSON(fiber.Map{"error": "Order already has this status"})
+	}
+
+	previous := order.Status
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&order).Updates(map[string]interface{}{
+			"status":     newStatus,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		if err := queueOrderStatusEmail(tx, order, newStatus); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "order.status_override", "order", order.ID, input.Reason, fiber.Map{
+			"from": previous,
+			"to":   newStatus,
+		})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update order status"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Order status updated",
+		"order": fiber.Map{
+			"id":           order.ID,
+			"order_number": order.OrderNumber,
+			"status":       newStatus,
+			"updated_at":   order.UpdatedAt,
+		},
+	})
+}
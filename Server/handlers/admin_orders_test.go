@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAdminRefundOrder(t *testing.T) {
+	db := setupTestDB(t)
+	buyer := createTestUser(t, db, "buyer@example.com", models.RoleBuyer)
+	token := accessToken(t, db, createTestUser(t, db, "admin@example.com", models.RoleAdmin))
+
+	order := models.Order{
+		OrderNumber: "ORD-REFUND", UserID: buyer.ID, Status: models.OrderStatusDelivered,
+		PaymentStatus: models.PaymentStatusPaid, PaymentMethod: "chapa", PaymentID: "tx-ref",
+		ShippingAddress: "Bole", ShippingCity: "Addis Ababa", ShippingState: "Addis Ababa", ShippingPhone: "0911000000",
+		Subtotal: 100, Total: 100,
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Post("/orders/:id/refund", middleware.RequireAuth, AdminRefundOrder)
+	app.Get("/stats", middleware.RequireAuth, GetAdminStats)
+	path := fmt.Sprintf("/orders/%d/refund", order.ID)
+
+	steps := []struct {
+		name         string
+		amount       float64
+		wantStatus   int
+		wantRefunded float64
+		wantPayment  models.PaymentStatus
+	}{
+		{"partial refund", 30, 200, 30, models.PaymentStatusPaid},
+		{"more than what is left", 80, 400, 30, models.PaymentStatusPaid},
+		{"second partial refund", 20.5, 200, 50.5, models.PaymentStatusPaid},
+		{"rest of the order", 0, 200, 100, models.PaymentStatusRefunded},
+		{"already refunded", 10, 409, 100, models.PaymentStatusRefunded},
+	}
+	for _, tt := range steps {
+		res := doJSON(t, app, "POST", path, token, fiber.Map{"amount": tt.amount, "reason": "damaged injera"})
+		if res.Status != tt.wantStatus {
+			t.Errorf("%s: got %d, want %d (%v)", tt.name, res.Status, tt.wantStatus, res.Body)
+		}
+		var saved models.Order
+		db.First(&saved, order.ID)
+		if saved.RefundedAmount != tt.wantRefunded || saved.PaymentStatus != tt.wantPayment {
+			t.Errorf("%s: order has refunded %.2f and payment %s, want %.2f and %s",
+				tt.name, saved.RefundedAmount, saved.PaymentStatus, tt.wantRefunded, tt.wantPayment)
+		}
+	}
+
+	var emails, audits int64
+	db.Model(&models.EmailOutbox{}).Where(&models.EmailOutbox{To: buyer.Email}).Count(&emails)
+	db.Model(&models.AuditLog{}).Where("action = ?", "order.refund").Count(&audits)
+	if emails != 3 || audits != 3 {
+		t.Errorf("got %d refund emails and %d audit entries, want 3 of each", emails, audits)
+	}
+
+	res := doJSON(t, app, "GET", "/stats", token, nil)
+	if refunded := res.Body["revenue"].(map[string]interface{})["refunded"]; refunded != 100.0 {
+		t.Errorf("stats report %v refunded, want 100", refunded)
+	}
+}
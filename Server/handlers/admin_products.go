@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"strings"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetAdminProducts lists every seller's products, newest first. ?q searches name and SKU;
+// ?status and ?seller_id filter.
+func GetAdminProducts(c *fiber.Ctx) error {
+	page, limit := pagination(c)
+
+	query := config.DB.Model(&models.Product{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := "%" + strings.ToLower(q) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(sku) LIKE ?", like, like)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if sellerID := c.QueryInt("seller_id"); sellerID > 0 {
+		query = query.Where("seller_id = ?", sellerID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var products []models.Product
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&products).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch products"})
+	}
+
+	return c.JSON(fiber.Map{"products": products, "total": total, "page": page, "limit": limit})
+}
+
+// BlockProduct takes a product down from the catalog. The seller can still see and edit
+// it, but can't publish it again.
+func BlockProduct(c *fiber.Ctx) error {
+	var input AdminActionInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var product models.Product
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+	}
+	if product.Status == models.ProductStatusBlocked {
+		return c.Status(409).JSON(fiber.Map{"error": "Product is already blocked"})
+	}
+
+	previous := product.Status
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&product).Updates(map[string]interface{}{
+			"status":          models.ProductStatusBlocked,
+			"moderation_note": input.Reason,
+		}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "product.block", "product", product.ID, input.Reason, fiber.Map{
+			"seller_id": product.SellerID,
+			"from":      previous,
+		})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to block product"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Product blocked", "product": product})
+}
+
+// UnblockProduct lifts a block. The product goes back to draft for the seller to publish.
+func UnblockProduct(c *fiber.Ctx) error {
+	var input struct {
+		Reason string `json:"reason" validate:"max=500"`
+	}
+	c.BodyParser(&input)
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var product models.Product
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&product).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+	}
+	if product.Status != models.ProductStatusBlocked {
+		return c.Status(409).JSON(fiber.Map{"error": "Product is not blocked"})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&product).Updates(map[string]interface{}{
+			"status":          models.ProductStatusDraft,
+			"moderation_note": "",
+		}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "product.unblock", "product", product.ID, input.Reason, fiber.Map{
+			"seller_id": product.SellerID,
+		})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to unblock product"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Product unblocked", "product": product})
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetAdminReviews lists reviews for moderation, most flagged first. ?status filters
+// (flagged by default, "all" for every review) and ?product_id narrows to one product.
+func GetAdminReviews(c *fiber.Ctx) error {
+	page, limit := pagination(c)
+
+	query := config.DB.Model(&models.Review{})
+	switch status := c.Query("status", string(models.ReviewStatusFlagged)); status {
+	case "all":
+	case string(models.ReviewStatusFlagged):
+		// Reviews still under the threshold have open flags too
+		query = query.Where("status = ? OR flag_count > 0", status)
+	default:
+		query = query.Where("status = ?", status)
+	}
+	if productID := c.QueryInt("product_id"); productID > 0 {
+		query = query.Where("product_id = ?", productID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var reviews []models.Review
+	if err := query.Preload("Photos").
+		Order("flag_count DESC, created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&reviews).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch reviews"})
+	}
+
+	results := make([]fiber.Map, 0, len(reviews))
+	for _, review := range reviews {
+		results = append(results, adminReviewResponse(review))
+	}
+	return c.JSON(fiber.Map{"reviews": results, "total": total, "page": page, "limit": limit})
+}
+
+// GetAdminReview shows a review with every flag raised against it
+func GetAdminReview(c *fiber.Ctx) error {
+	var review models.Review
+	if err := config.DB.Preload("Photos").Where("id = ?", c.Params("id")).First(&review).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Review not found"})
+	}
+
+	var flags []models.ReviewFlag
+	config.DB.Where("review_id = ?", review.ID).Order("created_at ASC").Find(&flags)
+
+	response := adminReviewResponse(review)
+	response["flags"] = flags
+	return c.JSON(response)
+}
+
+// HideReview takes a review off the product page and out of its rating
+func HideReview(c *fiber.Ctx) error {
+	var input AdminActionInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var review models.Review
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&review).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Review not found"})
+	}
+	if review.Status == models.ReviewStatusHidden {
+		return c.Status(409).JSON(fiber.Map{"error": "Review is already hidden"})
+	}
+
+	previous := review.Status
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&review).Updates(map[string]interface{}{
+			"status":          models.ReviewStatusHidden,
+			"moderation_note": input.Reason,
+		}).Error; err != nil {
+			return err
+		}
+		if err := models.RefreshProductRating(tx, review.ProductID); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "review.hide", "review", review.ID, input.Reason, fiber.Map{
+			"product_id": review.ProductID,
+			"from":       previous,
+			"flags":      review.FlagCount,
+		})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to hide review"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Review hidden", "review": adminReviewResponse(review)})
+}
+
+// RestoreReview puts a hidden review back on the product page
+func RestoreReview(c *fiber.Ctx) error {
+	var input struct {
+		Reason string `json:"reason" validate:"max=500"`
+	}
+	c.BodyParser(&input)
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var review models.Review
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&review).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Review not found"})
+	}
+	if review.Status != models.ReviewStatusHidden {
+		return c.Status(409).JSON(fiber.Map{"error": "Review is not hidden"})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := dismissReviewFlags(tx, &review); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "review.restore", "review", review.ID, input.Reason, fiber.Map{
+			"product_id": review.ProductID,
+		})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to restore review"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Review restored", "review": adminReviewResponse(review)})
+}
+
+// DismissReviewFlags rejects the open flags on a review and shows it again if the flags
+// had hidden it
+func DismissReviewFlags(c *fiber.Ctx) error {
+	var input struct {
+		Reason string `json:"reason" validate:"max=500"`
+	}
+	c.BodyParser(&input)
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var review models.Review
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&review).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Review not found"})
+	}
+	if review.Status == models.ReviewStatusHidden {
+		return c.Status(409).JSON(fiber.Map{"error": "Review was hidden by a moderator. Restore it instead"})
+	}
+	if review.FlagCount == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Review has no open flags"})
+	}
+
+	flags := review.FlagCount
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := dismissReviewFlags(tx, &review); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "review.dismiss_flags", "review", review.ID, input.Reason, fiber.Map{
+			"product_id": review.ProductID,
+			"flags":      flags,
+		})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to dismiss flags"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Flags dismissed", "review": adminReviewResponse(review)})
+}
+
+// dismissReviewFlags closes the review's open flags and makes it visible again in tx.
+// Users who already flagged it can't flag it again, but others can.
+func dismissReviewFlags(tx *gorm.DB, review *models.Review) error {
+	if err := tx.Model(&models.ReviewFlag{}).
+		Where("review_id = ? AND dismissed_at IS NULL", review.ID).
+		Update("dismissed_at", time.Now()).Error; err != nil {
+		return err
+	}
+	review.Status = models.ReviewStatusVisible
+	review.FlagCount = 0
+	review.ModerationNote = ""
+	if err := tx.Model(review).Updates(map[string]interface{}{
+		"status":          review.Status,
+		"flag_count":      0,
+		"moderation_note": "",
+	}).Error; err != nil {
+		return err
+	}
+	return models.RefreshProductRating(tx, review.ProductID)
+}
+
+// adminReviewResponse is the moderator's view of a review, including who wrote it
+func adminReviewResponse(review models.Review) fiber.Map {
+	return fiber.Map{
+		"id":              review.ID,
+		"product_id":      review.ProductID,
+		"user_id":         review.UserID,
+		"rating":          review.Rating,
+		"body":            review.Body,
+		"photos":          review.Photos,
+		"status":          review.Status,
+		"flag_count":      review.FlagCount,
+		"moderation_note": review.ModerationNote,
+		"seller_reply":    review.SellerReply,
+		"created_at":      review.CreatedAt,
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReviewModeration(t *testing.T) {
+	db := setupTestDB(t)
+	admin := createTestUser(t, db, "admin@example.com", models.RoleAdmin)
+	adminToken := accessToken(t, db, admin)
+
+	app := fiber.New()
+	app.Post("/reviews/:id/flag", middleware.RequireAuth, FlagReview)
+	app.Get("/admin/reviews", middleware.RequireAuth, GetAdminReviews)
+	app.Get("/admin/reviews/:id", middleware.RequireAuth, GetAdminReview)
+	app.Post("/admin/reviews/:id/hide", middleware.RequireAuth, HideReview)
+	app.Post("/admin/reviews/:id/restore", middleware.RequireAuth, RestoreReview)
+	app.Post("/admin/reviews/:id/dismiss-flags", middleware.RequireAuth, DismissReviewFlags)
+
+	newReview := func(t *testing.T) models.Review {
+		t.Helper()
+		buyer := createTestUser(t, db, t.Name()+"@buyer.example.com", models.RoleBuyer)
+		product := models.Product{SellerID: admin.ID, Name: "Injera", Price: 25, Status: models.ProductStatusPublished}
+		db.Create(&product)
+		review := models.Review{ProductID: product.ID, UserID: buyer.ID, OrderItemID: 1, Rating: 1, Status: models.ReviewStatusVisible}
+		db.Create(&review)
+		models.RefreshProductRating(db, product.ID)
+		return review
+	}
+	flag := func(t *testing.T, review models.Review, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			flagger := createTestUser(t, db, t.Name()+string(rune('a'+i))+"@flagger.example.com", models.RoleBuyer)
+			if res := doJSON(t, app, "POST", fmt.Sprintf("/reviews/%d/flag", review.ID), accessToken(t, db, flagger), fiber.Map{"reason": "spam"}); res.Status != 200 {
+				t.Fatalf("flag: %d %v", res.Status, res.Body)
+			}
+		}
+	}
+	reload := func(review models.Review) (models.Review, models.Product) {
+		var product models.Product
+		db.First(&review, review.ID)
+		db.First(&product, review.ProductID)
+		return review, product
+	}
+
+	t.Run("dismiss flags shows the review again", func(t *testing.T) {
+		review := newReview(t)
+		flag(t, review, models.ReviewFlagThreshold)
+		if got, product := reload(review); got.Status != models.ReviewStatusFlagged || product.RatingCount != 0 {
+			t.Fatalf("after flags: status %s, rating count %d", got.Status, product.RatingCount)
+		}
+
+		res := doJSON(t, app, "GET", "/admin/reviews", adminToken, nil)
+		if res.Status != 200 || res.Body["total"].(float64) < 1 {
+			t.Fatalf("list: %d %v", res.Status, res.Body)
+		}
+		res = doJSON(t, app, "GET", fmt.Sprintf("/admin/reviews/%d", review.ID), adminToken, nil)
+		if flags := res.Body["flags"].([]interface{}); len(flags) != models.ReviewFlagThreshold {
+			t.Fatalf("got %d flags", len(flags))
+		}
+
+		if res := doJSON(t, app, "POST", fmt.Sprintf("/admin/reviews/%d/dismiss-flags", review.ID), adminToken, nil); res.Status != 200 {
+			t.Fatalf("dismiss: %d %v", res.Status, res.Body)
+		}
+		got, product := reload(review)
+		if got.Status != models.ReviewStatusVisible || got.FlagCount != 0 || product.RatingCount != 1 {
+			t.Errorf("after dismiss: status %s, flags %d, rating count %d", got.Status, got.FlagCount, product.RatingCount)
+		}
+		var open int64
+		db.Model(&models.ReviewFlag{}).Where("review_id = ? AND dismissed_at IS NULL", review.ID).Count(&open)
+		if open != 0 {
+			t.Errorf("%d flags still open", open)
+		}
+		if res := doJSON(t, app, "POST", fmt.Sprintf("/admin/reviews/%d/dismiss-flags", review.ID), adminToken, nil); res.Status != 409 {
+			t.Errorf("second dismiss: got %d, want 409", res.Status)
+		}
+	})
+
+	t.Run("hide and restore", func(t *testing.T) {
+		review := newReview(t)
+		if res := doJSON(t, app, "POST", fmt.Sprintf("/admin/reviews/%d/hide", review.ID), adminToken, fiber.Map{}); res.Status != 400 {
+			t.Errorf("hide without reason: got %d, want 400", res.Status)
+		}
+		if res := doJSON(t, app, "POST", fmt.Sprintf("/admin/reviews/%d/hide", review.ID), adminToken, fiber.Map{"reason": "abusive"}); res.Status != 200 {
+			t.Fatalf("hide: %d %v", res.Status, res.Body)
+		}
+		got, product := reload(review)
+		if got.Status != models.ReviewStatusHidden || got.ModerationNote != "abusive" || product.RatingCount != 0 {
+			t.Errorf("after hide: status %s, note %q, rating count %d", got.Status, got.ModerationNote, product.RatingCount)
+		}
+		if res := doJSON(t, app, "POST", fmt.Sprintf("/admin/reviews/%d/dismiss-flags", review.ID), adminToken, nil); res.Status != 409 {
+			t.Errorf("dismiss hidden review: got %d, want 409", res.Status)
+		}
+
+		if res := doJSON(t, app, "POST", fmt.Sprintf("/admin/reviews/%d/restore", review.ID), adminToken, nil); res.Status != 200 {
+			t.Fatalf("restore: %d %v", res.Status, res.Body)
+		}
+		if got, product := reload(review); got.Status != models.ReviewStatusVisible || product.RatingCount != 1 {
+			t.Errorf("after restore: status %s, rating count %d", got.Status, product.RatingCount)
+		}
+
+		var actions []string
+		db.Model(&models.AuditLog{}).Where("target_type = ? AND target_id = ?", "review", review.ID).Order("id").Pluck("action", &actions)
+		if len(actions) != 2 || actions[0] != "review.hide" || actions[1] != "review.restore" {
+			t.Errorf("audit log: %v", actions)
+		}
+	})
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// UpdateUserRoleInput changes a user's role, e.g. to make someone support staff
+type UpdateUserRoleInput struct {
+	Role   string `json:"role" validate:"required,oneof=buyer seller admin support"`
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// GetAdminUsers lists users, newest first. ?q searches name, email, phone and shop name;
+// ?role and ?status=active|suspended filter, and ?seller_status=pending|approved
+// narrows sellers by approval.
+func GetAdminUsers(c *fiber.Ctx) error {
+	page, limit := pagination(c)
+
+	query := config.DB.Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := "%" + strings.ToLower(q) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(email) LIKE ? OR phone LIKE ? OR LOWER(shop_name) LIKE ?", like, like, like, like)
+	}
+	if role := c.Query("role"); role != "" {
+		if !models.ValidRole(role) {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid role. Must be one of: " + strings.Join(models.Roles, ", ")})
+		}
+		query = query.Where("role = ?", role)
+	}
+	switch c.Query("status") {
+	case "":
+	case "active":
+		query = query.Where("suspended_at IS NULL")
+	case "suspended":
+		query = query.Where("suspended_at IS NOT NULL")
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid status. Must be one of: active, suspended"})
+	}
+	switch c.Query("seller_status") {
+	case "":
+	case "pending":
+		query = query.Where("role = ? AND seller_approved_at IS NULL", models.RoleSeller)
+	case "approved":
+		query = query.Where("role = ? AND seller_approved_at IS NOT NULL", models.RoleSeller)
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid seller_status. Must be one of: pending, approved"})
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var users []models.User
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&users).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch users"})
+	}
+
+	return c.JSON(fiber.Map{"users": users, "total": total, "page": page, "limit": limit})
+}
+
+// GetAdminUser returns one user with a summary of their activity
+func GetAdminUser(c *fiber.Ctx) error {
+	user, ok := findAdminTargetUser(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	var orders, products, activeSessions int64
+	config.DB.Model(&models.Order{}).Where("user_id = ?", user.ID).Count(&orders)
+	config.DB.Model(&models.Product{}).Where("seller_id = ?", user.ID).Count(&products)
+	config.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Count(&activeSessions)
+
+	return c.JSON(fiber.Map{
+		"user":            user,
+		"orders":          orders,
+		"products":        products,
+		"active_sessions": activeSessions,
+	})
+}
+
+// SuspendUser blocks an account: it is signed out everywhere, its API keys stop
+// working and, for sellers, the shop and its products disappear from the catalog
+func SuspendUser(c *fiber.Ctx) error {
+	var input AdminActionInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	user, ok := findAdminTargetUser(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.ID == c.Locals("user_id").(uint) {
+		return c.Status(400).JSON(fiber.Map{"error": "You can't suspend your own account"})
+	}
+	if user.Suspended() {
+		return c.Status(409).JSON(fiber.Map{"error": "User is already suspended"})
+	}
+
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"suspended_at":      now,
+			"suspension_reason": input.Reason,
+		}).Error; err != nil {
+			return err
+		}
+		sessions, err := services.RevokeAllSessions(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		keys := tx.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", now)
+		if keys.Error != nil {
+			return keys.Error
+		}
+		return recordAudit(tx, c, "user.suspend", "user", user.ID, input.Reason, fiber.Map{
+			"sessions_revoked": sessions,
+			"api_keys_revoked": keys.RowsAffected,
+		})
+	})
+	if err != nil {
+		log.Printf("❌ Failed to suspend user %d: %v", user.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to suspend user"})
+	}
+
+	return c.JSON(fiber.Map{"message": "User suspended", "user": user})
+}
+
+// UnsuspendUser lets a suspended account sign in again. Revoked API keys stay revoked.
+func UnsuspendUser(c *fiber.Ctx) error {
+	var input struct {
+		Reason string `json:"reason" validate:"max=500"`
+	}
+	c.BodyParser(&input)
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	user, ok := findAdminTargetUser(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+	if !user.Suspended() {
+		return c.Status(409).JSON(fiber.Map{"error": "User is not suspended"})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"suspended_at":      nil,
+			"suspension_reason": "",
+		}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "user.unsuspend", "user", user.ID, input.Reason, nil)
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to unsuspend user"})
+	}
+
+	return c.JSON(fiber.Map{"message": "User unsuspended", "user": user})
+}
+
+// UpdateUserRole moves a user to another role. Admins can't change their own role, so
+// there is always at least one admin left.
+func UpdateUserRole(c *fiber.Ctx) error {
+	var input UpdateUserRoleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	user, ok := findAdminTargetUser(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.ID == c.Locals("user_id").(uint) {
+		return c.Status(400).JSON(fiber.Map{"error": "You can't change your own role"})
+	}
+	if user.Role == input.Role {
+		return c.JSON(fiber.Map{"message": "Role unchanged", "user": user})
+	}
+	if input.Role == models.RoleSeller && user.ShopName == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "User needs a shop name before they can be a seller"})
+	}
+
+	previous := user.Role
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("role", input.Role).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "user.role_change", "user", user.ID, input.Reason, fiber.Map{
+			"from": previous,
+			"to":   input.Role,
+		})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update role"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Role updated", "user": user})
+}
+
+// ResetUserTwoFactor removes a user's authenticator app and recovery codes, for users
+// who lost both. Their sessions are revoked so they sign in again with a password.
+func ResetUserTwoFactor(c *fiber.Ctx) error {
+	var input AdminActionInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	user, ok := findAdminTargetUser(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.TwoFactorMethod == "" {
+		return c.Status(409).JSON(fiber.Map{"error": "User doesn't have two-factor authentication enabled"})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := clearTwoFactor(tx, user.ID); err != nil {
+			return err
+		}
+		if _, err := services.RevokeAllSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "user.reset_2fa", "user", user.ID, input.Reason, fiber.Map{"method": user.TwoFactorMethod})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reset two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Two-factor authentication reset"})
+}
+
+// findAdminTargetUser loads the :id user an admin endpoint acts on
+func findAdminTargetUser(c *fiber.Ctx) (models.User, bool) {
+	var user models.User
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return user, false
+	}
+	if err := config.DB.Where("id = ?", id).First(&user).Error; err != nil {
+		return user, false
+	}
+	return user, true
+}
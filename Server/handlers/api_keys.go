@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxAPIKeysPerSeller keeps forgotten keys from piling up
+const maxAPIKeysPerSeller = 10
+
+// CreateAPIKeyInput describes a new key. Without expires_in_days the key lasts until revoked.
+type CreateAPIKeyInput struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=products:read products:write orders:read"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,gte=1,max=365"`
+}
+
+// apiKeyResponse is how a key is listed; the key itself is only returned on creation
+func apiKeyResponse(key models.APIKey) fiber.Map {
+	return fiber.Map{
+		"id":           key.ID,
+		"name":         key.Name,
+		"prefix":       key.Prefix,
+		"scopes":       key.ScopeList(),
+		"created_at":   key.CreatedAt,
+		"last_used_at": key.LastUsedAt,
+		"expires_at":   key.ExpiresAt,
+	}
+}
+
+// GetAPIKeys lists the seller's active API keys
+func GetAPIKeys(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var keys []models.APIKey
+	if err := config.DB.Where("user_id = ? AND revoked_at IS NULL", user.ID).
+		Order("created_at DESC").Find(&keys).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch API keys"})
+	}
+
+	result := make([]fiber.Map, 0, len(keys))
+	for _, key := range keys {
+		if key.Active() {
+			result = append(result, apiKeyResponse(key))
+		}
+	}
+	return c.JSON(fiber.Map{"api_keys": result, "available_scopes": models.APIKeyScopes})
+}
+
+// CreateAPIKey issues a new API key for the seller's integrations. The key is in the
+// response once and can't be retrieved again.
+func CreateAPIKey(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var input CreateAPIKeyInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var count int64
+	config.DB.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", user.ID, time.Now()).
+		Count(&count)
+	if count >= maxAPIKeysPerSeller {
+		return c.Status(409).JSON(fiber.Map{"error": "You already have the maximum number of API keys. Revoke one first."})
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	key, plaintext, err := services.CreateAPIKey(config.DB, user.ID, input.Name, uniqueStrings(input.Scopes), expiresAt)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create API key"})
+	}
+
+	response := apiKeyResponse(*key)
+	response["key"] = plaintext
+	return c.Status(201).JSON(fiber.Map{
+		"message": "Store this key now, it won't be shown again",
+		"api_key": response,
+	})
+}
+
+// RevokeAPIKey stops one of the seller's API keys from working
+func RevokeAPIKey(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	result := config.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Params("id"), user.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke API key"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "API key not found"})
+	}
+	return c.JSON(fiber.Map{"message": "API key revoked"})
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
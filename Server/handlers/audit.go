@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// recordAudit logs an admin action through tx, so the entry is only kept if the change is
+func recordAudit(tx *gorm.DB, c *fiber.Ctx, action, targetType string, targetID uint, reason string, details fiber.Map) error {
+	actor := c.Locals("user").(models.User)
+
+	entry := models.AuditLog{
+		ActorID:    actor.ID,
+		ActorEmail: actor.Email,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reason:     reason,
+		IP:         c.IP(),
+	}
+	if details != nil {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		entry.Details = string(encoded)
+	}
+	return tx.Create(&entry).Error
+}
+
+// GetAuditLog lists admin actions, newest first. Filter with ?actor_id, ?action,
+// ?target_type and ?target_id.
+func GetAuditLog(c *fiber.Ctx) error {
+	page, limit := pagination(c)
+
+	query := config.DB.Model(&models.AuditLog{})
+	if actorID := c.QueryInt("actor_id"); actorID > 0 {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := c.QueryInt("target_id"); targetID > 0 {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var entries []models.AuditLog
+	if err := query.Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&entries).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch audit log"})
+	}
+
+	return c.JSON(fiber.Map{"entries": entries, "total": total, "page": page, "limit": limit})
+}
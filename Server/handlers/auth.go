@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
 	"injera-gebeya-platform/Server/models"
 	"injera-gebeya-platform/Server/services"
+	"log"
 	"os"
 	"time"
 
@@ -18,6 +20,7 @@ type RegisterInput struct {
 	Address  string `json:"address"`
 	Role     string `json:"role"`     // "buyer" or "seller"
 	ShopName string `json:"shopName"` // Only for sellers
+	Locale   string `json:"locale"`   // "en", "am" or "om"; defaults to the Accept-Language header
 }
 
 func Register(c *fiber.Ctx) error {
@@ -27,15 +30,21 @@ func Register(c *fiber.Ctx) error {
 	}
 
 	// Validate role
-	if input.Role != "buyer" && input.Role != "seller" {
+	if input.Role != models.RoleBuyer && input.Role != models.RoleSeller {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid role. Must be 'buyer' or 'seller'"})
 	}
 
 	// Validate seller-specific fields
-	if input.Role == "seller" && input.ShopName == "" {
+	if input.Role == models.RoleSeller && input.ShopName == "" {
 		return c.Status(400).JSON(fiber.Map{"error": "Shop name is required for sellers"})
 	}
 
+	locale := input.Locale
+	if locale == "" {
+		locale = c.Get("Accept-Language")
+	}
+	locale = services.NormalizeLocale(locale)
+
 	// Hash password
 	hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), 12)
 	if err != nil {
@@ -58,19 +67,28 @@ func Register(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Email already exists"})
 	}
 
+	// Save the pending registration and queue the verification email together
+	tx := config.DB.Begin()
+	if tx.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to start transaction"})
+	}
+
 	// Check if pending registration already exists
 	var existingPending models.PendingRegistration
-	if err := config.DB.Where("email = ?", input.Email).First(&existingPending).Error; err == nil {
+	if err := tx.Where("email = ?", input.Email).First(&existingPending).Error; err == nil {
 		// Update existing pending registration
 		existingPending.Name = input.Name
 		existingPending.Password = string(hashed)
 		existingPending.Address = input.Address
 		existingPending.Role = input.Role
 		existingPending.ShopName = input.ShopName
+		existingPending.Locale = locale
 		existingPending.VerificationToken = code
 		existingPending.VerificationExpiry = &expiry
+		existingPending.VerificationAttempts = 0
 
-		if err := config.DB.Save(&existingPending).Error; err != nil {
+		if err := tx.Save(&existingPending).Error; err != nil {
+			tx.Rollback()
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to update pending registration"})
 		}
 	} else {
@@ -82,58 +100,62 @@ func Register(c *fiber.Ctx) error {
 			Address:            input.Address,
 			Role:               input.Role,
 			ShopName:           input.ShopName,
+			Locale:             locale,
 			VerificationToken:  code,
 			VerificationExpiry: &expiry,
 		}
 
-		if err := config.DB.Create(&pendingReg).Error; err != nil {
+		if err := tx.Create(&pendingReg).Error; err != nil {
+			tx.Rollback()
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to create pending registration"})
 		}
 	}
 
-	// Send verification email (in background)
-	emailSent := false
-	if emailService.IsEmailConfigured() {
-		go func() {
-			if err := emailService.SendVerificationEmail(input.Email, input.Name, code); err != nil {
-				// Error is already logged in SendVerificationEmail
-				// Verification code is also logged there for fallback
-			}
-		}()
-		emailSent = true
+	// Queue verification email; the outbox worker sends it and retries on failure
+	if err := emailService.Queue(tx).InLocale(locale).SendVerificationEmail(input.Email, input.Name, code); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to queue verification email"})
 	}
-
-	// Always include verification code in response for fallback (even if email is configured)
-	// This ensures users can verify even if email fails to send
-	response := fiber.Map{
-		"message":              "Registration successful! Please verify your account.",
-		"email":                input.Email,
-		"requiresVerification": true,
-		"verificationCode":     code,
-		"verificationURL":      os.Getenv("FRONTEND_URL") + "/verify-email",
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save pending registration"})
 	}
 
-	if !emailSent {
-		response["message"] = "Registration successful! Email service not configured. Please use the verification code below."
-	} else {
-		response["message"] = "Registration successful! Check your email for verification code (also shown below as backup)."
+	// The code only ever goes to the inbox: handing it back here would let anyone
+	// register someone else's email and verify it themselves
+	if !emailService.IsEmailConfigured() {
+		log.Printf("⚠️ Email service not configured. Verification code: %s", code)
 	}
 
-	return c.Status(201).JSON(response)
+	return c.Status(201).JSON(fiber.Map{
+		"message":              "Registration successful! Check your email for your verification code.",
+		"email":                input.Email,
+		"requiresVerification": true,
+		"verificationURL":      os.Getenv("FRONTEND_URL") + "/verify-email",
+	})
 }
 
-// Logout handles user logout
+// Logout ends the current session and clears the authentication cookies
 func Logout(c *fiber.Ctx) error {
-	// Clear the authentication cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "token",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour), // Set to past time to delete
-		HTTPOnly: true,
-		Secure:   false, // true in production
-		SameSite: "Lax",
-		Path:     "/",
-	})
+	refreshToken := c.Cookies("refresh_token")
+	if refreshToken == "" {
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		c.BodyParser(&body)
+		refreshToken = body.RefreshToken
+	}
+	if err := services.RevokeRefreshToken(config.DB, refreshToken); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to end session"})
+	}
+	// Also end the session behind a still-valid access token, for clients that lost the refresh token
+	accessToken := middleware.BearerToken(c)
+	if accessToken == "" {
+		accessToken = c.Cookies("token")
+	}
+	if claims, err := services.ParseAccessToken(accessToken); err == nil {
+		services.RevokeSession(config.DB, claims.UserID, claims.SessionID)
+	}
 
+	middleware.ClearSessionCookies(c)
 	return c.JSON(fiber.Map{"message": "Logout successful"})
 }
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RefreshToken exchanges the refresh token (cookie or "refresh_token" in the body) for a
+// new access token and a new refresh token. The old refresh token stops working.
+func RefreshToken(c *fiber.Ctx) error {
+	refreshToken := c.Cookies("refresh_token")
+	if refreshToken == "" {
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		c.BodyParser(&body)
+		refreshToken = body.RefreshToken
+	}
+	if refreshToken == "" {
+		return c.Status(401).JSON(fiber.Map{"error": "Missing refresh token"})
+	}
+
+	tokens, err := services.RefreshSession(config.DB, refreshToken, c.Get("User-Agent"), c.IP())
+	if err != nil {
+		if errors.Is(err, services.ErrRefreshTokenReplay) {
+			log.Printf("⚠️ Refresh token reuse from %s, session revoked", c.IP())
+		}
+		middleware.ClearSessionCookies(c)
+		return c.Status(401).JSON(fiber.Map{"error": "Session expired, please log in again"})
+	}
+	middleware.SetSessionCookies(c, tokens)
+
+	response := fiber.Map{
+		"token":      tokens.AccessToken,
+		"expires_at": tokens.AccessExpiresAt,
+	}
+	if tokens.RefreshToken != "" {
+		response["refresh_token"] = tokens.RefreshToken
+	}
+	return c.JSON(response)
+}
+
+// GetSessions lists the user's signed-in devices, marking the one making the request
+func GetSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	currentID, _ := c.Locals("session_id").(uint)
+
+	var sessions []models.Session
+	if err := config.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > NOW()", userID).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch sessions"})
+	}
+
+	result := make([]fiber.Map, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, fiber.Map{
+			"id":           session.ID,
+			"device":       session.Device,
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastSeenAt,
+			"current":      session.ID == currentID,
+		})
+	}
+	return c.JSON(fiber.Map{"sessions": result})
+}
+
+// RevokeSession signs one of the user's devices out
+func RevokeSession(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	sessionID, err := c.ParamsInt("id")
+	if err != nil || sessionID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+
+	revoked, err := services.RevokeSession(config.DB, userID, uint(sessionID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to revoke session"})
+	}
+	if !revoked {
+		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	if currentID, _ := c.Locals("session_id").(uint); currentID == uint(sessionID) {
+		middleware.ClearSessionCookies(c)
+	}
+	return c.JSON(fiber.Map{"message": "Session revoked"})
+}
+
+// LogoutAllDevices revokes every session of the user, including the current one
+func LogoutAllDevices(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	count, err := services.RevokeAllSessions(config.DB, userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to log out devices"})
+	}
+
+	middleware.ClearSessionCookies(c)
+	return c.JSON(fiber.Map{"message": "Logged out of all devices", "sessions_revoked": count})
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRegisterKeepsCodeInTheInbox(t *testing.T) {
+	db := setupTestDB(t)
+	app := fiber.New()
+	app.Post("/register", Register)
+
+	res := doJSON(t, app, "POST", "/register", "", fiber.Map{
+		"name": "Almaz", "email": "almaz@example.com", "password": "correct horse", "role": models.RoleBuyer,
+	})
+	if res.Status != 201 {
+		t.Fatalf("register: %d %v", res.Status, res.Body)
+	}
+
+	var pending models.PendingRegistration
+	if err := db.Where("email = ?", "almaz@example.com").First(&pending).Error; err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range res.Body {
+		if fmt.Sprint(value) == pending.VerificationToken {
+			t.Errorf("response %q holds the verification code", key)
+		}
+	}
+}
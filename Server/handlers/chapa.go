@@ -11,9 +11,12 @@ import (
 	"time"
 
 	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
 	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // StorePendingOrder stores a pending order before payment
@@ -24,6 +27,34 @@ func StorePendingOrder(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	// Price the order on the server so the payment amount can't be tampered with
+	quote, err := buildOrderQuote(config.DB, user, req.Items, req.CouponCode,
+		shippingDestination{City: req.ShippingCity, State: req.ShippingState})
+	if err != nil {
+		if _, ok := err.(*quoteError); ok {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to price order"})
+	}
+
+	// Hold the promotion use now, so a coupon that runs out or expires while the buyer
+	// is paying can't fail an order that has already been charged
+	var redemptionID uint
+	redemption, err := quote.reservePromotion(config.DB, user.ID, 0)
+	if err != nil {
+		if _, ok := err.(*quoteError); ok {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to price order"})
+	}
+	if redemption != nil {
+		redemptionID = redemption.ID
+	}
+
 	// Generate a transaction reference
 	txRef := fmt.Sprintf("injera_%d", time.Now().UnixNano())
 
@@ -37,33 +68,36 @@ func StorePendingOrder(c *fiber.Ctx) error {
 		ShippingPhone:   req.ShippingPhone,
 		Notes:           req.Notes,
 		PaymentMethod:   req.PaymentMethod,
+		CouponCode:      req.CouponCode,
 		Items:           req.Items,
-		TotalAmount:     req.TotalAmount,
+		TotalAmount:     quote.Total,
 		CreatedAt:       time.Now(),
+		Quote:           quote,
+		RedemptionID:    redemptionID,
 	}
 
 	sessionStorage.StorePendingOrder(txRef, pendingOrder)
 
 	return c.JSON(fiber.Map{
-		"message": "Pending order stored successfully",
-		"tx_ref":  txRef,
+		"message":      "Pending order stored successfully",
+		"tx_ref":       txRef,
+		"total_amount": quote.Total,
+		"quote":        quote.response(),
 	})
 }
 
 // PendingOrderRequest represents the request for storing a pending order
 type PendingOrderRequest struct {
-	ShippingAddress string `json:"shipping_address"`
-	ShippingCity    string `json:"shipping_city"`
-	ShippingState   string `json:"shipping_state"`
-	ShippingZip     string `json:"shipping_zip"`
-	ShippingPhone   string `json:"shipping_phone"`
-	Notes           string `json:"notes"`
-	PaymentMethod   string `json:"payment_method"`
-	Items           []struct {
-		ProductID uint `json:"product_id"`
-		Quantity  int  `json:"quantity"`
-	} `json:"items"`
-	TotalAmount float64 `json:"total_amount"`
+	ShippingAddress string           `json:"shipping_address"`
+	ShippingCity    string           `json:"shipping_city"`
+	ShippingState   string           `json:"shipping_state"`
+	ShippingZip     string           `json:"shipping_zip"`
+	ShippingPhone   string           `json:"shipping_phone"`
+	Notes           string           `json:"notes"`
+	PaymentMethod   string           `json:"payment_method"`
+	CouponCode      string           `json:"coupon_code"`
+	Items           []OrderItemInput `json:"items" validate:"required,min=1,dive"`
+	TotalAmount     float64          `json:"total_amount"` // Ignored; the server computes the amount
 }
 
 // ChapaPaymentRequest represents the request for creating a Chapa payment
@@ -103,6 +137,13 @@ func CreateChapaPayment(c *fiber.Ctx) error {
 		})
 	}
 
+	// Charge the server-computed total when paying for a stored pending order
+	if req.TxRef != "" {
+		if pendingOrder, exists := sessionStorage.GetPendingOrder(req.TxRef); exists {
+			req.Amount = pendingOrder.TotalAmount
+		}
+	}
+
 	// Validate required fields for real Chapa payment
 	if req.Amount <= 0 {
 		return c.Status(400).JSON(fiber.Map{
@@ -132,8 +173,7 @@ func CreateChapaPayment(c *fiber.Ctx) error {
 	}
 
 	// Validate phone number format (Ethiopian format)
-	phoneRegex := regexp.MustCompile(`^(\+251|0)?9[0-9]{8}$`)
-	if !phoneRegex.MatchString(req.PhoneNumber) {
+	if _, ok := services.NormalizePhone(req.PhoneNumber); !ok {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Please provide a valid Ethiopian phone number (e.g., 0912345678 or +251912345678)",
 		})
@@ -361,16 +401,16 @@ func ChapaCallback(c *fiber.Ctx) error {
 
 	// If payment was successful, create the order from pending order
 	if paymentStatus == "success" {
-		pendingOrder, exists := sessionStorage.GetPendingOrder(txRef)
+		pendingOrder, exists := sessionStorage.TakePendingOrder(txRef)
 		if exists {
 			// Create the actual order
 			order, err := createOrderFromPending(pendingOrder, txRef)
 			if err != nil {
+				// Keep it for the verify request to retry
+				sessionStorage.StorePendingOrder(txRef, pendingOrder)
 				return c.Redirect(fmt.Sprintf("%s/payment-success?tx_ref=%s&status=error", frontendURL, txRef))
 			}
 
-			// Clean up pending order
-			sessionStorage.DeletePendingOrder(txRef)
 			// Redirect with both order_id and tx_ref for robustness
 			return c.Redirect(fmt.Sprintf("%s/payment-success?status=success&order_id=%d&tx_ref=%s", frontendURL, order.ID, txRef))
 		} else {
@@ -379,8 +419,13 @@ func ChapaCallback(c *fiber.Ctx) error {
 		}
 	}
 
-	// If payment failed, clean up pending order
-	sessionStorage.DeletePendingOrder(txRef)
+	// If payment failed, let the buyer know and clean up pending order
+	if pendingOrder, exists := sessionStorage.TakePendingOrder(txRef); exists {
+		releasePendingOrder(pendingOrder)
+		if err := queuePaymentFailedEmail(config.DB, pendingOrder.UserID, txRef, pendingOrder.TotalAmount); err != nil {
+			fmt.Printf("❌ Failed to queue payment failed email for %s: %v\n", txRef, err)
+		}
+	}
 	return c.Redirect(fmt.Sprintf("%s/payment-success?status=failed&tx_ref=%s", frontendURL, txRef))
 }
 
@@ -475,18 +520,17 @@ func VerifyChapaPayment(c *fiber.Ctx) error {
 		}
 
 		// Order doesn't exist - try to create from pending order
-		pendingOrder, exists := sessionStorage.GetPendingOrder(txRef)
+		pendingOrder, exists := sessionStorage.TakePendingOrder(txRef)
 		if exists {
 			order, err := createOrderFromPending(pendingOrder, txRef)
 			if err != nil {
+				sessionStorage.StorePendingOrder(txRef, pendingOrder)
 				return c.Status(500).JSON(fiber.Map{
 					"error":   "Payment verified but failed to create order",
 					"details": err.Error(),
 				})
 			}
 
-			sessionStorage.DeletePendingOrder(txRef)
-
 			return c.JSON(fiber.Map{
 				"message":        "Payment verified and order created successfully",
 				"status":         "success",
@@ -519,48 +563,20 @@ func VerifyChapaPayment(c *fiber.Ctx) error {
 	})
 }
 
-// createOrderFromPending creates an order from a pending order
+// createOrderFromPending creates the order for a confirmed payment from the quote the
+// buyer was charged. Nothing is re-priced: the money has already been taken.
 func createOrderFromPending(pendingOrder *PendingOrder, txRef string) (*models.Order, error) {
+	quote := pendingOrder.Quote
+	if quote == nil {
+		return nil, fmt.Errorf("pending order %s has no quote", txRef)
+	}
+
 	// Start transaction
 	tx := config.DB.Begin()
 	if tx.Error != nil {
 		return nil, fmt.Errorf("failed to start transaction: %v", tx.Error)
 	}
 
-	// Calculate subtotal
-	var subtotal float64
-	var orderItems []models.OrderItem
-
-	for _, item := range pendingOrder.Items {
-		var product models.Product
-		if err := tx.First(&product, item.ProductID).Error; err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("product not found: %v", err)
-		}
-
-		if product.Stock < item.Quantity {
-			tx.Rollback()
-			return nil, fmt.Errorf("insufficient stock for product %s", product.Name)
-		}
-
-		itemTotal := product.Price * float64(item.Quantity)
-		subtotal += itemTotal
-
-		orderItem := models.OrderItem{
-			ProductID: product.ID,
-			Quantity:  item.Quantity,
-			Price:     product.Price,
-		}
-		orderItems = append(orderItems, orderItem)
-
-		// Update product stock
-		product.Stock -= item.Quantity
-		if err := tx.Save(&product).Error; err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("failed to update product stock: %v", err)
-		}
-	}
-
 	// Create order
 	order := models.Order{
 		UserID:          pendingOrder.UserID,
@@ -575,17 +591,38 @@ func createOrderFromPending(pendingOrder *PendingOrder, txRef string) (*models.O
 		ShippingZip:     pendingOrder.ShippingZip,
 		ShippingPhone:   pendingOrder.ShippingPhone,
 		Notes:           pendingOrder.Notes,
-		Subtotal:        subtotal,
-		ShippingFee:     0,
-		Total:           subtotal,
-		OrderItems:      orderItems,
 	}
+	quote.applyToOrder(&order)
 
 	if err := tx.Create(&order).Error; err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to create order: %v", err)
 	}
 
+	// The promotion use was reserved at checkout; it now belongs to the order
+	if pendingOrder.RedemptionID != 0 {
+		if err := tx.Model(&models.PromotionRedemption{}).Where("id = ?", pendingOrder.RedemptionID).
+			Update("order_id", order.ID).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to apply promotion: %v", err)
+		}
+	}
+
+	// Update product stock. The buyer has paid, so a sale that raced the last units
+	// through still goes ahead and the seller sees the shortfall as negative stock.
+	for _, item := range order.OrderItems {
+		if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
+			Update("stock", gorm.Expr("stock - ?", item.Quantity)).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to update product stock: %v", err)
+		}
+	}
+
+	if err := queueOrderPlacedEmails(tx, order.ID); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to queue order emails: %v", err)
+	}
+
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %v", err)
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// setupCheckout creates a VAT-registered seller with a 100 ETB product, a 15% VAT rule and a 10% coupon
+// that can be used once
+func setupCheckout(t *testing.T, db *gorm.DB) (*fiber.App, models.Product, models.Promotion) {
+	t.Helper()
+	seller := createTestUser(t, db, "seller@example.com", models.RoleSeller)
+	db.Model(&seller).Update("vat_registered", true)
+	product := models.Product{SellerID: seller.ID, Name: "Teff", Price: 100, Stock: 10, Status: models.ProductStatusPublished}
+	db.Create(&product)
+	db.Create(&models.TaxRule{Category: "", VATRate: 0.15, TOTRate: 0.02})
+	promotion := models.Promotion{Code: "TEFF10", Name: "Teff week", Type: models.PromotionTypePercentage, Value: 10, UsageLimit: 1, Active: true}
+	db.Create(&promotion)
+
+	app := fiber.New()
+	app.Post("/pending", middleware.RequireAuth, StorePendingOrder)
+	return app, product, promotion
+}
+
+func TestPendingOrderKeepsChargedQuote(t *testing.T) {
+	db := setupTestDB(t)
+	app, product, promotion := setupCheckout(t, db)
+	buyer := createTestUser(t, db, "buyer@example.com", models.RoleBuyer)
+
+	res := doJSON(t, app, "POST", "/pending", accessToken(t, db, buyer), fiber.Map{
+		"coupon_code": "teff10",
+		"items":       []fiber.Map{{"product_id": product.ID, "quantity": 2}},
+	})
+	if res.Status != 200 {
+		t.Fatalf("store pending order: %d %v", res.Status, res.Body)
+	}
+	txRef := res.Body["tx_ref"].(string)
+	charged := res.Body["total_amount"].(float64)
+	if want := 207.0; charged != want { // 200 - 10% + 15% VAT on 180
+		t.Fatalf("charged %.2f, want %.2f", charged, want)
+	}
+
+	// While the buyer pays: the coupon expires, VAT changes and the price goes up
+	expired := time.Now().Add(-time.Minute)
+	db.Model(&promotion).Update("ends_at", expired)
+	db.Model(&models.TaxRule{}).Where("category = ?", "").Update("vat_rate", 0.2)
+	db.Model(&product).Update("price", 150)
+
+	pending, ok := sessionStorage.TakePendingOrder(txRef)
+	if !ok {
+		t.Fatal("pending order not stored")
+	}
+	order, err := createOrderFromPending(pending, txRef)
+	if err != nil {
+		t.Fatalf("createOrderFromPending: %v", err)
+	}
+	if order.Total != charged || order.Discount != 20 || order.PromotionCode != "TEFF10" {
+		t.Errorf("order total %.2f discount %.2f code %q, want %.2f, 20, TEFF10", order.Total, order.Discount, order.PromotionCode, charged)
+	}
+
+	var redemption models.PromotionRedemption
+	db.Where("promotion_id = ?", promotion.ID).First(&redemption)
+	if redemption.OrderID != order.ID {
+		t.Errorf("redemption order %d, want %d", redemption.OrderID, order.ID)
+	}
+	db.First(&product, product.ID)
+	if product.Stock != 8 {
+		t.Errorf("stock %d, want 8", product.Stock)
+	}
+}
+
+func TestPendingOrderReservesPromotion(t *testing.T) {
+	db := setupTestDB(t)
+	app, product, promotion := setupCheckout(t, db)
+	first := createTestUser(t, db, "first@example.com", models.RoleBuyer)
+	second := createTestUser(t, db, "second@example.com", models.RoleBuyer)
+	body := fiber.Map{
+		"coupon_code": "TEFF10",
+		"items":       []fiber.Map{{"product_id": product.ID, "quantity": 1}},
+	}
+
+	res := doJSON(t, app, "POST", "/pending", accessToken(t, db, first), body)
+	if res.Status != 200 {
+		t.Fatalf("first checkout: %d %v", res.Status, res.Body)
+	}
+	txRef := res.Body["tx_ref"].(string)
+
+	if res := doJSON(t, app, "POST", "/pending", accessToken(t, db, second), body); res.Status != 400 {
+		t.Fatalf("second checkout while the only use is reserved: got %d, want 400", res.Status)
+	}
+
+	// The first payment fails, which gives the use back
+	pending, _ := sessionStorage.TakePendingOrder(txRef)
+	releasePendingOrder(pending)
+	db.First(&promotion, promotion.ID)
+	if promotion.UsedCount != 0 {
+		t.Fatalf("used count %d after release, want 0", promotion.UsedCount)
+	}
+
+	if res := doJSON(t, app, "POST", "/pending", accessToken(t, db, second), body); res.Status != 200 {
+		t.Errorf("second checkout after release: %d %v", res.Status, res.Body)
+	}
+}
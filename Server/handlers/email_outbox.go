@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetEmailOutbox lists outbox messages for admins, dead-lettered ones by default (?status=pending|sent|dead)
+func GetEmailOutbox(c *fiber.Ctx) error {
+	status := models.EmailStatus(c.Query("status", string(models.EmailStatusDead)))
+	switch status {
+	case models.EmailStatusPending, models.EmailStatusSent, models.EmailStatusDead:
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid status. Must be one of: pending, sent, dead"})
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	var messages []models.EmailOutbox
+	if err := config.DB.Where("status = ?", status).
+		Order("updated_at DESC").
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch email outbox"})
+	}
+
+	var counts []struct {
+		Status models.EmailStatus `json:"status"`
+		Count  int64              `json:"count"`
+	}
+	config.DB.Model(&models.EmailOutbox{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts)
+
+	return c.JSON(fiber.Map{"messages": messages, "counts": counts})
+}
+
+// ResendEmail puts a dead-lettered message back in the queue for another round of attempts.
+// Sent messages can't be resent, since their bodies aren't kept.
+func ResendEmail(c *fiber.Ctx) error {
+	var message models.EmailOutbox
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&message).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Email not found"})
+	}
+	if message.Status == models.EmailStatusPending {
+		return c.Status(409).JSON(fiber.Map{"error": "Email is already queued"})
+	}
+	if message.Body == "" {
+		return c.Status(409).JSON(fiber.Map{"error": "Sent emails aren't kept and can't be resent"})
+	}
+
+	if err := config.DB.Model(&message).Updates(map[string]interface{}{
+		"status":          models.EmailStatusPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+		"last_error":      "",
+	}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to requeue email"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Email queued for resending", "email": message})
+}
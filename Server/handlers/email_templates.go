@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetEmailTemplates lists the email templates and languages admins can preview
+func GetEmailTemplates(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"templates": services.EmailTemplateNames(),
+		"locales":   services.SupportedLocales,
+	})
+}
+
+// PreviewEmailTemplate renders a template with sample data (?locale=en|am|om). The HTML
+// body is returned as a page by default; ?format=text gives the plaintext version and
+// ?format=json returns the subject and both bodies.
+func PreviewEmailTemplate(c *fiber.Ctx) error {
+	locale := c.Query("locale", services.DefaultLocale)
+	subject, html, text, err := services.PreviewEmail(c.Params("name"), locale)
+	if errors.Is(err, services.ErrUnknownEmailTemplate) {
+		return c.Status(404).JSON(fiber.Map{"error": "Email template not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to render email template", "details": err.Error()})
+	}
+
+	switch c.Query("format", "html") {
+	case "text":
+		c.Type("txt", "utf-8")
+		return c.SendString(text)
+	case "json":
+		return c.JSON(fiber.Map{
+			"template": c.Params("name"),
+			"locale":   services.NormalizeLocale(locale),
+			"subject":  subject,
+			"html":     html,
+			"text":     text,
+		})
+	default:
+		c.Type("html", "utf-8")
+		return c.SendString(html)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"log"
 	"time"
 
@@ -8,12 +9,14 @@ import (
 	"gorm.io/gorm"
 
 	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
 	"injera-gebeya-platform/Server/models"
 	"injera-gebeya-platform/Server/services"
 )
 
 type EmailVerificationRequest struct {
-	Code string `json:"code" validate:"required"`
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required,numeric,len=6"`
 }
 
 type ResendVerificationRequest struct {
@@ -29,25 +32,26 @@ func VerifyEmail(c *fiber.Ctx) error {
 		})
 	}
 
-	if req.Code == "" {
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Verification code is required",
+			"error":  "Email and 6-digit verification code are required",
+			"fields": fieldErrors,
 		})
 	}
 
-	// Find pending registration by verification code
+	if status := services.CheckThrottle(config.DB, models.ThrottleIP, c.IP()); !status.Allowed() {
+		return throttledResponse(c, status)
+	}
+
+	// Codes are checked against the registration they were sent for, so a guess only
+	// ever hits one registration and counts against its attempts
 	var pendingReg models.PendingRegistration
 	// Use Unscoped() to find pending registrations including soft-deleted ones
-	result := config.DB.Unscoped().Where("verification_token = ? AND verification_expiry > ?", req.Code, time.Now()).First(&pendingReg)
+	result := config.DB.Unscoped().Where("LOWER(email) = ? AND verification_expiry > ?", throttleAccountKey(req.Email), time.Now()).First(&pendingReg)
 
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			log.Printf("⚠️ Verification code not found or expired: %s", req.Code)
-			// Try to find by code without expiry check (for debugging)
-			var debugPending models.PendingRegistration
-			if debugErr := config.DB.Unscoped().Where("verification_token = ?", req.Code).First(&debugPending).Error; debugErr == nil {
-				log.Printf("🔍 Found code but expired: email=%s, expiry=%v, now=%v", debugPending.Email, debugPending.VerificationExpiry, time.Now())
-			}
+			services.RecordFailure(config.DB, models.ThrottleIP, c.IP())
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": "Invalid or expired verification code",
 			})
@@ -59,50 +63,75 @@ func VerifyEmail(c *fiber.Ctx) error {
 		})
 	}
 
-	log.Printf("📋 Verification request: code=%s, found pendingReg ID=%d, email=%s, role=%s, shopName=%s", req.Code, pendingReg.ID, pendingReg.Email, pendingReg.Role, pendingReg.ShopName)
+	if pendingReg.VerificationAttempts >= models.MaxVerificationAttempts {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":       "Too many wrong codes. Request a new verification code",
+			"codeExpired": true,
+		})
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pendingReg.VerificationToken), []byte(req.Code)) != 1 {
+		config.DB.Unscoped().Model(&pendingReg).Update("verification_attempts", gorm.Expr("verification_attempts + 1"))
+		services.RecordFailure(config.DB, models.ThrottleIP, c.IP())
+
+		remaining := models.MaxVerificationAttempts - pendingReg.VerificationAttempts - 1
+		if remaining <= 0 {
+			log.Printf("🔒 Verification code for %s used up after %d wrong attempts", pendingReg.Email, models.MaxVerificationAttempts)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":       "Too many wrong codes. Request a new verification code",
+				"codeExpired": true,
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             "Invalid or expired verification code",
+			"attemptsRemaining": remaining,
+		})
+	}
 
 	log.Printf("✅ Found pending registration for email: %s, role: %s, shopName: %s", pendingReg.Email, pendingReg.Role, pendingReg.ShopName)
 
 	// Use UPSERT (INSERT ... ON CONFLICT DO UPDATE) as the primary method
 	log.Printf("🔄 Verifying user via UPSERT: email=%s, role=%s, shopName=%s", pendingReg.Email, pendingReg.Role, pendingReg.ShopName)
 
-	sqlDB, sqlErr := config.DB.DB()
-	if sqlErr != nil {
-		log.Printf("❌ Failed to get SQL DB: %v", sqlErr)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Database connection error",
-		})
-	}
+	// Derive the shop slug up front since the raw queries below bypass GORM hooks
+	var existingUserID uint
+	config.DB.Unscoped().Model(&models.User{}).Select("id").Where("email = ?", pendingReg.Email).Scan(&existingUserID)
+	var shopSlug string
+	locale := services.NormalizeLocale(pendingReg.Locale)
 
-	// UPSERT: Insert or update user atomically
+	// UPSERT: Insert or update user atomically, together with queueing the welcome email
 	var userID uint
-	upsertQuery := `INSERT INTO users (name, email, password, address, role, shop_name, email_verified, verification_token, created_at, updated_at, deleted_at)
-		VALUES ($1, $2, $3, $4, $5, $6, true, NULL, NOW(), NOW(), NULL)
+	upsertQuery := `INSERT INTO users (name, email, password, address, role, shop_name, shop_slug, locale, email_verified, verification_token, created_at, updated_at, deleted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, true, NULL, NOW(), NOW(), NULL)
 		ON CONFLICT (email) DO UPDATE SET
 			name = EXCLUDED.name,
 			password = EXCLUDED.password,
 			address = EXCLUDED.address,
 			role = EXCLUDED.role,
 			shop_name = EXCLUDED.shop_name,
+			shop_slug = EXCLUDED.shop_slug,
+			locale = EXCLUDED.locale,
 			email_verified = true,
 			verification_token = NULL,
 			updated_at = NOW(),
 			deleted_at = NULL
 		RETURNING id`
 
-	upsertErr := sqlDB.QueryRow(upsertQuery,
-		pendingReg.Name, pendingReg.Email, pendingReg.Password,
-		pendingReg.Address, pendingReg.Role, pendingReg.ShopName).Scan(&userID)
+	// Another shop can take the slug before this commits; the retry picks the next one
+	upsertErr := models.RetryShopSlugConflicts(func() error {
+		shopSlug = models.UniqueShopSlug(config.DB, pendingReg.ShopName, existingUserID)
+		return config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Raw(upsertQuery,
+				pendingReg.Name, pendingReg.Email, pendingReg.Password,
+				pendingReg.Address, pendingReg.Role, pendingReg.ShopName, shopSlug, locale).Scan(&userID).Error; err != nil {
+				return err
+			}
+			return completeVerification(tx, &pendingReg)
+		})
+	})
 
 	if upsertErr == nil {
-		config.DB.Delete(&pendingReg)
 		log.Printf("✅ User verified via UPSERT: ID=%d", userID)
-		emailService := services.NewEmailService()
-		if emailService.IsEmailConfigured() {
-			go func() {
-				emailService.SendWelcomeEmail(pendingReg.Email, pendingReg.Name)
-			}()
-		}
 		return c.JSON(fiber.Map{
 			"message": "Email verified successfully! You can now log in.",
 			"user": fiber.Map{
@@ -117,40 +146,41 @@ func VerifyEmail(c *fiber.Ctx) error {
 	// Fallback: Direct UPDATE if UPSERT fails
 	log.Printf("⚠️ UPSERT failed: %v, trying direct UPDATE...", upsertErr)
 	updateQuery := `UPDATE users SET 
-		name = $1, password = $2, address = $3, role = $4, shop_name = $5, 
+		name = ?, password = ?, address = ?, role = ?, shop_name = ?, shop_slug = ?, locale = ?,
 		email_verified = true, verification_token = NULL, updated_at = NOW(), deleted_at = NULL
-		WHERE email = $6`
-	updateResult, updateErr := sqlDB.Exec(updateQuery,
-		pendingReg.Name, pendingReg.Password, pendingReg.Address,
-		pendingReg.Role, pendingReg.ShopName, pendingReg.Email)
+		WHERE email = ?`
+
+	var updatedID uint
+	updateErr := models.RetryShopSlugConflicts(func() error {
+		shopSlug = models.UniqueShopSlug(config.DB, pendingReg.ShopName, existingUserID)
+		return config.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Exec(updateQuery,
+				pendingReg.Name, pendingReg.Password, pendingReg.Address,
+				pendingReg.Role, pendingReg.ShopName, shopSlug, locale, pendingReg.Email)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			tx.Raw("SELECT id FROM users WHERE email = ?", pendingReg.Email).Scan(&updatedID)
+			return completeVerification(tx, &pendingReg)
+		})
+	})
 
 	if updateErr == nil {
-		rowsAffected, _ := updateResult.RowsAffected()
-		if rowsAffected > 0 {
-			var updatedID uint
-			sqlDB.QueryRow("SELECT id FROM users WHERE email = $1", pendingReg.Email).Scan(&updatedID)
-			config.DB.Delete(&pendingReg)
-			log.Printf("✅ User verified via UPDATE: ID=%d", updatedID)
-			emailService := services.NewEmailService()
-			if emailService.IsEmailConfigured() {
-				go func() {
-					emailService.SendWelcomeEmail(pendingReg.Email, pendingReg.Name)
-				}()
-			}
-			return c.JSON(fiber.Map{
-				"message": "Email verified successfully! You can now log in.",
-				"user": fiber.Map{
-					"id":    updatedID,
-					"name":  pendingReg.Name,
-					"email": pendingReg.Email,
-					"role":  pendingReg.Role,
-				},
-			})
-		}
-		log.Printf("⚠️ UPDATE affected 0 rows")
-	} else {
-		log.Printf("⚠️ UPDATE failed: %v", updateErr)
+		log.Printf("✅ User verified via UPDATE: ID=%d", updatedID)
+		return c.JSON(fiber.Map{
+			"message": "Email verified successfully! You can now log in.",
+			"user": fiber.Map{
+				"id":    updatedID,
+				"name":  pendingReg.Name,
+				"email": pendingReg.Email,
+				"role":  pendingReg.Role,
+			},
+		})
 	}
+	log.Printf("⚠️ UPDATE failed: %v", updateErr)
 
 	// Final fallback: GORM Create (shouldn't reach here if UPSERT works)
 	log.Printf("❌ UPDATE also failed: %v, trying GORM Create...", updateErr)
@@ -161,25 +191,27 @@ func VerifyEmail(c *fiber.Ctx) error {
 		Address:           pendingReg.Address,
 		Role:              pendingReg.Role,
 		ShopName:          pendingReg.ShopName,
+		Locale:            locale,
 		EmailVerified:     true,
 		VerificationToken: "", // Will be set to NULL by GORM if empty
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
+	if err := models.RetryShopSlugConflicts(func() error {
+		user.ShopSlug = "" // Derived again by the save hook
+		return config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			return completeVerification(tx, &pendingReg)
+		})
+	}); err != nil {
 		log.Printf("❌ All methods failed: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to verify user account. Please try again.",
 		})
 	}
 
-	config.DB.Delete(&pendingReg)
 	log.Printf("✅ User created via GORM: ID=%d", user.ID)
-	emailService := services.NewEmailService()
-	if emailService.IsEmailConfigured() {
-		go func() {
-			emailService.SendWelcomeEmail(user.Email, user.Name)
-		}()
-	}
 	return c.JSON(fiber.Map{
 		"message": "Email verified successfully! You can now log in.",
 		"user": fiber.Map{
@@ -191,6 +223,20 @@ func VerifyEmail(c *fiber.Ctx) error {
 	})
 }
 
+// completeVerification removes the pending registration, starts seller onboarding and
+// queues the welcome email in tx
+func completeVerification(tx *gorm.DB, pendingReg *models.PendingRegistration) error {
+	if err := tx.Delete(pendingReg).Error; err != nil {
+		return err
+	}
+	if pendingReg.Role == models.RoleSeller {
+		if err := createSellerApplication(tx, pendingReg.Email); err != nil {
+			return err
+		}
+	}
+	return services.NewEmailService().Queue(tx).InLocale(pendingReg.Locale).SendWelcomeEmail(pendingReg.Email, pendingReg.Name)
+}
+
 // ResendVerificationEmail resends verification email
 func ResendVerificationEmail(c *fiber.Ctx) error {
 	var req ResendVerificationRequest
@@ -199,6 +245,9 @@ func ResendVerificationEmail(c *fiber.Ctx) error {
 			"error": "Invalid request body",
 		})
 	}
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
 
 	// Find pending registration by email
 	var pendingReg models.PendingRegistration
@@ -230,22 +279,22 @@ func ResendVerificationEmail(c *fiber.Ctx) error {
 	expiry := time.Now().Add(24 * time.Hour) // 24 hours expiry
 	pendingReg.VerificationToken = code
 	pendingReg.VerificationExpiry = &expiry
+	pendingReg.VerificationAttempts = 0
 
-	if err := config.DB.Save(&pendingReg).Error; err != nil {
+	// Save the new code and queue the verification email together
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&pendingReg).Error; err != nil {
+			return err
+		}
+		return emailService.Queue(tx).InLocale(pendingReg.Locale).SendVerificationEmail(pendingReg.Email, pendingReg.Name, code)
+	}); err != nil {
 		log.Printf("Error updating pending registration verification token: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update verification token",
 		})
 	}
 
-	// Send verification email
-	if emailService.IsEmailConfigured() {
-		go func() {
-			if err := emailService.SendVerificationEmail(pendingReg.Email, pendingReg.Name, code); err != nil {
-				log.Printf("Failed to send verification email: %v", err)
-			}
-		}()
-	} else {
+	if !emailService.IsEmailConfigured() {
 		log.Printf("⚠️ Email service not configured. Verification code: %s", code)
 	}
 
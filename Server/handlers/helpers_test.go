@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB points config.DB at a fresh in-memory database with every table migrated
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.ReplaceAll(t.Name(), "/", "_"))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Product{}, &models.ProductImage{}, &models.Order{}, &models.OrderItem{}, &models.PendingRegistration{},
+		&models.Review{}, &models.ReviewPhoto{}, &models.ReviewFlag{}, &models.WishlistItem{},
+		&models.Promotion{}, &models.PromotionRedemption{}, &models.ShippingZone{}, &models.ShippingRate{},
+		&models.TaxRule{}, &models.OrderTaxLine{}, &models.EmailOutbox{}, &models.Session{}, &models.PasswordReset{}, &models.APIKey{}, &models.AuditLog{}, &models.SellerApplication{},
+		&models.LoginChallenge{}, &models.RecoveryCode{}, &models.AuthThrottle{}, &models.OneTimeCode{},
+		&models.OAuthIdentity{}, &models.OAuthLogin{}, &models.OAuthSignup{}); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// createTestUser saves a verified user with the given role
+func createTestUser(t *testing.T, db *gorm.DB, email, role string) models.User {
+	t.Helper()
+	user := models.User{Name: "Test " + role, Email: email, Role: role, EmailVerified: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// accessToken starts a session for the user and returns its bearer token
+func accessToken(t *testing.T, db *gorm.DB, user models.User) string {
+	t.Helper()
+	tokens, err := services.StartSession(db, user, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens.AccessToken
+}
+
+// testResponse is a decoded JSON response
+type testResponse struct {
+	Status  int
+	Body    map[string]interface{}
+	Cookies map[string]string
+}
+
+// doJSON sends a JSON request to app with an optional bearer token and extra headers
+func doJSON(t *testing.T, app *fiber.App, method, path, token string, body interface{}, headers ...string) testResponse {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = strings.NewReader(string(encoded))
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	response := testResponse{Status: res.StatusCode, Body: map[string]interface{}{}, Cookies: map[string]string{}}
+	raw, _ := io.ReadAll(res.Body)
+	json.Unmarshal(raw, &response.Body)
+	for _, cookie := range res.Cookies() {
+		response.Cookies[cookie.Name] = cookie.Value
+	}
+	return response
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetOrderInvoice downloads the order's invoice as a PDF, for the buyer or a seller with items in it
+func GetOrderInvoice(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	orderID, err := c.ParamsInt("id")
+	if err != nil || orderID <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid order ID"})
+	}
+
+	order, sellers, err := loadInvoiceOrder(config.DB, uint(orderID))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+
+	allowed := order.UserID == user.ID
+	if user.Role == models.RoleSeller {
+		_, allowed = sellers[user.ID]
+	}
+	if !allowed {
+		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
+	}
+
+	pdf, err := services.GenerateInvoicePDF(*order, sellers)
+	if err != nil {
+		log.Printf("❌ Failed to generate invoice for order %s: %v", order.OrderNumber, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate invoice"})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="invoice-%s.pdf"`, order.OrderNumber))
+	return c.Send(pdf)
+}
+
+// loadInvoiceOrder loads an order with everything the invoice shows, and its sellers keyed by ID
+func loadInvoiceOrder(db *gorm.DB, orderID uint) (*models.Order, map[uint]models.User, error) {
+	var order models.Order
+	if err := db.Preload("User").Preload("OrderItems").Preload("TaxLines").
+		Where("id = ?", orderID).First(&order).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var sellerIDs []uint
+	for _, item := range order.OrderItems {
+		sellerIDs = append(sellerIDs, item.SellerID)
+	}
+	var sellers []models.User
+	if err := db.Where("id IN ?", sellerIDs).Find(&sellers).Error; err != nil {
+		return nil, nil, err
+	}
+
+	sellerMap := make(map[uint]models.User)
+	for _, seller := range sellers {
+		sellerMap[seller.ID] = seller
+	}
+	return &order, sellerMap, nil
+}
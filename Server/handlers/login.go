@@ -1,14 +1,12 @@
 package handlers
 
 import (
-	"os"
-	"time"
-
 	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
 	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -23,15 +21,26 @@ func Login(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
+	// Refuse attempts that have to wait before checking the password, so they can't guess
+	if status := checkLoginThrottle(c, input.Email); !status.Allowed() {
+		return throttledResponse(c, status)
+	}
+
 	var user models.User
 	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		recordLoginFailure(c, input.Email, nil)
 		return c.Status(401).JSON(fiber.Map{"error": "Invalid email or password"})
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		recordLoginFailure(c, input.Email, &user)
 		return c.Status(401).JSON(fiber.Map{"error": "Invalid email or password"})
 	}
 
+	if user.Suspended() {
+		return c.Status(403).JSON(fiber.Map{"error": "Your account has been suspended", "suspended": true})
+	}
+
 	// Check if email is verified
 	if !user.EmailVerified {
 		return c.Status(403).JSON(fiber.Map{
@@ -41,41 +50,34 @@ func Login(c *fiber.Ctx) error {
 		})
 	}
 
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "supersecret"
+	// The session only starts once the second factor is checked
+	if user.RequiresTwoFactor() {
+		return startLoginChallenge(c, user)
 	}
+	return completeLogin(c, user)
+}
 
-	claims := jwt.MapClaims{
-		"user_id": user.ID,
-		"role":    user.Role,
-		"exp":     time.Now().Add(72 * time.Hour).Unix(),
-		"iat":     time.Now().Unix(),
-	}
+// completeLogin starts a session for a user who has proven who they are and sets the cookies
+func completeLogin(c *fiber.Ctx, user models.User) error {
+	// Failed attempts only count until a sign-in fully succeeds
+	resetAccountThrottle(config.DB, user)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(secret))
+	tokens, err := services.StartSession(config.DB, user, c.Get("User-Agent"), c.IP())
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not login"})
 	}
-
-	c.Cookie(&fiber.Cookie{
-		Name:     "token",
-		Value:    signedToken,
-		Expires:  time.Now().Add(72 * time.Hour),
-		HTTPOnly: true,
-		Secure:   false, // true in production
-		SameSite: "Lax",
-		Path:     "/",
-	})
+	middleware.SetSessionCookies(c, tokens)
 
 	return c.JSON(fiber.Map{
-		"message": "Login successful",
-		"token":   signedToken,
+		"message":       "Login successful",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    tokens.AccessExpiresAt,
 		"user": fiber.Map{
 			"id":    user.ID,
 			"name":  user.Name,
 			"email": user.Email,
+			"phone": user.Phone,
 			"role":  user.Role,
 		},
 	})
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// throttleAccountKey is the key failed attempts for an email are counted under
+func throttleAccountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// userThrottleKey is the key a known user's failed attempts are counted under: their
+// email, or their phone for accounts signed up without one. It matches the key used
+// before the user is looked up, so attempts at every step count together.
+func userThrottleKey(user models.User) string {
+	if user.Email != "" {
+		return throttleAccountKey(user.Email)
+	}
+	return user.Phone
+}
+
+// resetAccountThrottle forgets failed attempts under any key the user signs in with
+func resetAccountThrottle(db *gorm.DB, user models.User) error {
+	if user.Email != "" {
+		if err := services.ResetThrottle(db, models.ThrottleAccount, throttleAccountKey(user.Email)); err != nil {
+			return err
+		}
+	}
+	if user.Phone != "" {
+		return services.ResetThrottle(db, models.ThrottleAccount, user.Phone)
+	}
+	return nil
+}
+
+// checkLoginThrottle reports whether a sign-in attempt from this IP for this email has to
+// wait, taking whichever of the two waits longer
+func checkLoginThrottle(c *fiber.Ctx, email string) services.ThrottleStatus {
+	ipStatus := services.CheckThrottle(config.DB, models.ThrottleIP, c.IP())
+	accountStatus := services.CheckThrottle(config.DB, models.ThrottleAccount, throttleAccountKey(email))
+	if accountStatus.RetryAfter > ipStatus.RetryAfter {
+		return accountStatus
+	}
+	return ipStatus
+}
+
+// recordLoginFailure counts a failed sign-in against the IP and the email or phone. When
+// it locks an existing account, the owner is emailed, or texted if they have no email.
+func recordLoginFailure(c *fiber.Ctx, email string, user *models.User) {
+	if _, err := services.RecordFailure(config.DB, models.ThrottleIP, c.IP()); err != nil {
+		log.Printf("❌ Failed to record failed sign-in from %s: %v", c.IP(), err)
+	}
+
+	lockedUntil, err := services.RecordFailure(config.DB, models.ThrottleAccount, throttleAccountKey(email))
+	if err != nil {
+		log.Printf("❌ Failed to record failed sign-in for %s: %v", email, err)
+		return
+	}
+	if lockedUntil == nil || user == nil {
+		return
+	}
+
+	log.Printf("🔒 Sign-in for user %d locked until %s after failed attempts, last from %s", user.ID, lockedUntil.Format("15:04:05"), c.IP())
+	if user.Email == "" {
+		if err := services.SendAccountLockedSMS(user.Phone, user.Locale, *lockedUntil); err != nil {
+			log.Printf("❌ Failed to text lockout notice to user %d: %v", user.ID, err)
+		}
+		return
+	}
+	if err := services.NewEmailService().Queue(config.DB).InLocale(user.Locale).
+		SendAccountLockedEmail(user.Email, user.Name, *lockedUntil, c.IP()); err != nil {
+		log.Printf("❌ Failed to queue lockout email for user %d: %v", user.ID, err)
+	}
+}
+
+// throttledResponse refuses an attempt that has to wait, saying for how long
+func throttledResponse(c *fiber.Ctx, status services.ThrottleStatus) error {
+	seconds := int(math.Ceil(status.RetryAfter.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+
+	if status.Locked {
+		return c.Status(429).JSON(fiber.Map{
+			"error":       fmt.Sprintf("Too many failed attempts. Try again in %d minutes or reset your password", int(math.Ceil(float64(seconds)/60))),
+			"locked":      true,
+			"retry_after": seconds,
+		})
+	}
+	return c.Status(429).JSON(fiber.Map{
+		"error":       fmt.Sprintf("Too many failed attempts. Try again in %d seconds", seconds),
+		"retry_after": seconds,
+	})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginLockout(t *testing.T) {
+	db := setupTestDB(t)
+	user := createTestUser(t, db, "buyer@example.com", models.RoleBuyer)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	db.Model(&user).Update("password", string(hash))
+
+	app := fiber.New()
+	app.Post("/login", Login)
+
+	// clearDelays skips the waits between attempts, leaving lockouts in place
+	clearDelays := func() {
+		db.Model(&models.AuthThrottle{}).Where("1 = 1").Update("retry_at", nil)
+	}
+
+	steps := []struct {
+		name       string
+		email      string
+		password   string
+		repeat     int
+		wantStatus int
+		wantLocked bool
+	}{
+		{name: "wrong passwords within the free attempts", email: user.Email, password: "guess", repeat: 3, wantStatus: 401},
+		{name: "right password resets the count", email: user.Email, password: "correct horse", repeat: 1, wantStatus: 200},
+		{name: "wrong passwords up to the lockout", email: user.Email, password: "guess", repeat: 10, wantStatus: 401},
+		{name: "right password while locked out", email: user.Email, password: "correct horse", repeat: 1, wantStatus: 429, wantLocked: true},
+		{name: "email typed differently is the same account", email: " BUYER@example.com", password: "correct horse", repeat: 1, wantStatus: 429, wantLocked: true},
+	}
+	for _, step := range steps {
+		var res testResponse
+		for i := 0; i < step.repeat; i++ {
+			clearDelays()
+			res = doJSON(t, app, "POST", "/login", "", fiber.Map{"email": step.email, "password": step.password})
+		}
+		if res.Status != step.wantStatus || (res.Body["locked"] == true) != step.wantLocked {
+			t.Errorf("%s: got %d %v", step.name, res.Status, res.Body)
+		}
+	}
+
+	var emails int64
+	db.Model(&models.EmailOutbox{}).Where(&models.EmailOutbox{To: user.Email}).Count(&emails)
+	if emails != 1 {
+		t.Errorf("got %d lockout emails, want 1", emails)
+	}
+
+	// Attempts beyond the free ones wait, and the wait is refused without a guess
+	db.Where("1 = 1").Delete(&models.AuthThrottle{})
+	for i := 0; i < 4; i++ {
+		doJSON(t, app, "POST", "/login", "", fiber.Map{"email": user.Email, "password": "guess"})
+	}
+	res := doJSON(t, app, "POST", "/login", "", fiber.Map{"email": user.Email, "password": "correct horse"})
+	if res.Status != 429 || res.Body["locked"] == true || res.Body["retry_after"] == nil {
+		t.Errorf("attempt inside the delay: got %d %v", res.Status, res.Body)
+	}
+}
+
+func TestPhoneOnlyAccountsThrottledApart(t *testing.T) {
+	db := setupTestDB(t)
+	useCapturedSMS(t)
+	sealed, err := services.SealSecret("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	var users []models.User
+	for _, phone := range []string{"+251911000001", "+251911000002"} {
+		user := models.User{Name: "Phone buyer", Role: models.RoleBuyer, Phone: phone, PhoneVerifiedAt: &now,
+			TwoFactorMethod: models.TwoFactorTOTP, TwoFactorEnabledAt: &now, TOTPSecret: sealed}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	guesser, neighbour := users[0], users[1]
+
+	app := fiber.New()
+	app.Post("/login", func(c *fiber.Ctx) error { return startLoginChallenge(c, guesser) })
+	app.Post("/login/2fa", VerifyLoginChallenge)
+
+	var res testResponse
+	for i := 0; i < 20 && res.Body["locked"] != true; i++ {
+		db.Model(&models.AuthThrottle{}).Where("1 = 1").Update("retry_at", nil)
+		start := doJSON(t, app, "POST", "/login", "", nil)
+		res = doJSON(t, app, "POST", "/login/2fa", "", fiber.Map{"challenge_token": start.Body["challenge_token"], "code": "000000"})
+	}
+	if res.Body["locked"] != true {
+		t.Fatalf("never locked out: %d %v", res.Status, res.Body)
+	}
+
+	if status := services.CheckThrottle(db, models.ThrottleAccount, userThrottleKey(neighbour)); !status.Allowed() {
+		t.Error("another phone-only account was throttled too")
+	}
+	texts := services.CapturedSMS.Messages()
+	if len(texts) != 1 || texts[0].To != guesser.Phone || !strings.Contains(texts[0].Body, "locked") {
+		t.Errorf("expected one lockout text to %s, got %+v", guesser.Phone, texts)
+	}
+	var emails int64
+	db.Model(&models.EmailOutbox{}).Count(&emails)
+	if emails != 0 {
+		t.Errorf("queued %d lockout emails for an account without an email address", emails)
+	}
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// oidcTimeout bounds each round trip to a provider
+const oidcTimeout = 15 * time.Second
+
+// oidcStateCookie holds the state of the sign-in the browser started, so a callback
+// only completes in the browser that went to the provider
+const oidcStateCookie = "oidc_state"
+
+// OIDCCallbackInput is what the provider sent back to the frontend's redirect page
+type OIDCCallbackInput struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+// OIDCSignupInput finishes a first social login by picking a role. When the provider
+// didn't vouch for the email, the code emailed to it is needed too.
+type OIDCSignupInput struct {
+	SignupToken string `json:"signup_token" validate:"required"`
+	Role        string `json:"role" validate:"required,oneof=buyer seller"`
+	ShopName    string `json:"shopName" validate:"required_if=Role seller,max=100"`
+	Address     string `json:"address" validate:"max=255"`
+	Locale      string `json:"locale" validate:"omitempty,oneof=en am om"` // Defaults to the Accept-Language header
+	Code        string `json:"code" validate:"omitempty,numeric,len=6"`
+}
+
+// GetOIDCProviders lists the providers the login page can offer
+func GetOIDCProviders(c *fiber.Ctx) error {
+	providers := services.OIDCProviders()
+	if providers == nil {
+		providers = []services.OIDCProvider{}
+	}
+	return c.JSON(fiber.Map{"providers": providers})
+}
+
+// StartOIDCLogin returns the provider URL to send the user to for signing in
+func StartOIDCLogin(c *fiber.Ctx) error {
+	return startOIDC(c, 0)
+}
+
+// StartOIDCLink returns the provider URL for linking it to the signed-in user's account
+func StartOIDCLink(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	return startOIDC(c, user.ID)
+}
+
+// startOIDC records a sign-in at the provider in :provider and returns where to send the user
+func startOIDC(c *fiber.Ctx, userID uint) error {
+	provider, ok := services.FindOIDCProvider(c.Params("provider"))
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Unknown sign-in provider"})
+	}
+
+	state, stateHash, err := services.NewSecureToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not start sign-in"})
+	}
+	nonce, _, err := services.NewSecureToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not start sign-in"})
+	}
+	login := models.OAuthLogin{
+		StateHash:    stateHash,
+		Provider:     provider.ID,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		UserID:       userID,
+		IP:           c.IP(),
+		ExpiresAt:    time.Now().Add(models.OAuthLoginTTL),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcTimeout)
+	defer cancel()
+	authURL, err := provider.AuthCodeURL(ctx, state, login.Nonce, login.CodeVerifier)
+	if err != nil {
+		log.Printf("❌ Failed to start %s sign-in: %v", provider.ID, err)
+		return c.Status(502).JSON(fiber.Map{"error": provider.Name + " sign-in is unavailable right now"})
+	}
+	if err := config.DB.Create(&login).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not start sign-in"})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Expires:  login.ExpiresAt,
+		HTTPOnly: true,
+		Secure:   false, // true in production
+		SameSite: "Lax",
+		Path:     "/api/auth/oidc",
+	})
+	return c.JSON(fiber.Map{"authorization_url": authURL, "expires_at": login.ExpiresAt})
+}
+
+// OIDCCallback finishes a sign-in at a provider. Known identities, and users whose
+// verified email matches an account, are signed in the same way a password login is;
+// first-time users get a signup token to pick their role with. Only the browser that
+// started the sign-in can finish it.
+func OIDCCallback(c *fiber.Ctx) error {
+	var input OIDCCallbackInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	// A callback from a sign-in this browser didn't start could sign the user in to
+	// someone else's account
+	cookieState := c.Cookies(oidcStateCookie)
+	clearOIDCStateCookie(c)
+	if subtle.ConstantTimeCompare([]byte(cookieState), []byte(input.State)) != 1 {
+		return c.Status(401).JSON(fiber.Map{"error": "Sign-in expired, please try again"})
+	}
+
+	login, err := claimOAuthLogin(input.State)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Sign-in expired, please try again"})
+	}
+	if login.UserID != 0 {
+		// Linking attaches the identity to login.UserID, so it has to be them finishing it
+		if userID, ok := middleware.SessionUserID(c); !ok || userID != login.UserID {
+			return c.Status(403).JSON(fiber.Map{"error": "Sign in to the account you're linking before finishing"})
+		}
+	}
+	provider, ok := services.FindOIDCProvider(login.Provider)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Unknown sign-in provider"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oidcTimeout)
+	defer cancel()
+	claims, err := provider.Exchange(ctx, input.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("⚠️ %s sign-in failed: %v", provider.ID, err)
+		return c.Status(401).JSON(fiber.Map{"error": "Could not sign in with " + provider.Name})
+	}
+
+	if login.UserID != 0 {
+		return linkOIDCIdentity(c, login.UserID, provider, claims)
+	}
+
+	var identity models.OAuthIdentity
+	if err := config.DB.Where("provider = ? AND subject = ?", provider.ID, claims.Subject).First(&identity).Error; err == nil {
+		var user models.User
+		if err := config.DB.Where("id = ?", identity.UserID).First(&user).Error; err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "This account no longer exists"})
+		}
+		now := time.Now()
+		config.DB.Model(&identity).Updates(map[string]interface{}{"email": claims.Email, "last_login_at": now})
+		return oidcLogin(c, user)
+	}
+
+	if claims.Email == "" {
+		return c.Status(400).JSON(fiber.Map{"error": provider.Name + " didn't share an email address. Allow access to your email and try again"})
+	}
+
+	var existing models.User
+	if err := config.DB.Where("LOWER(email) = ?", claims.Email).First(&existing).Error; err == nil {
+		// Only an email the provider vouches for proves it's the same person, and an
+		// account with a password may have been registered by someone else before the
+		// owner ever signed in, so its password holder has to link the provider instead
+		if !claims.EmailVerified || existing.Password != "" {
+			return c.Status(409).JSON(fiber.Map{
+				"error": "An account with this email already exists. Log in with your password, then link " + provider.Name + " from your account",
+			})
+		}
+		now := time.Now()
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&models.OAuthIdentity{
+				UserID:      existing.ID,
+				Provider:    provider.ID,
+				Subject:     claims.Subject,
+				Email:       claims.Email,
+				LastLoginAt: &now,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.User{}).Where("id = ?", existing.ID).Update("email_verified", true).Error
+		})
+		if err != nil {
+			log.Printf("❌ Failed to link %s to user %d: %v", provider.ID, existing.ID, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Could not sign in"})
+		}
+		existing.EmailVerified = true
+		log.Printf("🔗 Linked %s to user %d by verified email", provider.ID, existing.ID)
+		return oidcLogin(c, existing)
+	}
+
+	token, tokenHash, err := services.NewSecureToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not sign in"})
+	}
+	signup := models.OAuthSignup{
+		TokenHash:     tokenHash,
+		Provider:      provider.ID,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		ExpiresAt:     time.Now().Add(models.OAuthSignupTTL),
+	}
+	if err := config.DB.Create(&signup).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not sign in"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":         "Choose whether you're joining to buy or to sell",
+		"signup_required": true,
+		"signup_token":    token,
+		"email":           signup.Email,
+		"email_verified":  signup.EmailVerified,
+		"name":            signup.Name,
+		"roles":           []string{models.RoleBuyer, models.RoleSeller},
+		"expires_at":      signup.ExpiresAt,
+	})
+}
+
+// CompleteOIDCSignup creates the account for a first social login with the role the
+// user picked and signs them in. Emails the provider didn't vouch for get a code first.
+func CompleteOIDCSignup(c *fiber.Ctx) error {
+	var input OIDCSignupInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var signup models.OAuthSignup
+	if err := config.DB.Where("token_hash = ?", services.HashToken(input.SignupToken)).First(&signup).Error; err != nil || !signup.Usable() {
+		return c.Status(401).JSON(fiber.Map{"error": "Sign-up expired, please sign in again"})
+	}
+
+	var count int64
+	config.DB.Unscoped().Model(&models.User{}).Where("LOWER(email) = ?", signup.Email).Count(&count)
+	if count > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "An account with this email already exists. Log in instead"})
+	}
+
+	locale := input.Locale
+	if locale == "" {
+		locale = c.Get("Accept-Language")
+	}
+	locale = services.NormalizeLocale(locale)
+
+	var code *models.OneTimeCode
+	if !signup.EmailVerified {
+		if input.Code == "" {
+			if err := sendOneTimeCode(models.CodeSignupEmail, signup.Email, 0, locale, signup.Name, c.IP()); err != nil {
+				return oneTimeCodeFailed(c, err)
+			}
+			return c.Status(202).JSON(fiber.Map{
+				"message":               "We've emailed a 6-digit code to " + signup.Email + ". Send it with your sign-up to finish",
+				"verification_required": true,
+				"expires_in":            int(models.OneTimeCodeTTL.Seconds()),
+			})
+		}
+		var ok bool
+		if code, ok = checkOneTimeCode(models.CodeSignupEmail, signup.Email, 0, input.Code); !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired code"})
+		}
+	}
+
+	name := signup.Name
+	if name == "" {
+		name = strings.SplitN(signup.Email, "@", 2)[0]
+	}
+	user := models.User{
+		Name:          name,
+		Email:         signup.Email,
+		Address:       input.Address,
+		Role:          input.Role,
+		Locale:        locale,
+		EmailVerified: true,
+	}
+	if input.Role == models.RoleSeller {
+		user.ShopName = strings.TrimSpace(input.ShopName)
+	}
+
+	now := time.Now()
+	// Another shop can take the slug before this commits; the retry picks the next one
+	err := models.RetryShopSlugConflicts(func() error {
+		user.ID, user.ShopSlug = 0, "" // The save hook derives the slug again
+		return config.DB.Transaction(func(tx *gorm.DB) error {
+			// Claiming the signup in the same statement that checks it makes it single-use
+			result := tx.Model(&models.OAuthSignup{}).
+				Where("id = ? AND completed_at IS NULL", signup.ID).
+				Update("completed_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			if code != nil {
+				if err := claimOneTimeCode(tx, code.ID); err != nil {
+					return err
+				}
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&models.OAuthIdentity{
+				UserID:      user.ID,
+				Provider:    signup.Provider,
+				Subject:     signup.Subject,
+				Email:       signup.Email,
+				LastLoginAt: &now,
+			}).Error; err != nil {
+				return err
+			}
+			// The email is proven now, so an unverified registration for it is void
+			if err := tx.Unscoped().Where("LOWER(email) = ?", signup.Email).Delete(&models.PendingRegistration{}).Error; err != nil {
+				return err
+			}
+			if user.Role == models.RoleSeller {
+				if err := createSellerApplication(tx, user.Email); err != nil {
+					return err
+				}
+			}
+			return services.NewEmailService().Queue(tx).InLocale(user.Locale).SendWelcomeEmail(user.Email, user.Name)
+		})
+	})
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(401).JSON(fiber.Map{"error": "Sign-up expired, please sign in again"})
+	}
+	if err != nil {
+		log.Printf("❌ Failed to create account from %s sign-in: %v", signup.Provider, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create account"})
+	}
+
+	log.Printf("✅ User %d signed up with %s as %s", user.ID, signup.Provider, user.Role)
+	return completeLogin(c, user)
+}
+
+// GetOIDCIdentities lists the providers linked to the signed-in user's account
+func GetOIDCIdentities(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var identities []models.OAuthIdentity
+	if err := config.DB.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&identities).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load linked accounts"})
+	}
+	return c.JSON(fiber.Map{"identities": identities})
+}
+
+// UnlinkOIDCIdentity removes a provider from the signed-in user's account, as long as
+// they can still sign in some other way
+func UnlinkOIDCIdentity(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var identity models.OAuthIdentity
+	if err := config.DB.Where("user_id = ? AND provider = ?", user.ID, c.Params("provider")).First(&identity).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "This provider isn't linked to your account"})
+	}
+
+	var others int64
+	config.DB.Model(&models.OAuthIdentity{}).Where("user_id = ? AND id <> ?", user.ID, identity.ID).Count(&others)
+	if user.Password == "" && user.Phone == "" && others == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Set a password or add a phone number before unlinking your only way to sign in"})
+	}
+
+	if err := config.DB.Unscoped().Delete(&identity).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to unlink account"})
+	}
+	return c.JSON(fiber.Map{"message": "Account unlinked", "provider": identity.Provider})
+}
+
+// linkOIDCIdentity attaches the provider account to the user who started linking it
+func linkOIDCIdentity(c *fiber.Ctx, userID uint, provider services.OIDCProvider, claims *services.OIDCClaims) error {
+	var existing models.OAuthIdentity
+	if err := config.DB.Where("provider = ? AND subject = ?", provider.ID, claims.Subject).First(&existing).Error; err == nil {
+		if existing.UserID == userID {
+			return c.JSON(fiber.Map{"message": provider.Name + " is already linked to your account", "provider": provider.ID})
+		}
+		return c.Status(409).JSON(fiber.Map{"error": "This " + provider.Name + " account is linked to another eGebeya account"})
+	}
+
+	var count int64
+	config.DB.Model(&models.OAuthIdentity{}).Where("user_id = ? AND provider = ?", userID, provider.ID).Count(&count)
+	if count > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Another " + provider.Name + " account is already linked. Unlink it first"})
+	}
+
+	if err := config.DB.Create(&models.OAuthIdentity{
+		UserID:   userID,
+		Provider: provider.ID,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}).Error; err != nil {
+		log.Printf("❌ Failed to link %s to user %d: %v", provider.ID, userID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to link account"})
+	}
+
+	log.Printf("🔗 User %d linked %s", userID, provider.ID)
+	return c.JSON(fiber.Map{"message": provider.Name + " linked to your account", "provider": provider.ID})
+}
+
+// oidcLogin signs in a user the provider identified. The provider stands in for the
+// password, so accounts with 2FA still get their second-factor challenge.
+func oidcLogin(c *fiber.Ctx, user models.User) error {
+	if user.Suspended() {
+		return c.Status(403).JSON(fiber.Map{"error": "Your account has been suspended", "suspended": true})
+	}
+	if user.RequiresTwoFactor() {
+		return startLoginChallenge(c, user)
+	}
+	return completeLogin(c, user)
+}
+
+// clearOIDCStateCookie removes the sign-in state cookie once a callback has used it
+func clearOIDCStateCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Expires:  time.Now().Add(-1 * time.Hour), // Set to past time to delete
+		HTTPOnly: true,
+		Secure:   false, // true in production
+		SameSite: "Lax",
+		Path:     "/api/auth/oidc",
+	})
+}
+
+// claimOAuthLogin finds the unexpired sign-in for the state and marks it used, so a
+// callback can't be replayed
+func claimOAuthLogin(state string) (*models.OAuthLogin, error) {
+	var login models.OAuthLogin
+	if err := config.DB.Where("state_hash = ? AND completed_at IS NULL AND expires_at > ?", services.HashToken(state), time.Now()).
+		First(&login).Error; err != nil {
+		return nil, err
+	}
+
+	result := config.DB.Model(&models.OAuthLogin{}).
+		Where("id = ? AND completed_at IS NULL", login.ID).
+		Update("completed_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("sign-in already completed")
+	}
+	return &login, nil
+}
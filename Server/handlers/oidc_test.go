@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+	"github.com/gofiber/fiber/v2"
+)
+
+const mockIssuerClientID = "egebeya-test"
+
+// mockIssuer is an OpenID Connect provider serving discovery, JWKS and a token endpoint
+// that checks the PKCE verifier. Codes are handed out with authorize instead of a login page.
+type mockIssuer struct {
+	*httptest.Server
+	signer jose.Signer
+
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+	count int
+}
+
+// mockAuthorization is what the issuer puts in the ID token for a code
+type mockAuthorization struct {
+	nonce     string
+	challenge string
+	claims    map[string]interface{}
+}
+
+// newMockIssuer starts an issuer and configures it as the "oidc" provider
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: "test"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &mockIssuer{signer: signer, codes: map[string]mockAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer.URL,
+			"authorization_endpoint":                issuer.URL + "/authorize",
+			"token_endpoint":                        issuer.URL + "/token",
+			"jwks_uri":                              issuer.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", issuer.token)
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+
+	t.Setenv("OIDC_ISSUER_URL", issuer.URL)
+	t.Setenv("OIDC_CLIENT_ID", mockIssuerClientID)
+	t.Setenv("OIDC_CLIENT_SECRET", "secret")
+	t.Setenv("OIDC_PROVIDER_NAME", "Mock SSO")
+	t.Setenv("GOOGLE_CLIENT_ID", "")
+	return issuer
+}
+
+// authorize signs the user in at the issuer as the authorization URL asked, returning
+// the code and state the redirect page would receive
+func (m *mockIssuer) authorize(t *testing.T, authURL string, claims map[string]interface{}) (code, state string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != mockIssuerClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.count++
+	code = fmt.Sprintf("code-%d", m.count)
+	m.codes[code] = mockAuthorization{nonce: query.Get("nonce"), challenge: query.Get("code_challenge"), claims: claims}
+	return code, query.Get("state")
+}
+
+// token redeems a code once, for the PKCE verifier it was issued for
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.mu.Lock()
+	authorization, ok := m.codes[r.Form.Get("code")]
+	delete(m.codes, r.Form.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   m.URL,
+		"aud":   mockIssuerClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": authorization.nonce,
+	}
+	for k, v := range authorization.claims {
+		claims[k] = v
+	}
+	idToken, err := jwt.Signed(m.signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// oidcAttempt is a sign-in started against the app, ready to be finished at the callback
+type oidcAttempt struct {
+	code, state string
+	cookie      string // The oidc_state cookie the browser holds
+}
+
+func TestOIDCCallback(t *testing.T) {
+	db := setupTestDB(t)
+	issuer := newMockIssuer(t)
+	existing := createTestUser(t, db, "almaz@example.com", models.RoleBuyer) // Signed up by phone, no password
+	withPassword := createTestUser(t, db, "hana@example.com", models.RoleBuyer)
+	db.Model(&withPassword).Update("password", "$2a$10$hash")
+	linker := createTestUser(t, db, "linker@example.com", models.RoleBuyer)
+	other := createTestUser(t, db, "other@example.com", models.RoleBuyer)
+	linkerToken, otherToken := accessToken(t, db, linker), accessToken(t, db, other)
+
+	app := fiber.New()
+	app.Post("/auth/oidc/callback", OIDCCallback)
+	app.Post("/auth/oidc/:provider", StartOIDCLogin)
+	app.Post("/me/oidc/:provider", middleware.RequireAuth, StartOIDCLink)
+
+	start := func(t *testing.T, token string, claims map[string]interface{}) oidcAttempt {
+		t.Helper()
+		path := "/auth/oidc/oidc"
+		if token != "" {
+			path = "/me/oidc/oidc"
+		}
+		res := doJSON(t, app, "POST", path, token, nil)
+		if res.Status != 200 {
+			t.Fatalf("start sign-in: %d %v", res.Status, res.Body)
+		}
+		code, state := issuer.authorize(t, res.Body["authorization_url"].(string), claims)
+		return oidcAttempt{code: code, state: state, cookie: res.Cookies[oidcStateCookie]}
+	}
+	finish := func(t *testing.T, attempt oidcAttempt, token string) testResponse {
+		t.Helper()
+		headers := []string{}
+		if attempt.cookie != "" {
+			headers = append(headers, "Cookie", oidcStateCookie+"="+attempt.cookie)
+		}
+		return doJSON(t, app, "POST", "/auth/oidc/callback", token, fiber.Map{"code": attempt.code, "state": attempt.state}, headers...)
+	}
+
+	tests := []struct {
+		name        string
+		startToken  string // Signed-in user linking the provider
+		finishToken string // Session sent with the callback
+		claims      map[string]interface{}
+		tamper      func(t *testing.T, attempt *oidcAttempt)
+		want        int
+		check       func(t *testing.T, res testResponse)
+	}{
+		{
+			name:   "first login asks for a role",
+			claims: map[string]interface{}{"sub": "new-user", "email": "New@Example.com", "email_verified": true, "name": "Selam"},
+			want:   200,
+			check: func(t *testing.T, res testResponse) {
+				if res.Body["signup_required"] != true || res.Body["email"] != "new@example.com" || res.Body["signup_token"] == nil {
+					t.Errorf("expected a signup token, got %v", res.Body)
+				}
+			},
+		},
+		{
+			name:   "verified email signs in to the existing account",
+			claims: map[string]interface{}{"sub": "almaz", "email": existing.Email, "email_verified": "true"},
+			want:   200,
+			check: func(t *testing.T, res testResponse) {
+				if res.Body["token"] == nil {
+					t.Errorf("expected a session, got %v", res.Body)
+				}
+				var identity models.OAuthIdentity
+				if err := db.Where("provider = ? AND subject = ?", "oidc", "almaz").First(&identity).Error; err != nil || identity.UserID != existing.ID {
+					t.Errorf("identity not linked to user %d: %+v, %v", existing.ID, identity, err)
+				}
+			},
+		},
+		{
+			name:   "verified email of an account with a password",
+			claims: map[string]interface{}{"sub": "hana", "email": withPassword.Email, "email_verified": true},
+			want:   409,
+			check: func(t *testing.T, res testResponse) {
+				var identities int64
+				db.Model(&models.OAuthIdentity{}).Where("subject = ?", "hana").Count(&identities)
+				if res.Body["token"] != nil || identities != 0 {
+					t.Errorf("signed in to an account with a password: %v", res.Body)
+				}
+			},
+		},
+		{
+			name:   "known subject signs in whatever its email",
+			claims: map[string]interface{}{"sub": "almaz", "email": "changed@example.com"},
+			want:   200,
+			check: func(t *testing.T, res testResponse) {
+				if user, _ := res.Body["user"].(map[string]interface{}); user == nil || user["email"] != existing.Email {
+					t.Errorf("expected to sign in as %s, got %v", existing.Email, res.Body)
+				}
+			},
+		},
+		{
+			name:   "unverified email of an existing account",
+			claims: map[string]interface{}{"sub": "impostor", "email": other.Email, "email_verified": false},
+			want:   409,
+		},
+		{
+			name:        "linking from the same account",
+			startToken:  linkerToken,
+			finishToken: linkerToken,
+			claims:      map[string]interface{}{"sub": "linker", "email": "someone-else@example.com"},
+			want:        200,
+			check: func(t *testing.T, res testResponse) {
+				var identity models.OAuthIdentity
+				if err := db.Where("provider = ? AND subject = ?", "oidc", "linker").First(&identity).Error; err != nil || identity.UserID != linker.ID {
+					t.Errorf("identity not linked to user %d: %+v, %v", linker.ID, identity, err)
+				}
+			},
+		},
+		{
+			name:        "linking finished by another account",
+			startToken:  linkerToken,
+			finishToken: otherToken,
+			claims:      map[string]interface{}{"sub": "victim"},
+			want:        403,
+		},
+		{
+			name:       "linking finished without a session",
+			startToken: linkerToken,
+			claims:     map[string]interface{}{"sub": "victim"},
+			want:       403,
+		},
+		{
+			name:   "callback without the state cookie",
+			claims: map[string]interface{}{"sub": "csrf", "email": "csrf@example.com", "email_verified": true},
+			tamper: func(t *testing.T, attempt *oidcAttempt) { attempt.cookie = "" },
+			want:   401,
+		},
+		{
+			name:   "state cookie from another sign-in",
+			claims: map[string]interface{}{"sub": "csrf", "email": "csrf@example.com", "email_verified": true},
+			tamper: func(t *testing.T, attempt *oidcAttempt) {
+				attempt.cookie = start(t, "", nil).cookie
+			},
+			want: 401,
+		},
+		{
+			name:   "unknown state",
+			claims: map[string]interface{}{"sub": "csrf"},
+			tamper: func(t *testing.T, attempt *oidcAttempt) {
+				attempt.state, attempt.cookie = "not-a-state", "not-a-state"
+			},
+			want: 401,
+		},
+		{
+			name:   "ID token with the wrong nonce",
+			claims: map[string]interface{}{"sub": "replayed", "nonce": "nonce-from-another-sign-in"},
+			want:   401,
+		},
+		{
+			name:   "state used twice",
+			claims: map[string]interface{}{"sub": "twice", "email": "twice@example.com", "email_verified": true},
+			tamper: func(t *testing.T, attempt *oidcAttempt) {
+				if res := finish(t, *attempt, ""); res.Status != 200 {
+					t.Fatalf("first callback: %d %v", res.Status, res.Body)
+				}
+			},
+			want: 401,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempt := start(t, tt.startToken, tt.claims)
+			if tt.tamper != nil {
+				tt.tamper(t, &attempt)
+			}
+			res := finish(t, attempt, tt.finishToken)
+			if res.Status != tt.want {
+				t.Fatalf("got %d, want %d (%v)", res.Status, tt.want, res.Body)
+			}
+			if tt.check != nil {
+				tt.check(t, res)
+			}
+		})
+	}
+
+	var victims int64
+	db.Model(&models.OAuthIdentity{}).Where("subject = ?", "victim").Count(&victims)
+	if victims != 0 {
+		t.Errorf("identity linked from another session")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
 	"injera-gebeya-platform/Server/models"
 
 	"github.com/gofiber/fiber/v2"
@@ -13,18 +14,16 @@ import (
 
 // CreateOrderRequest represents the request for creating an order
 type CreateOrderRequest struct {
-	ShippingAddress string `json:"shipping_address" validate:"required"`
-	ShippingCity    string `json:"shipping_city" validate:"required"`
-	ShippingState   string `json:"shipping_state" validate:"required"`
-	ShippingZip     string `json:"shipping_zip"`
-	ShippingPhone   string `json:"shipping_phone" validate:"required"`
-	Notes           string `json:"notes"`
-	PaymentMethod   string `json:"payment_method" validate:"required,oneof=chapa stripe"`
-	PaymentID       string `json:"payment_id"` // External payment ID
-	Items           []struct {
-		ProductID uint `json:"product_id" validate:"required"`
-		Quantity  int  `json:"quantity" validate:"required,min=1"`
-	} `json:"items" validate:"required,min=1"`
+	ShippingAddress string           `json:"shipping_address" validate:"required"`
+	ShippingCity    string           `json:"shipping_city" validate:"required"`
+	ShippingState   string           `json:"shipping_state" validate:"required"`
+	ShippingZip     string           `json:"shipping_zip"`
+	ShippingPhone   string           `json:"shipping_phone" validate:"required"`
+	Notes           string           `json:"notes"`
+	PaymentMethod   string           `json:"payment_method" validate:"required,oneof=chapa stripe"`
+	PaymentID       string           `json:"payment_id"` // External payment ID
+	CouponCode      string           `json:"coupon_code"`
+	Items           []OrderItemInput `json:"items" validate:"required,min=1,dive"`
 }
 
 // CreateOrder creates a new order
@@ -37,69 +36,25 @@ func CreateOrder(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get user from context (set by auth middleware)
-	user := c.Locals("user").(models.User)
-
-	// Check if user is a buyer (only buyers can create orders)
-	if user.Role != "buyer" {
-		return c.Status(403).JSON(fiber.Map{
-			"error": "Only buyers can create orders. Sellers cannot place orders.",
-		})
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
 	}
 
-	// Validate that all products exist and have sufficient stock
-	var products []models.Product
-	var productIDs []uint
-	for _, item := range req.Items {
-		productIDs = append(productIDs, item.ProductID)
-	}
+	// Get user from context (set by auth middleware)
+	user := c.Locals("user").(models.User)
 
-	if err := config.DB.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+	// Validate products and stock, then price the order (including discounts)
+	quote, err := buildOrderQuote(config.DB, user, req.Items, req.CouponCode,
+		shippingDestination{City: req.ShippingCity, State: req.ShippingState})
+	if err != nil {
+		if _, ok := err.(*quoteError); ok {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to fetch products",
 		})
 	}
 
-	// Create a map for quick product lookup
-	productMap := make(map[uint]models.Product)
-	for _, product := range products {
-		productMap[product.ID] = product
-	}
-
-	// Validate stock and calculate totals
-	var subtotal float64
-	var orderItems []models.OrderItem
-
-	for _, item := range req.Items {
-		product, exists := productMap[item.ProductID]
-		if !exists {
-			return c.Status(400).JSON(fiber.Map{
-				"error": fmt.Sprintf("Product with ID %d not found", item.ProductID),
-			})
-		}
-
-		if product.Stock < item.Quantity {
-			return c.Status(400).JSON(fiber.Map{
-				"error": fmt.Sprintf("Insufficient stock for product %s. Available: %d, Requested: %d",
-					product.Name, product.Stock, item.Quantity),
-			})
-		}
-
-		itemTotal := product.Price * float64(item.Quantity)
-		subtotal += itemTotal
-
-		orderItems = append(orderItems, models.OrderItem{
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Price:     product.Price,
-			Total:     itemTotal,
-		})
-	}
-
-	// Calculate shipping fee (free for now)
-	shippingFee := 0.0
-	total := subtotal + shippingFee
-
 	// Create order
 	order := models.Order{
 		UserID:          user.ID,
@@ -114,11 +69,8 @@ func CreateOrder(c *fiber.Ctx) error {
 		ShippingZip:     req.ShippingZip,
 		ShippingPhone:   req.ShippingPhone,
 		Notes:           req.Notes,
-		Subtotal:        subtotal,
-		ShippingFee:     shippingFee,
-		Total:           total,
-		OrderItems:      orderItems,
 	}
+	quote.applyToOrder(&order)
 
 	// Start transaction
 	tx := config.DB.Begin()
@@ -136,8 +88,18 @@ func CreateOrder(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := quote.redeemPromotion(tx, &order); err != nil {
+		tx.Rollback()
+		if _, ok := err.(*quoteError); ok {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to apply promotion",
+		})
+	}
+
 	// Update product stock
-	for _, item := range orderItems {
+	for _, item := range order.OrderItems {
 		if err := tx.Model(&models.Product{}).Where("id = ?", item.ProductID).
 			Update("stock", gorm.Expr("stock - ?", item.Quantity)).Error; err != nil {
 			tx.Rollback()
@@ -147,6 +109,13 @@ func CreateOrder(c *fiber.Ctx) error {
 		}
 	}
 
+	if err := queueOrderPlacedEmails(tx, order.ID); err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to queue order emails",
+		})
+	}
+
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -155,7 +124,7 @@ func CreateOrder(c *fiber.Ctx) error {
 	}
 
 	// Load order with relationships
-	if err := config.DB.Preload("User").Preload("OrderItems.Product").First(&order, order.ID).Error; err != nil {
+	if err := config.DB.Preload("User").Preload("OrderItems.Product", withRemovedProducts).Preload("TaxLines").First(&order, order.ID).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to load order details",
 		})
@@ -174,7 +143,7 @@ func GetUserOrders(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
 	var orders []models.Order
-	if err := config.DB.Preload("OrderItems.Product").
+	if err := config.DB.Preload("OrderItems.Product", withRemovedProducts).Preload("TaxLines").
 		Where("user_id = ?", user.ID).
 		Order("created_at DESC").
 		Find(&orders).Error; err != nil {
@@ -194,7 +163,7 @@ func GetOrder(c *fiber.Ctx) error {
 	orderID := c.Params("id")
 
 	var order models.Order
-	if err := config.DB.Preload("User").Preload("OrderItems.Product").
+	if err := config.DB.Preload("User").Preload("OrderItems.Product", withRemovedProducts).Preload("TaxLines").
 		Where("id = ? AND user_id = ?", orderID, user.ID).
 		First(&order).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{
@@ -217,7 +186,7 @@ func GetOrderByTxRef(c *fiber.Ctx) error {
 	}
 
 	var order models.Order
-	if err := config.DB.Preload("User").Preload("OrderItems.Product").
+	if err := config.DB.Preload("User").Preload("OrderItems.Product", withRemovedProducts).Preload("TaxLines").
 		Where("payment_id = ? AND user_id = ?", txRef, user.ID).
 		First(&order).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Order not found"})
@@ -231,13 +200,6 @@ func UpdateOrderStatus(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 	orderID := c.Params("id")
 
-	// Check if user is a seller
-	if user.Role != "seller" {
-		return c.Status(403).JSON(fiber.Map{
-			"error": "Only sellers can update order status",
-		})
-	}
-
 	var req struct {
 		Status string `json:"status" validate:"required,oneof=pending confirmed processing shipped delivered cancelled"`
 	}
@@ -246,10 +208,13 @@ func UpdateOrderStatus(c *fiber.Ctx) error {
 			"error": "Invalid request body",
 		})
 	}
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
 
 	// SECURITY: Validate that the seller owns products in this order
 	var order models.Order
-	if err := config.DB.Preload("OrderItems.Product").
+	if err := config.DB.Preload("OrderItems.Product", withRemovedProducts).Preload("TaxLines").
 		Joins("JOIN order_items ON orders.id = order_items.order_id").
 		Joins("JOIN products ON order_items.product_id = products.id").
 		Where("orders.id = ? AND products.seller_id = ?", orderID, user.ID).
@@ -268,20 +233,28 @@ func UpdateOrderStatus(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update order status
-	result := config.DB.Model(&order).Where("id = ?", order.ID).
-		Updates(map[string]interface{}{
-			"status":     newStatus,
-			"updated_at": time.Now(),
-		})
+	// Update order status and queue the buyer's email together
+	var rowsAffected int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&order).Where("id = ?", order.ID).
+			Updates(map[string]interface{}{
+				"status":     newStatus,
+				"updated_at": time.Now(),
+			})
+		rowsAffected = result.RowsAffected
+		if result.Error != nil || rowsAffected == 0 {
+			return result.Error
+		}
+		return queueOrderStatusEmail(tx, order, newStatus)
+	})
 
-	if result.Error != nil {
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to update order status",
 		})
 	}
 
-	if result.RowsAffected == 0 {
+	if rowsAffected == 0 {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Order not found",
 		})
@@ -306,16 +279,9 @@ func UpdateOrderStatus(c *fiber.Ctx) error {
 func GetSellerOrders(c *fiber.Ctx) error {
 	user := c.Locals("user").(models.User)
 
-	// Check if user is a seller
-	if user.Role != "seller" {
-		return c.Status(403).JSON(fiber.Map{
-			"error": "Only sellers can view seller orders",
-		})
-	}
-
 	// Get orders that contain products from this seller
 	var orders []models.Order
-	if err := config.DB.Preload("User").Preload("OrderItems.Product").
+	if err := config.DB.Preload("User").Preload("OrderItems.Product", withRemovedProducts).Preload("TaxLines").
 		Joins("JOIN order_items ON orders.id = order_items.order_id").
 		Joins("JOIN products ON order_items.product_id = products.id").
 		Where("products.seller_id = ?", user.ID).
@@ -332,6 +298,30 @@ func GetSellerOrders(c *fiber.Ctx) error {
 	})
 }
 
+// loadSellers returns the sellers of the given products keyed by user ID
+func loadSellers(db *gorm.DB, products []models.Product) (map[uint]models.User, error) {
+	var sellerIDs []uint
+	for _, product := range products {
+		sellerIDs = append(sellerIDs, product.SellerID)
+	}
+
+	var sellers []models.User
+	if err := db.Where("id IN ?", sellerIDs).Find(&sellers).Error; err != nil {
+		return nil, err
+	}
+
+	sellerMap := make(map[uint]models.User)
+	for _, seller := range sellers {
+		sellerMap[seller.ID] = seller
+	}
+	return sellerMap, nil
+}
+
+// withRemovedProducts lets order history resolve products that were deleted before archiving existed
+func withRemovedProducts(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
 // isValidStatusTransition checks if a status transition is valid
 func isValidStatusTransition(current, new models.OrderStatus) bool {
 	validTransitions := map[models.OrderStatus][]models.OrderStatus{
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"log"
+
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"gorm.io/gorm"
+)
+
+// Order emails are written to the outbox through the caller's transaction, so they are
+// only sent if the change that triggered them is committed.
+
+// queueOrderPlacedEmails queues the buyer's confirmation with the invoice attached, and
+// an email to each seller listing the items they need to prepare
+func queueOrderPlacedEmails(tx *gorm.DB, orderID uint) error {
+	order, sellers, err := loadInvoiceOrder(tx, orderID)
+	if err != nil {
+		return err
+	}
+
+	pdf, err := services.GenerateInvoicePDF(*order, sellers)
+	if err != nil {
+		// Still confirm the order; the buyer can download the invoice later
+		log.Printf("❌ Failed to generate invoice for order %s: %v", order.OrderNumber, err)
+	}
+
+	emailService := services.NewEmailService().Queue(tx)
+	if err := emailService.InLocale(order.User.Locale).SendOrderConfirmationEmail(order.User.Email, order.User.Name,
+		order.OrderNumber, order.ID, order.Total, pdf); err != nil {
+		return err
+	}
+
+	sellerItems := make(map[uint][]services.OrderEmailItem)
+	for _, item := range order.OrderItems {
+		sellerItems[item.SellerID] = append(sellerItems[item.SellerID], services.OrderEmailItem{
+			Name:     item.ProductName,
+			Variant:  item.Variant,
+			Quantity: item.Quantity,
+			Total:    item.Total,
+		})
+	}
+	for sellerID, items := range sellerItems {
+		seller, ok := sellers[sellerID]
+		if !ok {
+			continue
+		}
+		if err := emailService.InLocale(seller.Locale).SendNewOrderSellerEmail(seller.Email, seller.Name, seller.ShopName,
+			order.OrderNumber, order.ShippingCity, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueOrderStatusEmail queues the buyer's email for a confirmed, shipped, delivered or cancelled order
+func queueOrderStatusEmail(tx *gorm.DB, order models.Order, status models.OrderStatus) error {
+	var buyer models.User
+	if err := tx.First(&buyer, order.UserID).Error; err != nil {
+		return err
+	}
+	return services.NewEmailService().Queue(tx).InLocale(buyer.Locale).
+		SendOrderStatusEmail(buyer.Email, buyer.Name, order.OrderNumber, order.ID, string(status))
+}
+
+// queuePaymentFailedEmail queues an email telling the buyer a payment attempt did not go through
+func queuePaymentFailedEmail(tx *gorm.DB, userID uint, reference string, amount float64) error {
+	var buyer models.User
+	if err := tx.First(&buyer, userID).Error; err != nil {
+		return err
+	}
+	return services.NewEmailService().Queue(tx).InLocale(buyer.Locale).SendPaymentFailedEmail(buyer.Email, buyer.Name, reference, amount)
+}
+
+// queueRefundIssuedEmail queues an email telling the buyer their order was refunded
+func queueRefundIssuedEmail(tx *gorm.DB, order models.Order, amount float64) error {
+	var buyer models.User
+	if err := tx.First(&buyer, order.UserID).Error; err != nil {
+		return err
+	}
+	return services.NewEmailService().Queue(tx).InLocale(buyer.Locale).
+		SendRefundIssuedEmail(buyer.Email, buyer.Name, order.OrderNumber, order.ID, amount)
+}
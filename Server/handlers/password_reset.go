@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// passwordResetCooldown is the minimum time between reset emails to the same account
+	passwordResetCooldown = time.Minute
+	// maxPasswordResetsPerHour caps reset emails per account, on top of the per-IP rate limit
+	maxPasswordResetsPerHour = 5
+)
+
+// forgotPasswordMessage is returned whether or not the account exists, so the endpoint
+// can't be used to find out which emails are registered
+const forgotPasswordMessage = "If an account exists for that email, we've sent instructions to reset the password."
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest resets with either the token from the emailed link, or the email and code
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Email    string `json:"email" validate:"required_without=Token,omitempty,email"`
+	Code     string `json:"code" validate:"required_without=Token,omitempty,numeric,len=6"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+// ForgotPassword emails a single-use reset code and link to the account's address
+func ForgotPassword(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var user models.User
+	if err := config.DB.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(req.Email))).First(&user).Error; err != nil {
+		return c.JSON(fiber.Map{"message": forgotPasswordMessage})
+	}
+
+	var recent []models.PasswordReset
+	config.DB.Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-time.Hour)).
+		Order("created_at DESC").Find(&recent)
+	if len(recent) >= maxPasswordResetsPerHour ||
+		(len(recent) > 0 && time.Since(recent[0].CreatedAt) < passwordResetCooldown) {
+		log.Printf("⚠️ Password reset for user %d throttled", user.ID)
+		return c.JSON(fiber.Map{"message": forgotPasswordMessage})
+	}
+
+	code, err := generateResetCode()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate reset code"})
+	}
+	token, tokenHash, err := services.NewSecureToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate reset token"})
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the newest reset email works
+		if err := tx.Model(&models.PasswordReset{}).
+			Where("user_id = ? AND used_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+			Update("expires_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.PasswordReset{
+			UserID:    user.ID,
+			TokenHash: tokenHash,
+			CodeHash:  services.HashToken(code),
+			IP:        c.IP(),
+			ExpiresAt: time.Now().Add(models.PasswordResetTTL),
+		}).Error; err != nil {
+			return err
+		}
+		return services.NewEmailService().Queue(tx).InLocale(user.Locale).
+			SendPasswordResetEmail(user.Email, user.Name, code, token, models.PasswordResetTTL)
+	})
+	if err != nil {
+		log.Printf("❌ Failed to create password reset for user %d: %v", user.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to start password reset"})
+	}
+
+	return c.JSON(fiber.Map{"message": forgotPasswordMessage})
+}
+
+// ResetPassword sets a new password using an emailed reset token or code, then signs
+// the user out everywhere and notifies them of the change
+func ResetPassword(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	if status := services.CheckThrottle(config.DB, models.ThrottleIP, c.IP()); !status.Allowed() {
+		return throttledResponse(c, status)
+	}
+
+	reset, ok := findPasswordReset(req)
+	if !ok {
+		services.RecordFailure(config.DB, models.ThrottleIP, c.IP())
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired reset code"})
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), 12)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not hash password"})
+	}
+
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		// Claiming the reset in the same statement that checks it makes it single-use
+		result := tx.Model(&models.PasswordReset{}).
+			Where("id = ? AND used_at IS NULL AND expires_at > ?", reset.ID, now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		var user models.User
+		if err := tx.Where("id = ?", reset.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("password", string(hashed)).Error; err != nil {
+			return err
+		}
+		if _, err := services.RevokeAllSessions(tx, user.ID); err != nil {
+			return err
+		}
+		// A new password ends any lockout from guesses at the old one
+		if err := resetAccountThrottle(tx, user); err != nil {
+			return err
+		}
+		return services.NewEmailService().Queue(tx).InLocale(user.Locale).
+			SendPasswordChangedEmail(user.Email, user.Name, now)
+	})
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired reset code"})
+	}
+	if err != nil {
+		log.Printf("❌ Failed to reset password for user %d: %v", reset.UserID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reset password"})
+	}
+
+	middleware.ClearSessionCookies(c)
+	return c.JSON(fiber.Map{"message": "Your password has been reset. Please log in with your new password."})
+}
+
+// findPasswordReset looks up the usable reset matching the request's token, or its email
+// and code. Wrong codes count against the reset so it can't be brute-forced.
+func findPasswordReset(req ResetPasswordRequest) (*models.PasswordReset, bool) {
+	var reset models.PasswordReset
+	if req.Token != "" {
+		if err := config.DB.Where("token_hash = ?", services.HashToken(req.Token)).First(&reset).Error; err != nil {
+			return nil, false
+		}
+		return &reset, reset.Usable()
+	}
+
+	var user models.User
+	if err := config.DB.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(req.Email))).First(&user).Error; err != nil {
+		return nil, false
+	}
+	if err := config.DB.Where("user_id = ? AND used_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Order("created_at DESC").First(&reset).Error; err != nil {
+		return nil, false
+	}
+	if !reset.Usable() {
+		return nil, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(services.HashToken(req.Code)), []byte(reset.CodeHash)) != 1 {
+		config.DB.Model(&reset).Update("attempts", gorm.Expr("attempts + 1"))
+		return nil, false
+	}
+	return &reset, true
+}
+
+// generateResetCode returns a random 6-digit code
+func generateResetCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(900000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()+100000), nil
+}
@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// oneTimeCodeCooldown is the minimum time between codes to the same phone or email
+	oneTimeCodeCooldown = time.Minute
+	// maxOneTimeCodesPerHour caps codes per phone or email, since every SMS costs money
+	maxOneTimeCodesPerHour = 5
+)
+
+// phoneLoginCodeMessage is returned whether or not the number is registered, so the
+// endpoint can't be used to find out which numbers have accounts
+const phoneLoginCodeMessage = "If an account uses this phone number, we've texted it a sign-in code."
+
+var (
+	errOneTimeCodeCooldown = errors.New("a code was sent to this destination too recently")
+	errIdentityTaken       = errors.New("phone number or email already belongs to another account")
+)
+
+// PhoneInput is a phone number to text a code to
+type PhoneInput struct {
+	Phone string `json:"phone" validate:"required,et_phone"`
+}
+
+// PhoneCodeInput is a phone number and the code texted to it
+type PhoneCodeInput struct {
+	Phone string `json:"phone" validate:"required,et_phone"`
+	Code  string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// PhoneSignupInput registers a buyer account with a phone number instead of an email
+type PhoneSignupInput struct {
+	Name    string `json:"name" validate:"required,max=100"`
+	Phone   string `json:"phone" validate:"required,et_phone"`
+	Address string `json:"address" validate:"max=255"`
+	Locale  string `json:"locale" validate:"omitempty,oneof=en am om"` // Defaults to the Accept-Language header
+	Code    string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// EmailInput is an email address to add to an account
+type EmailInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// EmailCodeInput is an email address and the code emailed to it
+type EmailCodeInput struct {
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// RequestPhoneSignupCode texts a code to a phone number that's about to be registered
+func RequestPhoneSignupCode(c *fiber.Ctx) error {
+	var input PhoneInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+	phone, _ := services.NormalizePhone(input.Phone)
+
+	if phoneTaken(config.DB, phone, 0) {
+		return c.Status(409).JSON(fiber.Map{"error": "This phone number is already registered. Log in instead"})
+	}
+
+	locale := services.NormalizeLocale(c.Get("Accept-Language"))
+	if err := sendOneTimeCode(models.CodePhoneSignup, phone, 0, locale, "", c.IP()); err != nil {
+		return oneTimeCodeFailed(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "We've texted you a 6-digit code",
+		"phone":      phone,
+		"expires_in": int(models.OneTimeCodeTTL.Seconds()),
+	})
+}
+
+// PhoneSignup creates a buyer account for a phone number whose texted code checks out
+// and signs it in. Sellers register with an email, which onboarding relies on.
+func PhoneSignup(c *fiber.Ctx) error {
+	var input PhoneSignupInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+	phone, _ := services.NormalizePhone(input.Phone)
+
+	if status := services.CheckThrottle(config.DB, models.ThrottleIP, c.IP()); !status.Allowed() {
+		return throttledResponse(c, status)
+	}
+
+	code, ok := checkOneTimeCode(models.CodePhoneSignup, phone, 0, input.Code)
+	if !ok {
+		services.RecordFailure(config.DB, models.ThrottleIP, c.IP())
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired code"})
+	}
+
+	locale := input.Locale
+	if locale == "" {
+		locale = c.Get("Accept-Language")
+	}
+
+	now := time.Now()
+	user := models.User{
+		Name:            strings.TrimSpace(input.Name),
+		Phone:           phone,
+		PhoneVerifiedAt: &now,
+		Address:         input.Address,
+		Role:            models.RoleBuyer,
+		Locale:          services.NormalizeLocale(locale),
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := claimOneTimeCode(tx, code.ID); err != nil {
+			return err
+		}
+		if phoneTaken(tx, phone, 0) {
+			return errIdentityTaken
+		}
+		return tx.Create(&user).Error
+	})
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired code"})
+	case errors.Is(err, errIdentityTaken):
+		return c.Status(409).JSON(fiber.Map{"error": "This phone number is already registered. Log in instead"})
+	case err != nil:
+		log.Printf("❌ Failed to register phone %s: %v", phone, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create account"})
+	}
+
+	log.Printf("📱 User %d registered by phone", user.ID)
+	return completeLogin(c, user)
+}
+
+// RequestPhoneLoginCode texts a sign-in code to the phone number of an existing account
+func RequestPhoneLoginCode(c *fiber.Ctx) error {
+	var input PhoneInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+	phone, _ := services.NormalizePhone(input.Phone)
+
+	var user models.User
+	if err := config.DB.Where("phone = ?", phone).First(&user).Error; err != nil {
+		return c.JSON(fiber.Map{"message": phoneLoginCodeMessage})
+	}
+
+	err := sendOneTimeCode(models.CodePhoneLogin, phone, user.ID, user.Locale, user.Name, c.IP())
+	if errors.Is(err, errOneTimeCodeCooldown) {
+		log.Printf("⚠️ Phone sign-in code for user %d throttled", user.ID)
+	} else if err != nil {
+		return oneTimeCodeFailed(c, err)
+	}
+
+	return c.JSON(fiber.Map{"message": phoneLoginCodeMessage})
+}
+
+// PhoneLogin signs in with a phone number and the code texted to it. It takes the place
+// of the password, so accounts with 2FA still get their second-factor challenge.
+func PhoneLogin(c *fiber.Ctx) error {
+	var input PhoneCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+	phone, _ := services.NormalizePhone(input.Phone)
+
+	if status := checkLoginThrottle(c, phone); !status.Allowed() {
+		return throttledResponse(c, status)
+	}
+
+	var user models.User
+	if err := config.DB.Where("phone = ?", phone).First(&user).Error; err != nil {
+		recordLoginFailure(c, phone, nil)
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid or expired code"})
+	}
+
+	code, ok := checkOneTimeCode(models.CodePhoneLogin, phone, user.ID, input.Code)
+	if !ok {
+		recordLoginFailure(c, phone, &user)
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid or expired code"})
+	}
+	if err := claimOneTimeCode(config.DB, code.ID); err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid or expired code"})
+	}
+
+	if user.Suspended() {
+		return c.Status(403).JSON(fiber.Map{"error": "Your account has been suspended", "suspended": true})
+	}
+
+	if user.RequiresTwoFactor() {
+		return startLoginChallenge(c, user)
+	}
+	return completeLogin(c, user)
+}
+
+// StartPhoneLink texts a code to a phone number the signed-in user wants to add
+func StartPhoneLink(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var input PhoneInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+	phone, _ := services.NormalizePhone(input.Phone)
+
+	if phone == user.Phone {
+		return c.Status(400).JSON(fiber.Map{"error": "This phone number is already on your account"})
+	}
+	if phoneTaken(config.DB, phone, user.ID) {
+		return c.Status(409).JSON(fiber.Map{"error": "This phone number belongs to another account"})
+	}
+
+	if err := sendOneTimeCode(models.CodeLinkPhone, phone, user.ID, user.Locale, user.Name, c.IP()); err != nil {
+		return oneTimeCodeFailed(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "We've texted a 6-digit code to " + phone,
+		"expires_in": int(models.OneTimeCodeTTL.Seconds()),
+	})
+}
+
+// VerifyPhoneLink adds the phone number to the signed-in user's account once its code
+// checks out, replacing any number they had. They can then sign in with either.
+func VerifyPhoneLink(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var input PhoneCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+	phone, _ := services.NormalizePhone(input.Phone)
+
+	code, ok := checkOneTimeCode(models.CodeLinkPhone, phone, user.ID, input.Code)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired code"})
+	}
+
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := claimOneTimeCode(tx, code.ID); err != nil {
+			return err
+		}
+		if phoneTaken(tx, phone, user.ID) {
+			return errIdentityTaken
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"phone":             phone,
+			"phone_verified_at": now,
+		}).Error
+	})
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired code"})
+	case errors.Is(err, errIdentityTaken):
+		return c.Status(409).JSON(fiber.Map{"error": "This phone number belongs to another account"})
+	case err != nil:
+		log.Printf("❌ Failed to add phone to user %d: %v", user.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to add phone number"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Phone number added", "phone": phone, "phoneVerifiedAt": now})
+}
+
+// RemovePhone takes the phone number off the signed-in user's account. Accounts
+// registered by phone have to add an email first so they can still sign in.
+func RemovePhone(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	if user.Phone == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "Your account has no phone number"})
+	}
+	if user.Email == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Add an email address before removing your phone number"})
+	}
+
+	if err := config.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"phone":             nil,
+		"phone_verified_at": nil,
+	}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to remove phone number"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Phone number removed"})
+}
+
+// StartEmailLink emails a code to an address the signed-in user wants to add. Only
+// accounts registered by phone have no email yet.
+func StartEmailLink(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var input EmailInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+
+	if user.Email != "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Your account already has an email address"})
+	}
+	if emailTaken(config.DB, email) {
+		return c.Status(409).JSON(fiber.Map{"error": "This email address belongs to another account"})
+	}
+
+	if err := sendOneTimeCode(models.CodeLinkEmail, email, user.ID, user.Locale, user.Name, c.IP()); err != nil {
+		return oneTimeCodeFailed(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":    "We've emailed a 6-digit code to " + email,
+		"expires_in": int(models.OneTimeCodeTTL.Seconds()),
+	})
+}
+
+// VerifyEmailLink adds the email address to the signed-in user's account once its code
+// checks out. Forgot-password can then set a password for signing in by email.
+func VerifyEmailLink(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var input EmailCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+
+	if user.Email != "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Your account already has an email address"})
+	}
+
+	code, ok := checkOneTimeCode(models.CodeLinkEmail, email, user.ID, input.Code)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired code"})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := claimOneTimeCode(tx, code.ID); err != nil {
+			return err
+		}
+		if emailTaken(tx, email) {
+			return errIdentityTaken
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"email":          email,
+			"email_verified": true,
+		}).Error
+	})
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid or expired code"})
+	case errors.Is(err, errIdentityTaken):
+		return c.Status(409).JSON(fiber.Map{"error": "This email address belongs to another account"})
+	case err != nil:
+		log.Printf("❌ Failed to add email to user %d: %v", user.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to add email address"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Email address added", "email": email})
+}
+
+// phoneTaken reports whether an account other than exceptUserID uses the phone number.
+// Deleted accounts count, since the number is still unique in the table.
+func phoneTaken(db *gorm.DB, phone string, exceptUserID uint) bool {
+	var count int64
+	db.Unscoped().Model(&models.User{}).Where("phone = ? AND id <> ?", phone, exceptUserID).Count(&count)
+	return count > 0
+}
+
+// emailTaken reports whether an account or a registration waiting for verification uses
+// the email address
+func emailTaken(db *gorm.DB, email string) bool {
+	var users, pending int64
+	db.Unscoped().Model(&models.User{}).Where("LOWER(email) = ?", email).Count(&users)
+	db.Model(&models.PendingRegistration{}).Where("LOWER(email) = ?", email).Count(&pending)
+	return users+pending > 0
+}
+
+// sendOneTimeCode creates a code for purpose and texts it to a phone number, or emails it
+// when confirming an email address. Earlier codes for the same purpose stop working.
+func sendOneTimeCode(purpose, destination string, userID uint, locale, name, ip string) error {
+	var recent []models.OneTimeCode
+	config.DB.Where("destination = ? AND created_at > ?", destination, time.Now().Add(-time.Hour)).
+		Order("created_at DESC").Find(&recent)
+	if len(recent) >= maxOneTimeCodesPerHour ||
+		(len(recent) > 0 && time.Since(recent[0].CreatedAt) < oneTimeCodeCooldown) {
+		return errOneTimeCodeCooldown
+	}
+
+	code, err := generateResetCode()
+	if err != nil {
+		return err
+	}
+
+	otc := models.OneTimeCode{
+		Purpose:     purpose,
+		Destination: destination,
+		UserID:      userID,
+		CodeHash:    services.HashToken(code),
+		IP:          ip,
+		ExpiresAt:   time.Now().Add(models.OneTimeCodeTTL),
+	}
+	emailed := purpose == models.CodeLinkEmail || purpose == models.CodeSignupEmail
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.OneTimeCode{}).
+			Where("purpose = ? AND destination = ? AND used_at IS NULL AND expires_at > ?", purpose, destination, time.Now()).
+			Update("expires_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&otc).Error; err != nil {
+			return err
+		}
+		if emailed {
+			return services.NewEmailService().Queue(tx).InLocale(locale).
+				SendConfirmEmailCode(destination, name, code, models.OneTimeCodeTTL)
+		}
+		return nil
+	}); err != nil || emailed {
+		return err
+	}
+
+	// Texted only after the commit, so a slow gateway doesn't hold the transaction open
+	// and a rolled back code is never sent. A code that couldn't be sent is expired.
+	if err := services.SendCodeSMS(destination, locale, code, models.OneTimeCodeTTL); err != nil {
+		config.DB.Model(&otc).Update("expires_at", time.Now())
+		return err
+	}
+	return nil
+}
+
+// oneTimeCodeFailed writes the response for a code that couldn't be sent
+func oneTimeCodeFailed(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errOneTimeCodeCooldown) {
+		return c.Status(429).JSON(fiber.Map{"error": "A code was sent recently. Please wait a minute before asking for another"})
+	}
+	log.Printf("❌ Failed to send one-time code: %v", err)
+	return c.Status(502).JSON(fiber.Map{"error": "Failed to send the code. Please try again"})
+}
+
+// checkOneTimeCode finds the newest usable code sent for purpose to destination and
+// checks it. Wrong codes count against it so it can't be brute-forced.
+func checkOneTimeCode(purpose, destination string, userID uint, code string) (*models.OneTimeCode, bool) {
+	var otc models.OneTimeCode
+	if err := config.DB.Where("purpose = ? AND destination = ? AND user_id = ? AND used_at IS NULL AND expires_at > ?",
+		purpose, destination, userID, time.Now()).
+		Order("created_at DESC").First(&otc).Error; err != nil {
+		return nil, false
+	}
+	if !otc.Usable() {
+		return nil, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(services.HashToken(code)), []byte(otc.CodeHash)) != 1 {
+		config.DB.Model(&otc).Update("attempts", gorm.Expr("attempts + 1"))
+		return nil, false
+	}
+	return &otc, true
+}
+
+// claimOneTimeCode marks the code used in the same statement that checks it, so it
+// works once. It returns gorm.ErrRecordNotFound when another request got there first.
+func claimOneTimeCode(db *gorm.DB, id uint) error {
+	result := db.Model(&models.OneTimeCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
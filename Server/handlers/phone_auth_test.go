@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var smsCodePattern = regexp.MustCompile(`\b(\d{6})\b`)
+
+// failingSMSGateway refuses every message, like a gateway that is down
+type failingSMSGateway struct{}
+
+func (failingSMSGateway) Configured() bool               { return true }
+func (failingSMSGateway) Send(services.SMSMessage) error { return errors.New("gateway timeout") }
+
+// useCapturedSMS sends texts to services.CapturedSMS for the rest of the test
+func useCapturedSMS(t *testing.T) {
+	t.Helper()
+	services.CapturedSMS.Reset()
+	services.UseSMSGateway(services.CapturedSMS)
+	t.Cleanup(func() { services.UseSMSGateway(nil) })
+}
+
+// lastTextedCode returns the code in the newest text sent to phone
+func lastTextedCode(t *testing.T, phone string) string {
+	t.Helper()
+	messages := services.CapturedSMS.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To == phone {
+			if match := smsCodePattern.FindStringSubmatch(messages[i].Body); match != nil {
+				return match[1]
+			}
+		}
+	}
+	t.Fatalf("no code texted to %s", phone)
+	return ""
+}
+
+// wrongCode returns a valid-looking code that isn't code
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestPhoneSignupCodes(t *testing.T) {
+	db := setupTestDB(t)
+	useCapturedSMS(t)
+
+	app := fiber.New()
+	app.Post("/register/phone/code", RequestPhoneSignupCode)
+	app.Post("/register/phone", PhoneSignup)
+
+	const phone = "+251911223344"
+	if res := doJSON(t, app, "POST", "/register/phone/code", "", fiber.Map{"phone": "0911 22 33 44"}); res.Status != 200 {
+		t.Fatalf("request code: %d %v", res.Status, res.Body)
+	}
+	code := lastTextedCode(t, phone)
+	if res := doJSON(t, app, "POST", "/register/phone/code", "", fiber.Map{"phone": phone}); res.Status != 429 {
+		t.Errorf("second code within the cooldown: got %d, want 429", res.Status)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want int
+	}{
+		{"wrong code", wrongCode(code), 400},
+		{"texted code", code, 200},
+		{"code used twice", code, 400},
+	}
+	for _, tt := range tests {
+		res := doJSON(t, app, "POST", "/register/phone", "", fiber.Map{"name": "Almaz", "phone": phone, "code": tt.code})
+		if res.Status != tt.want {
+			t.Errorf("%s: got %d, want %d (%v)", tt.name, res.Status, tt.want, res.Body)
+		}
+	}
+
+	var user models.User
+	if err := db.Where("phone = ?", phone).First(&user).Error; err != nil || user.PhoneVerifiedAt == nil {
+		t.Errorf("phone account not created as verified: %+v, %v", user, err)
+	}
+}
+
+func TestOneTimeCodeExpiryAndAttempts(t *testing.T) {
+	db := setupTestDB(t)
+	useCapturedSMS(t)
+	user := createTestUser(t, db, "buyer@example.com", models.RoleBuyer)
+	token := accessToken(t, db, user)
+
+	app := fiber.New()
+	app.Post("/me/phone", middleware.RequireAuth, StartPhoneLink)
+	app.Post("/me/phone/verify", middleware.RequireAuth, VerifyPhoneLink)
+
+	tests := []struct {
+		name    string
+		phone   string
+		spoil   func(t *testing.T, phone, code string) string // Returns the code to enter
+		wantErr bool
+	}{
+		{"fresh code", "+251911000001", func(t *testing.T, phone, code string) string {
+			return code
+		}, false},
+		{"expired code", "+251911000002", func(t *testing.T, phone, code string) string {
+			db.Model(&models.OneTimeCode{}).Where("destination = ?", phone).Update("expires_at", time.Now().Add(-time.Second))
+			return code
+		}, true},
+		{"right code after too many wrong ones", "+251911000003", func(t *testing.T, phone, code string) string {
+			for i := 0; i < models.MaxOneTimeCodeAttempts; i++ {
+				doJSON(t, app, "POST", "/me/phone/verify", token, fiber.Map{"phone": phone, "code": wrongCode(code)})
+			}
+			return code
+		}, true},
+		{"right code after a few wrong ones", "+251911000004", func(t *testing.T, phone, code string) string {
+			for i := 0; i < models.MaxOneTimeCodeAttempts-1; i++ {
+				doJSON(t, app, "POST", "/me/phone/verify", token, fiber.Map{"phone": phone, "code": wrongCode(code)})
+			}
+			return code
+		}, false},
+	}
+	for _, tt := range tests {
+		if res := doJSON(t, app, "POST", "/me/phone", token, fiber.Map{"phone": tt.phone}); res.Status != 200 {
+			t.Fatalf("%s: request code: %d %v", tt.name, res.Status, res.Body)
+		}
+		code := tt.spoil(t, tt.phone, lastTextedCode(t, tt.phone))
+
+		res := doJSON(t, app, "POST", "/me/phone/verify", token, fiber.Map{"phone": tt.phone, "code": code})
+		if got := res.Status != 200; got != tt.wantErr {
+			t.Errorf("%s: got %d (%v)", tt.name, res.Status, res.Body)
+		}
+		var saved models.User
+		db.First(&saved, user.ID)
+		if linked := saved.Phone == tt.phone; linked == tt.wantErr {
+			t.Errorf("%s: account phone is %q", tt.name, saved.Phone)
+		}
+	}
+}
+
+func TestPhoneLinking(t *testing.T) {
+	db := setupTestDB(t)
+	useCapturedSMS(t)
+	owner := createTestUser(t, db, "owner@example.com", models.RoleBuyer)
+	other := createTestUser(t, db, "other@example.com", models.RoleBuyer)
+	ownerToken, otherToken := accessToken(t, db, owner), accessToken(t, db, other)
+
+	app := fiber.New()
+	app.Post("/me/phone", middleware.RequireAuth, StartPhoneLink)
+	app.Post("/me/phone/verify", middleware.RequireAuth, VerifyPhoneLink)
+
+	const phone = "+251922334455"
+	if res := doJSON(t, app, "POST", "/me/phone", ownerToken, fiber.Map{"phone": phone}); res.Status != 200 {
+		t.Fatalf("request code: %d %v", res.Status, res.Body)
+	}
+	code := lastTextedCode(t, phone)
+
+	// The code was sent for the owner's account, so nobody else can use it
+	if res := doJSON(t, app, "POST", "/me/phone/verify", otherToken, fiber.Map{"phone": phone, "code": code}); res.Status != 400 {
+		t.Errorf("code used by another account: got %d, want 400", res.Status)
+	}
+	if res := doJSON(t, app, "POST", "/me/phone/verify", ownerToken, fiber.Map{"phone": phone, "code": code}); res.Status != 200 {
+		t.Fatalf("verify: %d %v", res.Status, res.Body)
+	}
+
+	steps := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"number already on the account", ownerToken, 400},
+		{"number on another account", otherToken, 409},
+	}
+	for _, tt := range steps {
+		if res := doJSON(t, app, "POST", "/me/phone", tt.token, fiber.Map{"phone": phone}); res.Status != tt.want {
+			t.Errorf("%s: got %d, want %d (%v)", tt.name, res.Status, tt.want, res.Body)
+		}
+	}
+}
+
+func TestOneTimeCodeSMSFailure(t *testing.T) {
+	db := setupTestDB(t)
+	services.UseSMSGateway(failingSMSGateway{})
+	t.Cleanup(func() { services.UseSMSGateway(nil) })
+
+	app := fiber.New()
+	app.Post("/register/phone/code", RequestPhoneSignupCode)
+
+	if res := doJSON(t, app, "POST", "/register/phone/code", "", fiber.Map{"phone": "0911556677"}); res.Status != 502 {
+		t.Errorf("gateway down: got %d, want 502", res.Status)
+	}
+	var codes []models.OneTimeCode
+	db.Find(&codes)
+	if len(codes) != 1 || codes[0].Usable() {
+		t.Errorf("a code that was never texted should be saved as expired, got %+v", codes)
+	}
+}
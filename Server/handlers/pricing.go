@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OrderItemInput is a product and quantity requested in an order, pending order or quote
+type OrderItemInput struct {
+	ProductID uint   `json:"product_id" validate:"required"`
+	Quantity  int    `json:"quantity" validate:"required,min=1"`
+	Variant   string `json:"variant"`
+}
+
+// shippingDestination is where an order will be delivered
+type shippingDestination struct {
+	City  string
+	State string
+}
+
+// orderQuote is the server-side price breakdown for a cart. Every place that
+// charges or records money (orders, pending orders, payment amounts) uses it.
+type orderQuote struct {
+	Items       []models.OrderItem
+	Subtotal    float64
+	Discount    float64
+	Promotion   *models.Promotion
+	ShippingFee float64
+	Zone        *models.ShippingZone
+	Tax         float64
+	TaxLines    []models.OrderTaxLine
+	Total       float64
+}
+
+// quoteError is a pricing problem caused by the request (unknown product, stock, coupon)
+type quoteError struct {
+	message string
+}
+
+func (e *quoteError) Error() string {
+	return e.message
+}
+
+// buildOrderQuote validates the items and prices them, applying the coupon code if given
+// or otherwise the best automatic discount the buyer qualifies for, plus delivery to dest.
+func buildOrderQuote(db *gorm.DB, user models.User, items []OrderItemInput, couponCode string, dest shippingDestination) (*orderQuote, error) {
+	if len(items) == 0 {
+		return nil, &quoteError{"Order must contain at least one item"}
+	}
+
+	var productIDs []uint
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	var products []models.Product
+	if err := db.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch products: %v", err)
+	}
+
+	productMap := make(map[uint]models.Product)
+	for _, product := range products {
+		productMap[product.ID] = product
+	}
+
+	sellers, err := loadSellers(db, products)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sellers: %v", err)
+	}
+
+	quote := &orderQuote{}
+	sellerWeights := make(map[uint]float64)
+	var categories []string // parallel to quote.Items
+	for _, item := range items {
+		product, exists := productMap[item.ProductID]
+		if !exists {
+			return nil, &quoteError{fmt.Sprintf("Product with ID %d not found", item.ProductID)}
+		}
+
+		if !product.IsPurchasable() || sellers[product.SellerID].Suspended() {
+			return nil, &quoteError{fmt.Sprintf("Product %s is no longer available", product.Name)}
+		}
+
+		if product.Stock < item.Quantity {
+			return nil, &quoteError{fmt.Sprintf("Insufficient stock for product %s. Available: %d, Requested: %d",
+				product.Name, product.Stock, item.Quantity)}
+		}
+
+		orderItem := models.NewOrderItem(product, sellers[product.SellerID], item.Quantity, item.Variant)
+		quote.Subtotal += orderItem.Total
+		quote.Items = append(quote.Items, orderItem)
+		categories = append(categories, product.Category)
+		sellerWeights[product.SellerID] += product.WeightKg * float64(item.Quantity)
+	}
+	quote.Subtotal = roundMoney(quote.Subtotal)
+
+	if err := applyPromotion(db, user, quote, couponCode); err != nil {
+		return nil, err
+	}
+
+	if err := applyShipping(db, quote, dest, sellerWeights); err != nil {
+		return nil, err
+	}
+
+	if err := applyTax(db, quote, categories, sellers); err != nil {
+		return nil, err
+	}
+
+	quote.Total = roundMoney(quote.Subtotal - quote.Discount + quote.ShippingFee + quote.Tax)
+	return quote, nil
+}
+
+// applyPromotion sets the quote's discount from a coupon or the best automatic promotion
+func applyPromotion(db *gorm.DB, user models.User, quote *orderQuote, couponCode string) error {
+	now := time.Now()
+	couponCode = models.NormalizeCouponCode(couponCode)
+
+	if couponCode != "" {
+		var promotion models.Promotion
+		if err := db.Where("code = ?", couponCode).First(&promotion).Error; err != nil || !promotion.IsRunning(now) {
+			return &quoteError{"Invalid or expired coupon code"}
+		}
+		if !withinPerUserLimit(db, &promotion, user.ID) {
+			return &quoteError{"You have already used this coupon the maximum number of times"}
+		}
+
+		eligible := eligibleSubtotal(&promotion, quote.Items)
+		if eligible == 0 {
+			return &quoteError{"This coupon does not apply to any items in your cart"}
+		}
+		if eligible < promotion.MinOrderAmount {
+			return &quoteError{fmt.Sprintf("This coupon requires a minimum order of %.2f ETB", promotion.MinOrderAmount)}
+		}
+
+		quote.Discount = promotion.DiscountFor(eligible)
+		quote.Promotion = &promotion
+		return nil
+	}
+
+	var automatic []models.Promotion
+	if err := db.Where("code = '' AND active = ?", true).Find(&automatic).Error; err != nil {
+		return fmt.Errorf("failed to fetch promotions: %v", err)
+	}
+	for i := range automatic {
+		promotion := &automatic[i]
+		if !promotion.IsRunning(now) || !withinPerUserLimit(db, promotion, user.ID) {
+			continue
+		}
+		if discount := promotion.DiscountFor(eligibleSubtotal(promotion, quote.Items)); discount > quote.Discount {
+			quote.Discount = discount
+			quote.Promotion = promotion
+		}
+	}
+	return nil
+}
+
+// applyShipping prices delivery per seller, since each seller ships their own items.
+// Sellers without their own rate for the zone use the platform rate; with no rate at all
+// delivery is free.
+func applyShipping(db *gorm.DB, quote *orderQuote, dest shippingDestination, sellerWeights map[uint]float64) error {
+	zone, err := models.FindShippingZone(db, dest.City, dest.State)
+	if err != nil {
+		return fmt.Errorf("failed to fetch shipping zones: %v", err)
+	}
+	if zone == nil {
+		return nil
+	}
+	quote.Zone = zone
+
+	var rates []models.ShippingRate
+	if err := db.Where("zone_id = ?", zone.ID).Find(&rates).Error; err != nil {
+		return fmt.Errorf("failed to fetch shipping rates: %v", err)
+	}
+
+	var platformRate *models.ShippingRate
+	sellerRates := make(map[uint]*models.ShippingRate)
+	for i := range rates {
+		if rates[i].SellerID == nil {
+			platformRate = &rates[i]
+		} else {
+			sellerRates[*rates[i].SellerID] = &rates[i]
+		}
+	}
+
+	sellerSubtotals := make(map[uint]float64)
+	for _, item := range quote.Items {
+		sellerSubtotals[item.SellerID] += item.Total
+	}
+
+	for sellerID, subtotal := range sellerSubtotals {
+		rate := sellerRates[sellerID]
+		if rate == nil {
+			rate = platformRate
+		}
+		if rate != nil {
+			quote.ShippingFee += rate.FeeFor(sellerWeights[sellerID], subtotal)
+		}
+	}
+	quote.ShippingFee = roundMoney(quote.ShippingFee)
+	return nil
+}
+
+// applyTax charges VAT or TOT on each item according to its category's tax rule and
+// whether the seller is VAT registered. Tax is on the item total after its share of
+// the discount; delivery is not taxed.
+func applyTax(db *gorm.DB, quote *orderQuote, categories []string, sellers map[uint]models.User) error {
+	var rules []models.TaxRule
+	if err := db.Find(&rules).Error; err != nil {
+		return fmt.Errorf("failed to fetch tax rules: %v", err)
+	}
+
+	var eligible float64
+	if quote.Promotion != nil {
+		eligible = eligibleSubtotal(quote.Promotion, quote.Items)
+	}
+
+	type lineKey struct {
+		taxType models.TaxType
+		rate    float64
+	}
+	lines := make(map[lineKey]*models.OrderTaxLine)
+	var order []lineKey
+
+	for i := range quote.Items {
+		item := &quote.Items[i]
+		taxType, rate := models.MatchTaxRule(rules, categories[i]).TaxFor(sellers[item.SellerID].VATRegistered)
+		if rate == 0 {
+			continue
+		}
+
+		taxable := item.Total
+		if eligible > 0 && (quote.Promotion.SellerID == nil || *quote.Promotion.SellerID == item.SellerID) {
+			taxable -= quote.Discount * item.Total / eligible
+		}
+		taxable = roundMoney(taxable)
+
+		item.TaxType = taxType
+		item.TaxRate = rate
+		item.TaxAmount = roundMoney(taxable * rate)
+
+		key := lineKey{taxType, rate}
+		line, ok := lines[key]
+		if !ok {
+			line = &models.OrderTaxLine{TaxType: taxType, Rate: rate}
+			lines[key] = line
+			order = append(order, key)
+		}
+		line.TaxableAmount = roundMoney(line.TaxableAmount + taxable)
+		line.Amount = roundMoney(line.Amount + item.TaxAmount)
+		quote.Tax += item.TaxAmount
+	}
+
+	for _, key := range order {
+		quote.TaxLines = append(quote.TaxLines, *lines[key])
+	}
+	quote.Tax = roundMoney(quote.Tax)
+	return nil
+}
+
+// eligibleSubtotal is the part of the cart a promotion applies to
+func eligibleSubtotal(promotion *models.Promotion, items []models.OrderItem) float64 {
+	var eligible float64
+	for _, item := range items {
+		if promotion.SellerID == nil || *promotion.SellerID == item.SellerID {
+			eligible += item.Total
+		}
+	}
+	return roundMoney(eligible)
+}
+
+func withinPerUserLimit(db *gorm.DB, promotion *models.Promotion, userID uint) bool {
+	if promotion.PerUserLimit == 0 {
+		return true
+	}
+	var used int64
+	db.Model(&models.PromotionRedemption{}).
+		Where("promotion_id = ? AND user_id = ?", promotion.ID, userID).
+		Count(&used)
+	return used < int64(promotion.PerUserLimit)
+}
+
+// applyToOrder copies the quote's amounts onto an order. The items and tax lines are
+// copied too, so a quote kept for a pending payment isn't changed by saving the order.
+func (q *orderQuote) applyToOrder(order *models.Order) {
+	order.OrderItems = append([]models.OrderItem(nil), q.Items...)
+	order.Subtotal = q.Subtotal
+	order.Discount = q.Discount
+	order.ShippingFee = q.ShippingFee
+	order.Tax = q.Tax
+	order.TaxLines = append([]models.OrderTaxLine(nil), q.TaxLines...)
+	order.Total = q.Total
+	if q.Zone != nil {
+		order.ShippingZone = q.Zone.Code
+	}
+	if q.Promotion != nil {
+		order.PromotionID = &q.Promotion.ID
+		order.PromotionCode = q.Promotion.Code
+	}
+}
+
+// redeemPromotion records the promotion use for a created order, enforcing the
+// global and per-user usage limits atomically. Must run inside the order's transaction.
+func (q *orderQuote) redeemPromotion(tx *gorm.DB, order *models.Order) error {
+	_, err := q.reservePromotion(tx, order.UserID, order.ID)
+	return err
+}
+
+// reservePromotion takes one use of the quote's promotion for the user, enforcing the
+// global and per-user usage limits atomically. orderID is 0 while the buyer is still
+// paying; the order claims the redemption once it exists, or releasePromotion gives it back.
+func (q *orderQuote) reservePromotion(db *gorm.DB, userID, orderID uint) (*models.PromotionRedemption, error) {
+	if q.Promotion == nil || q.Discount == 0 {
+		return nil, nil
+	}
+
+	redemption := models.PromotionRedemption{
+		PromotionID: q.Promotion.ID,
+		UserID:      userID,
+		OrderID:     orderID,
+		Amount:      q.Discount,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Promotion{}).
+			Where("id = ? AND (usage_limit = 0 OR used_count < usage_limit)", q.Promotion.ID).
+			Update("used_count", gorm.Expr("used_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &quoteError{"This promotion has reached its usage limit"}
+		}
+
+		if q.Promotion.PerUserLimit > 0 {
+			slot, err := freeRedemptionSlot(tx, q.Promotion, userID)
+			if err != nil {
+				return err
+			}
+			if slot == 0 {
+				return &quoteError{"You have already used this coupon the maximum number of times"}
+			}
+			redemption.Slot = &slot
+		}
+
+		// A checkout racing this one for the same slot makes the insert a no-op
+		result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&redemption)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &quoteError{"You have already used this coupon the maximum number of times"}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+// freeRedemptionSlot returns the lowest of the user's slots for the promotion that isn't
+// taken, or 0 when they have used it as many times as it allows
+func freeRedemptionSlot(tx *gorm.DB, promotion *models.Promotion, userID uint) (int, error) {
+	var used int64
+	if err := tx.Model(&models.PromotionRedemption{}).
+		Where("promotion_id = ? AND user_id = ?", promotion.ID, userID).
+		Count(&used).Error; err != nil {
+		return 0, err
+	}
+	if used >= int64(promotion.PerUserLimit) {
+		return 0, nil
+	}
+
+	var taken []int
+	if err := tx.Model(&models.PromotionRedemption{}).
+		Where("promotion_id = ? AND user_id = ? AND slot IS NOT NULL", promotion.ID, userID).
+		Pluck("slot", &taken).Error; err != nil {
+		return 0, err
+	}
+	isTaken := map[int]bool{}
+	for _, slot := range taken {
+		isTaken[slot] = true
+	}
+	for slot := 1; slot <= promotion.PerUserLimit; slot++ {
+		if !isTaken[slot] {
+			return slot, nil
+		}
+	}
+	return 0, nil
+}
+
+// releasePromotion gives back a use reserved for a payment that never completed
+func releasePromotion(db *gorm.DB, redemptionID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var redemption models.PromotionRedemption
+		if err := tx.Where("id = ? AND order_id = 0", redemptionID).First(&redemption).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil // Already claimed by an order or released
+			}
+			return err
+		}
+		if err := tx.Unscoped().Delete(&redemption).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Promotion{}).
+			Where("id = ? AND used_count > 0", redemption.PromotionID).
+			Update("used_count", gorm.Expr("used_count - 1")).Error
+	})
+}
+
+// response is the JSON breakdown shown to buyers before they pay
+func (q *orderQuote) response() fiber.Map {
+	quote := fiber.Map{
+		"items":        q.Items,
+		"subtotal":     q.Subtotal,
+		"discount":     q.Discount,
+		"shipping_fee": q.ShippingFee,
+		"tax":          q.Tax,
+		"tax_lines":    q.TaxLines,
+		"total":        q.Total,
+		"currency":     "ETB",
+	}
+	if q.Zone != nil {
+		quote["shipping_zone"] = fiber.Map{
+			"code": q.Zone.Code,
+			"name": q.Zone.Name,
+		}
+	}
+	if q.Promotion != nil {
+		quote["promotion"] = fiber.Map{
+			"id":   q.Promotion.ID,
+			"name": q.Promotion.Name,
+			"code": q.Promotion.Code,
+		}
+	}
+	return quote
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
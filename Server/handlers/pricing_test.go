@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+
+	"gorm.io/gorm"
+)
+
+// setupPricing creates two sellers, one VAT registered, with products, tax rules, Addis
+// Ababa delivery rates and a set of promotions, and returns the products by name
+func setupPricing(t *testing.T, db *gorm.DB) (models.User, map[string]models.Product) {
+	t.Helper()
+	vatSeller := createTestUser(t, db, "vat-seller@example.com", models.RoleSeller)
+	db.Model(&vatSeller).Update("vat_registered", true)
+	totSeller := createTestUser(t, db, "tot-seller@example.com", models.RoleSeller)
+	buyer := createTestUser(t, db, "buyer@example.com", models.RoleBuyer)
+
+	products := map[string]models.Product{}
+	for _, product := range []models.Product{
+		{SellerID: vatSeller.ID, Name: "Teff", Price: 100, WeightKg: 1, Stock: 10},
+		{SellerID: vatSeller.ID, Name: "Cookbook", Price: 40, WeightKg: 0.5, Stock: 10, Category: "books"},
+		{SellerID: totSeller.ID, Name: "Berbere", Price: 50, WeightKg: 0.2, Stock: 10},
+	} {
+		product.Status = models.ProductStatusPublished
+		db.Create(&product)
+		products[product.Name] = product
+	}
+
+	db.Create(&[]models.TaxRule{{Category: "", VATRate: 0.15, TOTRate: 0.02}, {Category: "books", Exempt: true}})
+
+	models.SeedShippingZones(db)
+	var inner models.ShippingZone
+	db.Where("code = ?", "addis-inner").First(&inner)
+	db.Create(&[]models.ShippingRate{
+		{ZoneID: inner.ID, BaseFee: 50, PerKgFee: 10, FreeShippingThreshold: 300},
+		{ZoneID: inner.ID, SellerID: &totSeller.ID, BaseFee: 20},
+	})
+
+	expired := time.Now().Add(-time.Hour)
+	once := models.Promotion{Code: "ONCE", Name: "Welcome", Type: models.PromotionTypeFixed, Value: 5, PerUserLimit: 1, Active: true}
+	db.Create(&[]models.Promotion{
+		{Code: "TEFF10", Name: "Teff week", Type: models.PromotionTypePercentage, Value: 10, Active: true},
+		{Code: "BERBERE20", Name: "Spice sale", Type: models.PromotionTypeFixed, Value: 20, SellerID: &totSeller.ID, Active: true},
+		{Code: "BIG", Name: "Big baskets", Type: models.PromotionTypePercentage, Value: 10, MinOrderAmount: 1000, Active: true},
+		{Code: "OLD", Name: "Last year", Type: models.PromotionTypePercentage, Value: 50, EndsAt: &expired, Active: true},
+		{Name: "Spice bulk", Type: models.PromotionTypePercentage, Value: 10, SellerID: &totSeller.ID, MinOrderAmount: 100, Active: true},
+	})
+	db.Create(&once)
+	db.Create(&models.PromotionRedemption{PromotionID: once.ID, UserID: buyer.ID, OrderID: 1, Amount: 5})
+
+	return buyer, products
+}
+
+func TestBuildOrderQuote(t *testing.T) {
+	db := setupTestDB(t)
+	buyer, products := setupPricing(t, db)
+
+	regions := shippingDestination{City: "Hawassa", State: "Sidama"} // Default zone, no rates
+	bole := shippingDestination{City: "Bole", State: "Addis Ababa"}
+
+	type line struct {
+		product  string
+		quantity int
+	}
+	tests := []struct {
+		name    string
+		items   []line
+		coupon  string
+		dest    shippingDestination
+		wantErr bool
+		// Subtotal, discount, shipping, tax and total
+		want [5]float64
+	}{
+		{"VAT and TOT by seller", []line{{"Teff", 1}, {"Berbere", 1}}, "", regions, false,
+			[5]float64{150, 0, 0, 16, 166}},
+		{"exempt category", []line{{"Cookbook", 2}}, "", regions, false,
+			[5]float64{80, 0, 0, 0, 80}},
+		{"platform coupon is taxed after its share of the discount", []line{{"Teff", 1}, {"Berbere", 1}}, "teff10", regions, false,
+			[5]float64{150, 15, 0, 14.4, 149.4}},
+		{"seller coupon only discounts that seller", []line{{"Teff", 1}, {"Berbere", 1}}, "BERBERE20", regions, false,
+			[5]float64{150, 20, 0, 15.6, 145.6}},
+		{"automatic seller promotion over its minimum", []line{{"Berbere", 2}}, "", regions, false,
+			[5]float64{100, 10, 0, 1.8, 91.8}},
+		{"automatic promotion under its minimum", []line{{"Berbere", 1}}, "", regions, false,
+			[5]float64{50, 0, 0, 1, 51}},
+		{"delivery by weight, with the seller's own rate", []line{{"Teff", 2}, {"Berbere", 1}}, "", bole, false,
+			[5]float64{250, 0, 90, 31, 371}},
+		{"free delivery over the threshold", []line{{"Teff", 3}}, "", bole, false,
+			[5]float64{300, 0, 0, 45, 345}},
+		{"expired coupon", []line{{"Teff", 1}}, "OLD", regions, true, [5]float64{}},
+		{"unknown coupon", []line{{"Teff", 1}}, "NOPE", regions, true, [5]float64{}},
+		{"coupon under its minimum order", []line{{"Teff", 1}}, "BIG", regions, true, [5]float64{}},
+		{"coupon used up by this buyer", []line{{"Teff", 1}}, "ONCE", regions, true, [5]float64{}},
+		{"seller coupon without that seller's items", []line{{"Teff", 1}}, "BERBERE20", regions, true, [5]float64{}},
+		{"more than in stock", []line{{"Teff", 11}}, "", regions, true, [5]float64{}},
+		{"empty cart", nil, "", regions, true, [5]float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var items []OrderItemInput
+			for _, l := range tt.items {
+				items = append(items, OrderItemInput{ProductID: products[l.product].ID, Quantity: l.quantity})
+			}
+
+			quote, err := buildOrderQuote(db, buyer, items, tt.coupon, tt.dest)
+			if tt.wantErr {
+				var qe *quoteError
+				if !errors.As(err, &qe) {
+					t.Fatalf("got %v, want a quote error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := [5]float64{quote.Subtotal, quote.Discount, quote.ShippingFee, quote.Tax, quote.Total}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			var lineTax float64
+			for _, taxLine := range quote.TaxLines {
+				lineTax += taxLine.Amount
+			}
+			if roundMoney(lineTax) != quote.Tax {
+				t.Errorf("tax lines add up to %.2f, quote tax is %.2f", lineTax, quote.Tax)
+			}
+		})
+	}
+}
+
+func TestReservePromotionPerUserLimit(t *testing.T) {
+	db := setupTestDB(t)
+	buyer, products := setupPricing(t, db)
+	twice := models.Promotion{Code: "TWICE", Name: "Two teff deals", Type: models.PromotionTypeFixed, Value: 10, PerUserLimit: 2, Active: true}
+	db.Create(&twice)
+
+	// Checkouts started together all pass the per-user check in the quote
+	items := []OrderItemInput{{ProductID: products["Teff"].ID, Quantity: 1}}
+	var quotes []*orderQuote
+	for i := 0; i < 3; i++ {
+		quote, err := buildOrderQuote(db, buyer, items, "TWICE", shippingDestination{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		quotes = append(quotes, quote)
+	}
+
+	var reserved []*models.PromotionRedemption
+	for i, quote := range quotes {
+		redemption, err := quote.reservePromotion(db, buyer.ID, 0)
+		var qe *quoteError
+		if i < 2 && err != nil {
+			t.Fatalf("use %d: %v", i+1, err)
+		}
+		if i == 2 && !errors.As(err, &qe) {
+			t.Fatalf("use past the per-user limit: got %v, want a quote error", err)
+		}
+		if redemption != nil {
+			reserved = append(reserved, redemption)
+		}
+	}
+	db.First(&twice, twice.ID)
+	if twice.UsedCount != 2 {
+		t.Errorf("used count %d, want 2: the refused use must not be counted", twice.UsedCount)
+	}
+
+	// Two redemptions can't hold the same slot
+	taken := *reserved[0].Slot
+	if err := db.Create(&models.PromotionRedemption{PromotionID: twice.ID, UserID: buyer.ID, Amount: 10, Slot: &taken}).Error; err == nil {
+		t.Error("created a second redemption in the same slot")
+	}
+
+	// A released use frees its slot for the next checkout
+	if err := releasePromotion(db, reserved[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	redemption, err := quotes[2].reservePromotion(db, buyer.ID, 0)
+	if err != nil || redemption == nil || *redemption.Slot != taken {
+		t.Errorf("reserving after a release: got %+v, %v, want slot %d", redemption, err, taken)
+	}
+}
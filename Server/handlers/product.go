@@ -2,42 +2,66 @@ package handlers
 
 import (
 	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
 	"injera-gebeya-platform/Server/models"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // ProductInput includes Stock for inventory tracking
 type ProductInput struct {
-	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
-	Description string  `json:"description"`
-	ImageURL    string  `json:"image_url"`
-	Stock       int     `json:"stock"`
+	SKU         string  `json:"sku" validate:"max=64"`
+	Name        string  `json:"name" validate:"required,max=200"`
+	Price       float64 `json:"price" validate:"gt=0"`
+	Description string  `json:"description" validate:"max=5000"`
+	ImageURL    string  `json:"image_url" validate:"omitempty,http_url,max=2048"`
+	Stock       int     `json:"stock" validate:"gte=0"`
+	WeightKg    float64 `json:"weight_kg" validate:"gte=0,lte=1000"`
+	Category    string  `json:"category" validate:"max=100"`
+}
+
+// ProductUpdateInput has PATCH semantics: omitted (nil) fields are left unchanged
+type ProductUpdateInput struct {
+	SKU         *string  `json:"sku" validate:"omitempty,max=64"`
+	Name        *string  `json:"name" validate:"omitempty,min=1,max=200"`
+	Price       *float64 `json:"price" validate:"omitempty,gt=0"`
+	Description *string  `json:"description" validate:"omitempty,max=5000"`
+	ImageURL    *string  `json:"image_url" validate:"omitempty,max=2048"`
+	Stock       *int     `json:"stock" validate:"omitempty,gte=0"`
+	WeightKg    *float64 `json:"weight_kg" validate:"omitempty,gte=0,lte=1000"`
+	Category    *string  `json:"category" validate:"omitempty,max=100"`
 }
 
 // ✅ CreateProduct — Add a new product (for sellers)
 func CreateProduct(c *fiber.Ctx) error {
-	sellerID, ok := c.Locals("user_id").(uint)
-	role, _ := c.Locals("role").(string)
-	if !ok || role != "seller" {
-		return c.Status(403).JSON(fiber.Map{"error": "Unauthorized"})
-	}
+	sellerID := c.Locals("user_id").(uint)
 
 	var input ProductInput
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	input.SKU = strings.TrimSpace(input.SKU)
+	input.Name = strings.TrimSpace(input.Name)
+
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
 
 	product := models.Product{
+		SKU:         input.SKU,
 		Name:        input.Name,
 		Price:       input.Price,
 		Description: input.Description,
 		ImageURL:    input.ImageURL,
 		Stock:       input.Stock,
+		WeightKg:    input.WeightKg,
+		Category:    models.NormalizeCategory(input.Category),
 		SellerID:    sellerID,
+		Status:      models.ProductStatusDraft,
 	}
 
 	if err := config.DB.Create(&product).Error; err != nil {
@@ -64,79 +88,179 @@ func GetSellerProducts(c *fiber.Ctx) error {
 // ✅ GetPublicProducts — View all public products
 func GetPublicProducts(c *fiber.Ctx) error {
 	var products []models.Product
-	if err := config.DB.Find(&products).Error; err != nil {
+	if err := config.DB.Scopes(models.PublishedProducts).Find(&products).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch products"})
 	}
 	return c.JSON(products)
 }
 
-// ✅ UpdateProduct — Update seller’s product
-func UpdateProduct(c *fiber.Ctx) error {
-	sellerID, ok := c.Locals("user_id").(uint)
-	role, _ := c.Locals("role").(string)
-	if !ok || role != "seller" {
-		return c.Status(403).JSON(fiber.Map{"error": "Unauthorized"})
-	}
-
-	idParam := c.Params("id")
-	id64, err := strconv.ParseUint(idParam, 10, 64)
+// ✅ GetProduct — Public product detail with seller info and rating summary
+func GetProduct(c *fiber.Ctx) error {
+	id64, err := strconv.ParseUint(c.Params("id"), 10, 64)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid product id"})
 	}
 
 	var product models.Product
-	if err := config.DB.First(&product, id64).Error; err != nil {
+	if err := config.DB.Preload("Images", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Where("status NOT IN ?", []models.ProductStatus{models.ProductStatusDraft, models.ProductStatusBlocked}).
+		First(&product, id64).Error; err != nil {
 		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found"})
 	}
 
-	if product.SellerID != sellerID {
-		return c.Status(403).JSON(fiber.Map{"error": "Not allowed"})
+	var seller models.User
+	if err := config.DB.First(&seller, product.SellerID).Error; err != nil || seller.Suspended() {
+		return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "Product not found"})
 	}
 
-	var input ProductInput
+	return c.JSON(fiber.Map{
+		"product":      product,
+		"seller":       shopProfile(seller),
+		"stock_status": product.StockStatus(),
+		"available":    product.IsPurchasable(),
+		"images":       product.ImageURLs(),
+		"rating": fiber.Map{
+			"average": product.RatingAverage,
+			"count":   product.RatingCount,
+		},
+	})
+}
+
+// ✅ UpdateProduct — Partially update seller’s product (fields omitted from the body are kept)
+func UpdateProduct(c *fiber.Ctx) error {
+	product, status, message := findSellerProduct(c)
+	if product == nil {
+		return c.Status(status).JSON(fiber.Map{"error": message})
+	}
+
+	var input ProductUpdateInput
 	if err := c.BodyParser(&input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
+	if input.SKU != nil {
+		*input.SKU = strings.TrimSpace(*input.SKU)
+	}
+	if input.Name != nil {
+		*input.Name = strings.TrimSpace(*input.Name)
+	}
 
-	product.Name = input.Name
-	product.Price = input.Price
-	product.Description = input.Description
-	product.ImageURL = input.ImageURL
-	product.Stock = input.Stock
+	fieldErrors := middleware.ValidateStruct(input)
+	// An empty image_url clears the image; anything else must be an http(s) URL
+	if input.ImageURL != nil && *input.ImageURL != "" {
+		fieldErrors = append(fieldErrors, middleware.ValidateStruct(struct {
+			ImageURL string `json:"image_url" validate:"http_url"`
+		}{*input.ImageURL})...)
+	}
+	if len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
 
-	if err := config.DB.Save(&product).Error; err != nil {
+	before := *product
+	if input.SKU != nil {
+		product.SKU = *input.SKU
+	}
+	if input.Name != nil {
+		product.Name = *input.Name
+	}
+	if input.Price != nil {
+		product.Price = *input.Price
+	}
+	if input.Description != nil {
+		product.Description = *input.Description
+	}
+	if input.ImageURL != nil {
+		product.ImageURL = *input.ImageURL
+	}
+	if input.Stock != nil {
+		product.Stock = *input.Stock
+	}
+	if input.WeightKg != nil {
+		product.WeightKg = *input.WeightKg
+	}
+	if input.Category != nil {
+		product.Category = models.NormalizeCategory(*input.Category)
+	}
+
+	if err := config.DB.Save(product).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Could not update product"})
 	}
 
+	notifyWishlistWatchers(before, *product)
+
 	return c.JSON(product)
 }
 
-// ✅ DeleteProduct — Remove a product
+// blockedProductMessage is returned when a seller tries to change the status of a product a moderator blocked
+const blockedProductMessage = "This product was blocked by a moderator and can't be published, unpublished or archived"
+
+// ✅ DeleteProduct — Archive a product so past orders can still resolve it
 func DeleteProduct(c *fiber.Ctx) error {
-	sellerID, ok := c.Locals("user_id").(uint)
-	role, _ := c.Locals("role").(string)
-	if !ok || role != "seller" {
-		return c.Status(403).JSON(fiber.Map{"error": "Unauthorized"})
+	product, status, message := findSellerProduct(c)
+	if product == nil {
+		return c.Status(status).JSON(fiber.Map{"error": message})
 	}
 
-	idParam := c.Params("id")
-	id64, err := strconv.ParseUint(idParam, 10, 64)
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid product id"})
+	if product.Status == models.ProductStatusBlocked {
+		return c.Status(409).JSON(fiber.Map{"error": blockedProductMessage, "moderation_note": product.ModerationNote})
 	}
 
-	var product models.Product
-	if err := config.DB.First(&product, id64).Error; err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+	if err := config.DB.Model(product).Update("status", models.ProductStatusArchived).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not delete product"})
 	}
 
-	if product.SellerID != sellerID {
-		return c.Status(403).JSON(fiber.Map{"error": "Not allowed"})
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// ✅ PublishProduct — Make a draft or archived product visible in the catalog
+func PublishProduct(c *fiber.Ctx) error {
+	return setProductStatus(c, models.ProductStatusPublished)
+}
+
+// ✅ UnpublishProduct — Move a product back to draft
+func UnpublishProduct(c *fiber.Ctx) error {
+	return setProductStatus(c, models.ProductStatusDraft)
+}
+
+func setProductStatus(c *fiber.Ctx, newStatus models.ProductStatus) error {
+	product, status, message := findSellerProduct(c)
+	if product == nil {
+		return c.Status(status).JSON(fiber.Map{"error": message})
 	}
 
-	if err := config.DB.Delete(&product).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Could not delete product"})
+	if product.Status == models.ProductStatusBlocked {
+		return c.Status(409).JSON(fiber.Map{"error": blockedProductMessage, "moderation_note": product.ModerationNote})
 	}
 
-	return c.JSON(fiber.Map{"success": true})
+	if newStatus == models.ProductStatusPublished && !sellerApproved(product.SellerID) {
+		return c.Status(403).JSON(fiber.Map{"error": unapprovedSellerMessage})
+	}
+
+	if err := config.DB.Model(product).Update("status", newStatus).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not update product status"})
+	}
+
+	return c.JSON(product)
+}
+
+// findSellerProduct loads the :id product and checks the caller owns it.
+// When the product is nil, status and message describe the error response.
+func findSellerProduct(c *fiber.Ctx) (product *models.Product, status int, message string) {
+	sellerID := c.Locals("user_id").(uint)
+
+	id64, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, 400, "Invalid product id"
+	}
+
+	var p models.Product
+	if err := config.DB.First(&p, id64).Error; err != nil {
+		return nil, 404, "Product not found"
+	}
+
+	if p.SellerID != sellerID {
+		return nil, 403, "Not allowed"
+	}
+
+	return &p, 0, ""
 }
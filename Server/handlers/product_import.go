@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// productSheetColumns is the column layout shared by import and export
+var productSheetColumns = []string{"sku", "name", "description", "price", "stock", "image_url", "status", "weight_kg", "category"}
+
+// maxImportRows caps the size of a single import file
+const maxImportRows = 5000
+
+// ImportRowError describes a problem with one row of an import file
+type ImportRowError struct {
+	Row   int    `json:"row"` // 1-based, counting the header row
+	Field string `json:"field,omitempty"`
+	Error string `json:"error"`
+}
+
+type importRow struct {
+	row     int
+	product models.Product
+	status  string // empty keeps the current status (or draft for new products)
+
+	hasWeight      bool // weight_kg is optional; blank keeps the current weight
+	hasCategory    bool // category is optional; a missing column keeps the current category
+	hasDescription bool // A missing description column keeps the current description
+	hasImageURL    bool // A missing image_url column keeps the current image
+}
+
+// ✅ ImportProducts — Bulk create/update the seller's products from CSV or XLSX, upserting by SKU.
+// Pass ?dry_run=true to validate the file without saving anything.
+func ImportProducts(c *fiber.Ctx) error {
+	sellerID := c.Locals("user_id").(uint)
+
+	dryRun := c.QueryBool("dry_run", false)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "A CSV or XLSX file is required in the 'file' field"})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Could not read uploaded file"})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Could not read uploaded file"})
+	}
+
+	var records [][]string
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".xlsx":
+		records, err = services.ReadXLSX(bytes.NewReader(data), int64(len(data)), maxImportRows+1)
+	case ".csv", "":
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		records, err = reader.ReadAll()
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Unsupported file type. Upload a .csv or .xlsx file"})
+	}
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Could not parse file", "details": err.Error()})
+	}
+
+	if len(records) < 2 {
+		return c.Status(400).JSON(fiber.Map{"error": "File has no product rows"})
+	}
+	if len(records)-1 > maxImportRows {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Too many rows (max %d)", maxImportRows)})
+	}
+
+	rowErrors := []ImportRowError{}
+	columns, headerErrors := mapImportHeader(records[0])
+	rowErrors = append(rowErrors, headerErrors...)
+	var rows []importRow
+	if len(rowErrors) == 0 {
+		var parseErrors []ImportRowError
+		rows, parseErrors = parseImportRows(records[1:], columns)
+		rowErrors = append(rowErrors, parseErrors...)
+	}
+
+	// Sellers can import drafts while their application is under review
+	if !sellerApproved(sellerID) {
+		for _, row := range rows {
+			if models.ProductStatus(row.status) == models.ProductStatusPublished {
+				rowErrors = append(rowErrors, ImportRowError{Row: row.row, Field: "status", Error: unapprovedSellerMessage})
+			}
+		}
+	}
+
+	// Look up existing products by SKU so we can report creates vs updates
+	skus := make([]string, 0, len(rows))
+	for _, row := range rows {
+		skus = append(skus, row.product.SKU)
+	}
+	existing := make(map[string]models.Product)
+	if len(skus) > 0 {
+		var products []models.Product
+		if err := config.DB.Where("seller_id = ? AND sku IN ?", sellerID, skus).Find(&products).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not fetch products"})
+		}
+		for _, product := range products {
+			existing[product.SKU] = product
+		}
+	}
+
+	created, updated := 0, 0
+	for _, row := range rows {
+		if _, ok := existing[row.product.SKU]; ok {
+			updated++
+		} else {
+			created++
+		}
+	}
+
+	result := fiber.Map{
+		"dry_run": dryRun,
+		"rows":    len(records) - 1,
+		"created": created,
+		"updated": updated,
+		"errors":  rowErrors,
+	}
+
+	if len(rowErrors) > 0 {
+		// Nothing is saved unless the whole file is valid
+		result["created"] = 0
+		result["updated"] = 0
+		return c.Status(422).JSON(result)
+	}
+	if dryRun {
+		return c.JSON(result)
+	}
+
+	var changed [][2]models.Product
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			product, ok := existing[row.product.SKU]
+			before := product
+			if !ok {
+				product = models.Product{SellerID: sellerID, SKU: row.product.SKU, Status: models.ProductStatusDraft}
+			}
+			product.Name = row.product.Name
+			product.Price = row.product.Price
+			product.Stock = row.product.Stock
+			if row.hasDescription {
+				product.Description = row.product.Description
+			}
+			if row.hasImageURL {
+				product.ImageURL = row.product.ImageURL
+			}
+			if row.hasWeight {
+				product.WeightKg = row.product.WeightKg
+			}
+			if row.hasCategory {
+				product.Category = row.product.Category
+			}
+			// Blocked products keep their status until a moderator lifts the block
+			if row.status != "" && product.Status != models.ProductStatusBlocked {
+				product.Status = models.ProductStatus(row.status)
+			}
+
+			if err := tx.Save(&product).Error; err != nil {
+				return fmt.Errorf("row %d: %v", row.row, err)
+			}
+			if ok {
+				changed = append(changed, [2]models.Product{before, product})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not import products", "details": err.Error()})
+	}
+
+	for _, pair := range changed {
+		notifyWishlistWatchers(pair[0], pair[1])
+	}
+
+	fmt.Printf("📦 Seller %d imported products: %d created, %d updated\n", sellerID, created, updated)
+	return c.JSON(result)
+}
+
+// ✅ ExportProducts — Download the seller's products in the import format (?format=csv|xlsx)
+func ExportProducts(c *fiber.Ctx) error {
+	sellerID := c.Locals("user_id").(uint)
+
+	var products []models.Product
+	if err := config.DB.Where("seller_id = ?", sellerID).Order("id ASC").Find(&products).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch products"})
+	}
+
+	records := [][]string{productSheetColumns}
+	for _, p := range products {
+		records = append(records, []string{
+			p.SKU,
+			p.Name,
+			p.Description,
+			strconv.FormatFloat(p.Price, 'f', 2, 64),
+			strconv.Itoa(p.Stock),
+			p.ImageURL,
+			string(p.Status),
+			strconv.FormatFloat(p.WeightKg, 'f', -1, 64),
+			p.Category,
+		})
+	}
+
+	var buf bytes.Buffer
+	switch c.Query("format", "csv") {
+	case "xlsx":
+		if err := services.WriteXLSX(&buf, "Products", records, 3, 4, 7); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not export products"})
+		}
+		c.Set(fiber.HeaderContentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="products.xlsx"`)
+	case "csv":
+		writer := csv.NewWriter(&buf)
+		if err := writer.WriteAll(records); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Could not export products"})
+		}
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="products.csv"`)
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid format. Must be one of: csv, xlsx"})
+	}
+
+	return c.Send(buf.Bytes())
+}
+
+// mapImportHeader returns the index of each known column in the header row
+func mapImportHeader(header []string) (map[string]int, []ImportRowError) {
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		for _, known := range productSheetColumns {
+			if name == known {
+				columns[name] = i
+			}
+		}
+	}
+
+	var errors []ImportRowError
+	for _, required := range []string{"sku", "name", "price", "stock"} {
+		if _, ok := columns[required]; !ok {
+			errors = append(errors, ImportRowError{Row: 1, Field: required, Error: "Missing required column"})
+		}
+	}
+	return columns, errors
+}
+
+// parseImportRows converts data rows to products, collecting every row-level error
+func parseImportRows(records [][]string, columns map[string]int) ([]importRow, []ImportRowError) {
+	var rows []importRow
+	var errors []ImportRowError
+	seenSKUs := make(map[string]int)
+
+	for i, record := range records {
+		rowNum := i + 2
+		get := func(column string) string {
+			idx, ok := columns[column]
+			if !ok || idx >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[idx])
+		}
+
+		// Skip blank lines
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		rowErrors := len(errors)
+		row := importRow{row: rowNum}
+		row.product.SKU = get("sku")
+		row.product.Name = get("name")
+		row.product.Description = get("description")
+		row.product.ImageURL = get("image_url")
+		_, row.hasDescription = columns["description"]
+		_, row.hasImageURL = columns["image_url"]
+		row.status = strings.ToLower(get("status"))
+		_, row.hasCategory = columns["category"]
+		row.product.Category = models.NormalizeCategory(get("category"))
+
+		if row.product.SKU == "" {
+			errors = append(errors, ImportRowError{Row: rowNum, Field: "sku", Error: "SKU is required"})
+		} else if first, dup := seenSKUs[row.product.SKU]; dup {
+			errors = append(errors, ImportRowError{Row: rowNum, Field: "sku", Error: fmt.Sprintf("Duplicate SKU (first seen on row %d)", first)})
+		} else {
+			seenSKUs[row.product.SKU] = rowNum
+		}
+
+		unparsable := make(map[string]bool)
+		price, err := strconv.ParseFloat(get("price"), 64)
+		if err != nil {
+			unparsable["price"] = true
+			errors = append(errors, ImportRowError{Row: rowNum, Field: "price", Error: "Price must be a number"})
+		}
+		row.product.Price = price
+
+		stock, err := strconv.Atoi(get("stock"))
+		if err != nil {
+			unparsable["stock"] = true
+			errors = append(errors, ImportRowError{Row: rowNum, Field: "stock", Error: "Stock must be a whole number"})
+		}
+		row.product.Stock = stock
+
+		if weight := get("weight_kg"); weight != "" {
+			row.hasWeight = true
+			row.product.WeightKg, err = strconv.ParseFloat(weight, 64)
+			if err != nil {
+				unparsable["weight_kg"] = true
+				errors = append(errors, ImportRowError{Row: rowNum, Field: "weight_kg", Error: "Weight must be a number"})
+			}
+		}
+
+		// Apply the same rules as POST /seller/products
+		fieldErrors := middleware.ValidateStruct(ProductInput{
+			SKU:         row.product.SKU,
+			Name:        row.product.Name,
+			Price:       row.product.Price,
+			Description: row.product.Description,
+			ImageURL:    row.product.ImageURL,
+			Stock:       row.product.Stock,
+			WeightKg:    row.product.WeightKg,
+			Category:    row.product.Category,
+		})
+		for _, fe := range fieldErrors {
+			if unparsable[fe.Field] {
+				continue
+			}
+			errors = append(errors, ImportRowError{Row: rowNum, Field: fe.Field, Error: fe.Message})
+		}
+
+		switch models.ProductStatus(row.status) {
+		case "", models.ProductStatusDraft, models.ProductStatusPublished, models.ProductStatusArchived:
+		default:
+			errors = append(errors, ImportRowError{Row: rowNum, Field: "status", Error: "Status must be one of: draft, published, archived"})
+		}
+
+		if len(errors) == rowErrors {
+			rows = append(rows, row)
+		}
+	}
+	return rows, errors
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestImportProductsKeepsMissingColumns(t *testing.T) {
+	db := setupTestDB(t)
+	seller := createTestUser(t, db, "seller@example.com", models.RoleSeller)
+	token := accessToken(t, db, seller)
+	db.Create(&models.Product{SellerID: seller.ID, SKU: "TEFF-1", Name: "Teff", Description: "White teff", ImageURL: "/uploads/teff.jpg",
+		Price: 100, Stock: 5, Status: models.ProductStatusDraft})
+
+	app := fiber.New()
+	app.Post("/import", middleware.RequireAuth, ImportProducts)
+
+	tests := []struct {
+		name            string
+		csv             string
+		wantDescription string
+		wantImageURL    string
+	}{
+		{"columns missing keep the current values", "sku,name,price,stock\nTEFF-1,Teff flour,110,4\n", "White teff", "/uploads/teff.jpg"},
+		{"columns present replace them", "sku,name,price,stock,description,image_url\nTEFF-1,Teff flour,110,4,Brown teff,https://cdn.example.com/brown.jpg\n", "Brown teff", "https://cdn.example.com/brown.jpg"},
+		{"blank cells clear them", "sku,name,price,stock,description,image_url\nTEFF-1,Teff flour,110,4,,\n", "", ""},
+	}
+	for _, tt := range tests {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "products.csv")
+		part.Write([]byte(tt.csv))
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/import", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 200 {
+			var result map[string]interface{}
+			json.NewDecoder(res.Body).Decode(&result)
+			t.Fatalf("%s: import returned %d %v", tt.name, res.StatusCode, result)
+		}
+
+		var product models.Product
+		db.Where("sku = ?", "TEFF-1").First(&product)
+		if product.Name != "Teff flour" || product.Description != tt.wantDescription || product.ImageURL != tt.wantImageURL {
+			t.Errorf("%s: got name %q, description %q, image %q", tt.name, product.Name, product.Description, product.ImageURL)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LocaleInput is the language a user wants their emails in
+type LocaleInput struct {
+	Locale string `json:"locale" validate:"required,oneof=en am om"`
+}
+
+// UpdateLocale sets the language the user's emails are sent in
+func UpdateLocale(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var input LocaleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	if err := config.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("locale", input.Locale).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update language"})
+	}
+
+	return c.JSON(fiber.Map{"locale": input.Locale})
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// PromotionInput represents the request for creating a promotion.
+// Leave Code empty for an automatic discount.
+type PromotionInput struct {
+	Code           string     `json:"code" validate:"omitempty,alphanum,min=3,max=32"`
+	Name           string     `json:"name" validate:"required,max=100"`
+	Type           string     `json:"type" validate:"required,oneof=percentage fixed"`
+	Value          float64    `json:"value" validate:"gt=0"`
+	MaxDiscount    float64    `json:"max_discount" validate:"gte=0"`
+	MinOrderAmount float64    `json:"min_order_amount" validate:"gte=0"`
+	UsageLimit     int        `json:"usage_limit" validate:"gte=0"`
+	PerUserLimit   int        `json:"per_user_limit" validate:"gte=0"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+}
+
+// QuoteRequest represents a cart to price before payment
+type QuoteRequest struct {
+	CouponCode    string           `json:"coupon_code"`
+	ShippingCity  string           `json:"shipping_city"`
+	ShippingState string           `json:"shipping_state"`
+	Items         []OrderItemInput `json:"items" validate:"required,min=1,dive"`
+}
+
+// QuoteOrder prices a cart with discounts so checkout can show the amount to pay
+func QuoteOrder(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var req QuoteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	quote, err := buildOrderQuote(config.DB, user, req.Items, req.CouponCode,
+		shippingDestination{City: req.ShippingCity, State: req.ShippingState})
+	if err != nil {
+		if _, ok := err.(*quoteError); ok {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to price order"})
+	}
+
+	return c.JSON(fiber.Map{"quote": quote.response()})
+}
+
+// CreateSellerPromotion creates a coupon or automatic discount on the seller's own products
+func CreateSellerPromotion(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	promotion, status, body := createPromotion(c, &user.ID)
+	if promotion == nil {
+		return c.Status(status).JSON(body)
+	}
+	return c.Status(201).JSON(fiber.Map{"promotion": promotion})
+}
+
+// GetSellerPromotions lists the seller's promotions
+func GetSellerPromotions(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var promotions []models.Promotion
+	if err := config.DB.Where("seller_id = ?", user.ID).Order("created_at DESC").Find(&promotions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch promotions"})
+	}
+	return c.JSON(fiber.Map{"promotions": promotions})
+}
+
+// DeactivateSellerPromotion stops a seller's promotion from being applied
+func DeactivateSellerPromotion(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	result := config.DB.Model(&models.Promotion{}).
+		Where("id = ? AND seller_id = ?", c.Params("id"), user.ID).
+		Update("active", false)
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to deactivate promotion"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Promotion not found"})
+	}
+	return c.JSON(fiber.Map{"message": "Promotion deactivated"})
+}
+
+// GetPlatformPromotions lists the marketplace-wide promotions (admin)
+func GetPlatformPromotions(c *fiber.Ctx) error {
+	var promotions []models.Promotion
+	if err := config.DB.Where("seller_id IS NULL").Order("created_at DESC").Find(&promotions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch promotions"})
+	}
+	return c.JSON(fiber.Map{"promotions": promotions})
+}
+
+// CreatePlatformPromotion creates a discount funded by the marketplace that applies to every product (admin)
+func CreatePlatformPromotion(c *fiber.Ctx) error {
+	promotion, status, body := createPromotion(c, nil)
+	if promotion == nil {
+		return c.Status(status).JSON(body)
+	}
+	return c.Status(201).JSON(fiber.Map{"promotion": promotion})
+}
+
+// DeactivatePlatformPromotion stops a marketplace-wide promotion from being applied (admin)
+func DeactivatePlatformPromotion(c *fiber.Ctx) error {
+	var promotion models.Promotion
+	if err := config.DB.Where("id = ? AND seller_id IS NULL", c.Params("id")).First(&promotion).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Promotion not found"})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&promotion).Update("active", false).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "promotion.deactivate", "promotion", promotion.ID, "", fiber.Map{"code": promotion.Code})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to deactivate promotion"})
+	}
+	return c.JSON(fiber.Map{"message": "Promotion deactivated"})
+}
+
+// createPromotion validates the body and stores a promotion; a nil sellerID makes it platform-wide,
+// and those are audited in the same transaction as the insert.
+// When the promotion is nil, status and body describe the error response.
+func createPromotion(c *fiber.Ctx, sellerID *uint) (*models.Promotion, int, fiber.Map) {
+	var input PromotionInput
+	if err := c.BodyParser(&input); err != nil {
+		return nil, 400, fiber.Map{"error": "Invalid request body"}
+	}
+	input.Code = models.NormalizeCouponCode(input.Code)
+
+	fieldErrors := middleware.ValidateStruct(input)
+	if input.Type == string(models.PromotionTypePercentage) && input.Value > 100 {
+		fieldErrors = append(fieldErrors, middleware.FieldError{Field: "value", Rule: "max", Message: "value must be at most 100 for percentage promotions"})
+	}
+	if input.StartsAt != nil && input.EndsAt != nil && !input.EndsAt.After(*input.StartsAt) {
+		fieldErrors = append(fieldErrors, middleware.FieldError{Field: "ends_at", Rule: "gtfield", Message: "ends_at must be after starts_at"})
+	}
+	if len(fieldErrors) > 0 {
+		return nil, 400, fiber.Map{"error": "Validation failed", "fields": fieldErrors}
+	}
+
+	if input.Code != "" {
+		var existing int64
+		config.DB.Model(&models.Promotion{}).Where("code = ?", input.Code).Count(&existing)
+		if existing > 0 {
+			return nil, 409, fiber.Map{"error": "A promotion with this code already exists"}
+		}
+	}
+
+	promotion := models.Promotion{
+		Code:           input.Code,
+		Name:           input.Name,
+		Type:           models.PromotionType(input.Type),
+		Value:          input.Value,
+		MaxDiscount:    input.MaxDiscount,
+		SellerID:       sellerID,
+		MinOrderAmount: input.MinOrderAmount,
+		UsageLimit:     input.UsageLimit,
+		PerUserLimit:   input.PerUserLimit,
+		StartsAt:       input.StartsAt,
+		EndsAt:         input.EndsAt,
+		Active:         true,
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&promotion).Error; err != nil {
+			return err
+		}
+		if sellerID != nil {
+			return nil
+		}
+		return recordAudit(tx, c, "promotion.create", "promotion", promotion.ID, "", fiber.Map{
+			"code":  promotion.Code,
+			"type":  promotion.Type,
+			"value": promotion.Value,
+		})
+	})
+	if err != nil {
+		return nil, 500, fiber.Map{"error": "Failed to create promotion"}
+	}
+	return &promotion, 0, nil
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// CreateReviewRequest represents the request for reviewing a product
+type CreateReviewRequest struct {
+	Rating int      `json:"rating" validate:"required,min=1,max=5"`
+	Body   string   `json:"body" validate:"max=2000"`
+	Photos []string `json:"photos" validate:"max=5,dive,http_url"`
+}
+
+// ReviewReplyRequest represents a seller's reply to a review
+type ReviewReplyRequest struct {
+	Reply string `json:"reply" validate:"required,max=2000"`
+}
+
+// ReviewFlagRequest represents a report about an inappropriate review
+type ReviewFlagRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// reviewResponse is the public view of a review (reviewer first name only)
+func reviewResponse(review models.Review) fiber.Map {
+	reviewer := strings.SplitN(strings.TrimSpace(review.User.Name), " ", 2)[0]
+	return fiber.Map{
+		"id":                review.ID,
+		"product_id":        review.ProductID,
+		"rating":            review.Rating,
+		"body":              review.Body,
+		"photos":            review.Photos,
+		"reviewer":          reviewer,
+		"verified_purchase": true,
+		"seller_reply":      review.SellerReply,
+		"seller_replied_at": review.SellerRepliedAt,
+		"created_at":        review.CreatedAt,
+	}
+}
+
+// GetProductReviews lists the visible reviews for a product
+func GetProductReviews(c *fiber.Ctx) error {
+	productID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid product id"})
+	}
+
+	var product models.Product
+	if err := config.DB.Unscoped().First(&product, productID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+	}
+
+	var reviews []models.Review
+	if err := config.DB.Preload("User").Preload("Photos").
+		Where("product_id = ? AND status = ?", productID, models.ReviewStatusVisible).
+		Order("created_at DESC").
+		Find(&reviews).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch reviews"})
+	}
+
+	results := make([]fiber.Map, 0, len(reviews))
+	for _, review := range reviews {
+		results = append(results, reviewResponse(review))
+	}
+
+	return c.JSON(fiber.Map{
+		"reviews": results,
+		"rating": fiber.Map{
+			"average": product.RatingAverage,
+			"count":   product.RatingCount,
+		},
+	})
+}
+
+// CreateReview lets a buyer review a product they have received
+func CreateReview(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	productID, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid product id"})
+	}
+
+	var req CreateReviewRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	// Only buyers with a delivered order containing this product may review it
+	var orderItem models.OrderItem
+	if err := config.DB.
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.user_id = ? AND orders.status = ? AND order_items.product_id = ?",
+			user.ID, models.OrderStatusDelivered, productID).
+		Order("order_items.created_at DESC").
+		First(&orderItem).Error; err != nil {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "You can only review products from your delivered orders",
+		})
+	}
+
+	var existing int64
+	config.DB.Model(&models.Review{}).Where("product_id = ? AND user_id = ?", productID, user.ID).Count(&existing)
+	if existing > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "You have already reviewed this product"})
+	}
+
+	review := models.Review{
+		ProductID:   uint(productID),
+		UserID:      user.ID,
+		OrderItemID: orderItem.ID,
+		Rating:      req.Rating,
+		Body:        strings.TrimSpace(req.Body),
+		Status:      models.ReviewStatusVisible,
+	}
+	for _, url := range req.Photos {
+		review.Photos = append(review.Photos, models.ReviewPhoto{URL: url})
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		return models.RefreshProductRating(tx, review.ProductID)
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create review"})
+	}
+
+	review.User = user
+	return c.Status(201).JSON(fiber.Map{
+		"message": "Review submitted successfully",
+		"review":  reviewResponse(review),
+	})
+}
+
+// ReplyToReview lets the seller of the reviewed product respond publicly
+func ReplyToReview(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var req ReviewReplyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var review models.Review
+	if err := config.DB.Preload("User").Preload("Photos").
+		Joins("JOIN products ON products.id = reviews.product_id").
+		Where("reviews.id = ? AND products.seller_id = ?", c.Params("id"), user.ID).
+		First(&review).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Review not found or you don't have permission to reply"})
+	}
+
+	now := time.Now()
+	review.SellerReply = strings.TrimSpace(req.Reply)
+	review.SellerRepliedAt = &now
+	if err := config.DB.Model(&review).Updates(map[string]interface{}{
+		"seller_reply":      review.SellerReply,
+		"seller_replied_at": review.SellerRepliedAt,
+	}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save reply"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Reply saved successfully",
+		"review":  reviewResponse(review),
+	})
+}
+
+// FlagReview reports a review for moderation. Reviews with enough flags are hidden
+// from the product page until a moderator restores them.
+func FlagReview(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var req ReviewFlagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var review models.Review
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&review).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Review not found"})
+	}
+
+	var existing int64
+	config.DB.Model(&models.ReviewFlag{}).Where("review_id = ? AND user_id = ?", review.ID, user.ID).Count(&existing)
+	if existing > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "You have already flagged this review"})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		flag := models.ReviewFlag{ReviewID: review.ID, UserID: user.ID, Reason: strings.TrimSpace(req.Reason)}
+		if err := tx.Create(&flag).Error; err != nil {
+			return err
+		}
+
+		// Count in the database, so flags sent at the same time are all counted
+		if err := tx.Model(&models.Review{}).Where("id = ?", review.ID).
+			UpdateColumn("flag_count", gorm.Expr("flag_count + 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("flag_count", "status").Where("id = ?", review.ID).First(&review).Error; err != nil {
+			return err
+		}
+		if review.FlagCount >= models.ReviewFlagThreshold && review.Status == models.ReviewStatusVisible {
+			if err := tx.Model(&models.Review{}).
+				Where("id = ? AND status = ?", review.ID, models.ReviewStatusVisible).
+				Update("status", models.ReviewStatusFlagged).Error; err != nil {
+				return err
+			}
+		}
+		return models.RefreshProductRating(tx, review.ProductID)
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to flag review"})
+	}
+
+	fmt.Printf("🚩 Review %d flagged by user %d (%d flags)\n", review.ID, user.ID, review.FlagCount)
+
+	return c.JSON(fiber.Map{"message": "Thanks, the review has been reported"})
+}
@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// unapprovedSellerMessage is returned when a seller tries to publish before their KYC review passes
+const unapprovedSellerMessage = "Your shop must be approved before you can publish products"
+
+// kycDocumentColumns maps the document kinds a seller can upload to their column
+var kycDocumentColumns = map[string]string{
+	models.KYCDocumentTradeLicense: "trade_license_file",
+	models.KYCDocumentNationalID:   "national_id_file",
+}
+
+// sellerApproved reports whether a seller has passed KYC review
+func sellerApproved(sellerID uint) bool {
+	var count int64
+	config.DB.Model(&models.User{}).Where("id = ? AND seller_approved_at IS NOT NULL", sellerID).Count(&count)
+	return count > 0
+}
+
+// createSellerApplication starts onboarding for a newly verified seller in tx
+func createSellerApplication(tx *gorm.DB, email string) error {
+	var userID uint
+	if err := tx.Model(&models.User{}).Select("id").Where("email = ?", email).Scan(&userID).Error; err != nil {
+		return err
+	}
+	if userID == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return tx.Where(models.SellerApplication{UserID: userID}).FirstOrCreate(&models.SellerApplication{}).Error
+}
+
+// sellerApplicationFor loads a seller's application. Sellers who registered before
+// onboarding existed get one on first use, already approved if an admin approved them.
+func sellerApplicationFor(seller models.User) (models.SellerApplication, error) {
+	status := models.SellerApplicationApplied
+	if seller.SellerApprovedAt != nil {
+		status = models.SellerApplicationApproved
+	}
+
+	var application models.SellerApplication
+	err := config.DB.Where(models.SellerApplication{UserID: seller.ID}).
+		Attrs(models.SellerApplication{Status: status}).
+		FirstOrCreate(&application).Error
+	return application, err
+}
+
+// sellerApplicationView is the application as shown to the seller and to reviewers
+func sellerApplicationView(application models.SellerApplication) fiber.Map {
+	return fiber.Map{
+		"id":               application.ID,
+		"status":           application.Status,
+		"documents":        application.Documents(),
+		"submitted_at":     application.SubmittedAt,
+		"reviewed_at":      application.ReviewedAt,
+		"rejection_reason": application.RejectionReason,
+		"created_at":       application.CreatedAt,
+	}
+}
+
+// GetSellerApplication returns the signed-in seller's onboarding status
+func GetSellerApplication(c *fiber.Ctx) error {
+	application, err := sellerApplicationFor(c.Locals("user").(models.User))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load application"})
+	}
+	return c.JSON(sellerApplicationView(application))
+}
+
+// UploadSellerDocument stores the trade licence or national ID scan sent in the "file"
+// field, replacing any earlier upload. Documents are locked while under review.
+func UploadSellerDocument(c *fiber.Ctx) error {
+	kind := c.Params("kind")
+	column, ok := kycDocumentColumns[kind]
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Document must be one of: trade_license, national_id"})
+	}
+
+	user := c.Locals("user").(models.User)
+	application, err := sellerApplicationFor(user)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load application"})
+	}
+	if !application.Editable() {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("Documents can't be changed while the application is %s", application.Status)})
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "A PDF, JPEG or PNG file is required in the 'file' field"})
+	}
+	if fileHeader.Size > services.MaxKYCDocumentSize {
+		return c.Status(400).JSON(fiber.Map{"error": "Document must be 5MB or smaller"})
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Could not read uploaded file"})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, services.MaxKYCDocumentSize+1))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Could not read uploaded file"})
+	}
+	if len(data) > services.MaxKYCDocumentSize {
+		return c.Status(400).JSON(fiber.Map{"error": "Document must be 5MB or smaller"})
+	}
+
+	name, err := services.SaveKYCDocument(user.ID, kind, data)
+	if errors.Is(err, services.ErrUnsupportedDocument) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("❌ Failed to store %s for seller %d: %v", kind, user.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to store document"})
+	}
+
+	// Only replace the document if the application wasn't submitted in the meantime
+	result := config.DB.Model(&models.SellerApplication{}).
+		Where("id = ? AND status IN ?", application.ID, []models.SellerApplicationStatus{models.SellerApplicationApplied, models.SellerApplicationRejected}).
+		Update(column, name)
+	if result.Error != nil || result.RowsAffected == 0 {
+		services.RemoveKYCDocument(name)
+		if result.Error != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to save document"})
+		}
+		return c.Status(409).JSON(fiber.Map{"error": "Application changed, please reload and try again"})
+	}
+	services.RemoveKYCDocument(application.DocumentFile(kind))
+
+	var updated models.SellerApplication
+	config.DB.First(&updated, application.ID)
+	return c.JSON(fiber.Map{"message": "Document uploaded", "application": sellerApplicationView(updated)})
+}
+
+// SubmitSellerApplication sends the uploaded documents for review
+func SubmitSellerApplication(c *fiber.Ctx) error {
+	application, err := sellerApplicationFor(c.Locals("user").(models.User))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load application"})
+	}
+	if !application.CanTransitionTo(models.SellerApplicationDocumentsSubmitted) {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("A %s application can't be submitted", application.Status)})
+	}
+
+	var missing []string
+	for _, kind := range []string{models.KYCDocumentTradeLicense, models.KYCDocumentNationalID} {
+		if application.DocumentFile(kind) == "" {
+			missing = append(missing, kind)
+		}
+	}
+	if len(missing) > 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Upload all documents before submitting", "missing": missing})
+	}
+
+	now := time.Now()
+	result := config.DB.Model(&models.SellerApplication{}).
+		Where("id = ? AND status = ?", application.ID, application.Status).
+		Updates(map[string]interface{}{
+			"status":           models.SellerApplicationDocumentsSubmitted,
+			"submitted_at":     now,
+			"reviewed_at":      nil,
+			"reviewed_by":      nil,
+			"rejection_reason": "",
+		})
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to submit application"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Application changed, please reload and try again"})
+	}
+
+	var updated models.SellerApplication
+	config.DB.First(&updated, application.ID)
+	return c.JSON(fiber.Map{"message": "Application submitted for review", "application": sellerApplicationView(updated)})
+}
+
+// GetSellerApplications lists applications for review, oldest submission first.
+// ?status filters (default documents_submitted; "all" lists every application).
+func GetSellerApplications(c *fiber.Ctx) error {
+	page, limit := pagination(c)
+
+	query := config.DB.Model(&models.SellerApplication{})
+	if status := c.Query("status", string(models.SellerApplicationDocumentsSubmitted)); status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var applications []models.SellerApplication
+	if err := query.Preload("User").
+		Order("submitted_at ASC, created_at ASC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&applications).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch applications"})
+	}
+
+	views := make([]fiber.Map, 0, len(applications))
+	for _, application := range applications {
+		view := sellerApplicationView(application)
+		view["seller"] = applicationSeller(application.User)
+		views = append(views, view)
+	}
+
+	return c.JSON(fiber.Map{"applications": views, "total": total, "page": page, "limit": limit})
+}
+
+// GetAdminSellerApplication returns an application with the review actions taken on it
+func GetAdminSellerApplication(c *fiber.Ctx) error {
+	application, ok := findSellerApplication(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Application not found"})
+	}
+
+	var history []models.AuditLog
+	config.DB.Where("target_type = ? AND target_id = ?", "seller_application", application.ID).Order("created_at DESC").Find(&history)
+
+	view := sellerApplicationView(application)
+	view["seller"] = applicationSeller(application.User)
+	view["reviewed_by"] = application.ReviewedBy
+	return c.JSON(fiber.Map{"application": view, "audit_log": history})
+}
+
+// GetSellerApplicationDocument sends a KYC document to a reviewer. Every download is audited.
+func GetSellerApplicationDocument(c *fiber.Ctx) error {
+	application, ok := findSellerApplication(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Application not found"})
+	}
+
+	kind := c.Params("kind")
+	name := application.DocumentFile(kind)
+	if name == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "Document not found"})
+	}
+
+	if err := recordAudit(config.DB, c, "seller_application.view_document", "seller_application", application.ID, "", fiber.Map{"document": kind}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record document access"})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.SendFile(services.KYCDocumentPath(name))
+}
+
+// ApproveSellerApplication approves a submitted application so the seller can publish
+// products, and emails the seller
+func ApproveSellerApplication(c *fiber.Ctx) error {
+	application, ok := findSellerApplication(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Application not found"})
+	}
+	if !application.CanTransitionTo(models.SellerApplicationApproved) {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("A %s application can't be approved", application.Status)})
+	}
+
+	seller := application.User
+	err := reviewSellerApplication(c, application, models.SellerApplicationApproved, "", func(tx *gorm.DB, now time.Time) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", seller.ID).Update("seller_approved_at", now).Error; err != nil {
+			return err
+		}
+		return services.NewEmailService().Queue(tx).InLocale(seller.Locale).
+			SendSellerApprovedEmail(seller.Email, seller.Name, seller.ShopName)
+	})
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(409).JSON(fiber.Map{"error": "Application changed, please reload and try again"})
+	}
+	if err != nil {
+		log.Printf("❌ Failed to approve seller application %d: %v", application.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to approve application"})
+	}
+
+	log.Printf("✅ Seller %d (%s) approved by admin %d", seller.ID, seller.ShopName, c.Locals("user_id").(uint))
+	return c.JSON(fiber.Map{"message": "Seller approved"})
+}
+
+// RejectSellerApplication sends a submitted application back to the seller with the
+// reason, so they can upload corrected documents and submit again
+func RejectSellerApplication(c *fiber.Ctx) error {
+	var input AdminActionInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	application, ok := findSellerApplication(c)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Application not found"})
+	}
+	if !application.CanTransitionTo(models.SellerApplicationRejected) {
+		return c.Status(409).JSON(fiber.Map{"error": fmt.Sprintf("A %s application can't be rejected", application.Status)})
+	}
+
+	seller := application.User
+	err := reviewSellerApplication(c, application, models.SellerApplicationRejected, input.Reason, func(tx *gorm.DB, now time.Time) error {
+		return services.NewEmailService().Queue(tx).InLocale(seller.Locale).
+			SendSellerRejectedEmail(seller.Email, seller.Name, seller.ShopName, input.Reason)
+	})
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(409).JSON(fiber.Map{"error": "Application changed, please reload and try again"})
+	}
+	if err != nil {
+		log.Printf("❌ Failed to reject seller application %d: %v", application.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reject application"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Application rejected"})
+}
+
+// reviewSellerApplication records an admin's decision on an application together with
+// the audit entry and whatever else the decision needs (then)
+func reviewSellerApplication(c *fiber.Ctx, application models.SellerApplication, status models.SellerApplicationStatus, reason string, then func(tx *gorm.DB, now time.Time) error) error {
+	adminID := c.Locals("user_id").(uint)
+	now := time.Now()
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		// Only apply the decision if nobody reviewed the application in the meantime
+		result := tx.Model(&models.SellerApplication{}).
+			Where("id = ? AND status = ?", application.ID, application.Status).
+			Updates(map[string]interface{}{
+				"status":           status,
+				"reviewed_at":      now,
+				"reviewed_by":      adminID,
+				"rejection_reason": reason,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := then(tx, now); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "seller_application."+string(status), "seller_application", application.ID, reason, fiber.Map{
+			"user_id":   application.UserID,
+			"shop_name": application.User.ShopName,
+		})
+	})
+}
+
+// findSellerApplication loads the :id application an admin endpoint acts on
+func findSellerApplication(c *fiber.Ctx) (models.SellerApplication, bool) {
+	var application models.SellerApplication
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return application, false
+	}
+	if err := config.DB.Preload("User").Where("id = ?", id).First(&application).Error; err != nil {
+		return application, false
+	}
+	return application, true
+}
+
+// applicationSeller is the part of the seller's account a reviewer needs
+func applicationSeller(seller models.User) fiber.Map {
+	return fiber.Map{
+		"id":         seller.ID,
+		"name":       seller.Name,
+		"email":      seller.Email,
+		"shop_name":  seller.ShopName,
+		"address":    seller.Address,
+		"created_at": seller.CreatedAt,
+	}
+}
@@ -1,26 +1,35 @@
 package handlers
 
 import (
+	"fmt"
 	"sync"
 	"time"
+
+	"injera-gebeya-platform/Server/config"
 )
 
+// pendingOrderTTL is how long a checkout waits for its payment
+const pendingOrderTTL = time.Hour
+
 // PendingOrder represents a pending order waiting for payment confirmation
 type PendingOrder struct {
-	UserID          uint   `json:"user_id"`
-	ShippingAddress string `json:"shipping_address"`
-	ShippingCity    string `json:"shipping_city"`
-	ShippingState   string `json:"shipping_state"`
-	ShippingZip     string `json:"shipping_zip"`
-	ShippingPhone   string `json:"shipping_phone"`
-	Notes           string `json:"notes"`
-	PaymentMethod   string `json:"payment_method"`
-	Items           []struct {
-		ProductID uint `json:"product_id"`
-		Quantity  int  `json:"quantity"`
-	} `json:"items"`
-	TotalAmount float64   `json:"total_amount"`
-	CreatedAt   time.Time `json:"created_at"`
+	UserID          uint             `json:"user_id"`
+	ShippingAddress string           `json:"shipping_address"`
+	ShippingCity    string           `json:"shipping_city"`
+	ShippingState   string           `json:"shipping_state"`
+	ShippingZip     string           `json:"shipping_zip"`
+	ShippingPhone   string           `json:"shipping_phone"`
+	Notes           string           `json:"notes"`
+	PaymentMethod   string           `json:"payment_method"`
+	CouponCode      string           `json:"coupon_code"`
+	Items           []OrderItemInput `json:"items"`
+	TotalAmount     float64          `json:"total_amount"` // Server-computed amount to charge
+	CreatedAt       time.Time        `json:"created_at"`
+
+	// The order is built from the quote the buyer paid, even if prices, rates or the
+	// promotion change before the payment is confirmed
+	Quote        *orderQuote `json:"-"`
+	RedemptionID uint        `json:"-"` // Promotion use reserved until the payment completes or fails
 }
 
 // SessionStorage stores pending orders temporarily
@@ -55,14 +64,52 @@ func (s *SessionStorage) DeletePendingOrder(txRef string) {
 	delete(s.orders, txRef)
 }
 
-// CleanupExpiredOrders removes orders older than 1 hour
-func (s *SessionStorage) CleanupExpiredOrders() {
+// TakePendingOrder removes and returns a pending order, so only one of the callback and
+// the verify request builds the order for a payment
+func (s *SessionStorage) TakePendingOrder(txRef string) (*PendingOrder, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	order, exists := s.orders[txRef]
+	delete(s.orders, txRef)
+	return order, exists
+}
+
+// CleanupExpiredOrders removes orders older than pendingOrderTTL and gives back the
+// promotion uses they reserved
+func (s *SessionStorage) CleanupExpiredOrders() {
+	s.mu.Lock()
+	var expired []*PendingOrder
 	now := time.Now()
 	for txRef, order := range s.orders {
-		if now.Sub(order.CreatedAt) > time.Hour {
+		if now.Sub(order.CreatedAt) > pendingOrderTTL {
+			expired = append(expired, order)
 			delete(s.orders, txRef)
 		}
 	}
+	s.mu.Unlock()
+
+	for _, order := range expired {
+		releasePendingOrder(order)
+	}
+}
+
+// StartPendingOrderCleanup expires abandoned checkouts in the background until the process exits
+func StartPendingOrderCleanup() {
+	go func() {
+		ticker := time.NewTicker(pendingOrderTTL / 4)
+		defer ticker.Stop()
+		for range ticker.C {
+			sessionStorage.CleanupExpiredOrders()
+		}
+	}()
+}
+
+// releasePendingOrder gives back what a checkout that won't be paid reserved
+func releasePendingOrder(order *PendingOrder) {
+	if order.RedemptionID == 0 {
+		return
+	}
+	if err := releasePromotion(config.DB, order.RedemptionID); err != nil {
+		fmt.Printf("❌ Failed to release promotion redemption %d: %v\n", order.RedemptionID, err)
+	}
 }
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"log"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ShippingQuoteRequest represents a cart and destination to price before payment
+type ShippingQuoteRequest struct {
+	ShippingCity  string           `json:"shipping_city" validate:"required"`
+	ShippingState string           `json:"shipping_state" validate:"required"`
+	CouponCode    string           `json:"coupon_code"`
+	Items         []OrderItemInput `json:"items" validate:"required,min=1,dive"`
+}
+
+// ShippingRateInput represents a seller's rate for one zone
+type ShippingRateInput struct {
+	ZoneCode              string  `json:"zone_code" validate:"required"`
+	BaseFee               float64 `json:"base_fee" validate:"gte=0"`
+	PerKgFee              float64 `json:"per_kg_fee" validate:"gte=0"`
+	FreeShippingThreshold float64 `json:"free_shipping_threshold" validate:"gte=0"`
+}
+
+// GetShippingZones lists the delivery zones
+func GetShippingZones(c *fiber.Ctx) error {
+	var zones []models.ShippingZone
+	if err := config.DB.Order("id ASC").Find(&zones).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch shipping zones"})
+	}
+	return c.JSON(fiber.Map{"zones": zones})
+}
+
+// QuoteShipping prices a cart for delivery to the given city/state, including any discount
+func QuoteShipping(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var req ShippingQuoteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	quote, err := buildOrderQuote(config.DB, user, req.Items, req.CouponCode,
+		shippingDestination{City: req.ShippingCity, State: req.ShippingState})
+	if err != nil {
+		if _, ok := err.(*quoteError); ok {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to price order"})
+	}
+
+	return c.JSON(fiber.Map{"quote": quote.response()})
+}
+
+// GetSellerShippingRates lists the seller's own rates per zone
+func GetSellerShippingRates(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var rates []models.ShippingRate
+	if err := config.DB.Where("seller_id = ?", user.ID).Find(&rates).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch shipping rates"})
+	}
+	return c.JSON(fiber.Map{"rates": rates})
+}
+
+// SetSellerShippingRate creates or replaces the seller's rate for a zone
+func SetSellerShippingRate(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	rate, status, body := upsertShippingRate(c, &user.ID)
+	if rate == nil {
+		return c.Status(status).JSON(body)
+	}
+	return c.JSON(fiber.Map{"rate": rate})
+}
+
+// GetPlatformShippingRates lists the marketplace's default rate per zone, used for sellers without their own (admin)
+func GetPlatformShippingRates(c *fiber.Ctx) error {
+	var rates []models.ShippingRate
+	if err := config.DB.Where("seller_id IS NULL").Find(&rates).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch shipping rates"})
+	}
+	return c.JSON(fiber.Map{"rates": rates})
+}
+
+// SetPlatformShippingRate creates or replaces the marketplace's default rate for a zone (admin)
+func SetPlatformShippingRate(c *fiber.Ctx) error {
+	rate, status, body := upsertShippingRate(c, nil)
+	if rate == nil {
+		return c.Status(status).JSON(body)
+	}
+	if err := recordAudit(config.DB, c, "shipping_rate.update", "shipping_rate", rate.ID, "", fiber.Map{
+		"zone_id":                 rate.ZoneID,
+		"base_fee":                rate.BaseFee,
+		"per_kg_fee":              rate.PerKgFee,
+		"free_shipping_threshold": rate.FreeShippingThreshold,
+	}); err != nil {
+		log.Printf("❌ Failed to audit shipping rate %d: %v", rate.ID, err)
+	}
+	return c.JSON(fiber.Map{"rate": rate})
+}
+
+// upsertShippingRate validates the body and saves the rate for sellerID (nil for the platform rate).
+// When the rate is nil, status and body describe the error response.
+func upsertShippingRate(c *fiber.Ctx, sellerID *uint) (*models.ShippingRate, int, fiber.Map) {
+	var input ShippingRateInput
+	if err := c.BodyParser(&input); err != nil {
+		return nil, 400, fiber.Map{"error": "Invalid request body"}
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return nil, 400, fiber.Map{"error": "Validation failed", "fields": fieldErrors}
+	}
+
+	var zone models.ShippingZone
+	if err := config.DB.Where("code = ?", input.ZoneCode).First(&zone).Error; err != nil {
+		return nil, 404, fiber.Map{"error": "Shipping zone not found"}
+	}
+
+	var rate models.ShippingRate
+	query := config.DB.Where("zone_id = ?", zone.ID)
+	if sellerID == nil {
+		query = query.Where("seller_id IS NULL")
+	} else {
+		query = query.Where("seller_id = ?", *sellerID)
+	}
+	if err := query.First(&rate).Error; err != nil {
+		rate = models.ShippingRate{ZoneID: zone.ID, SellerID: sellerID}
+	}
+
+	rate.BaseFee = input.BaseFee
+	rate.PerKgFee = input.PerKgFee
+	rate.FreeShippingThreshold = input.FreeShippingThreshold
+	if err := config.DB.Save(&rate).Error; err != nil {
+		return nil, 500, fiber.Map{"error": "Failed to save shipping rate"}
+	}
+	return &rate, 0, nil
+}
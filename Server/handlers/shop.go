@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"strconv"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// shopProfile returns the public view of a seller (no email or address)
+func shopProfile(seller models.User) fiber.Map {
+	return fiber.Map{
+		"id":         seller.ID,
+		"name":       seller.Name,
+		"shop_name":  seller.ShopName,
+		"shop_slug":  seller.ShopSlug,
+		"verified":   seller.SellerApprovedAt != nil,
+		"created_at": seller.CreatedAt,
+	}
+}
+
+// GetShop returns a seller's storefront: shop profile and published products.
+// The :id parameter accepts either the numeric seller ID or the shop slug.
+func GetShop(c *fiber.Ctx) error {
+	idParam := c.Params("id")
+
+	query := config.DB.Where("role = ? AND suspended_at IS NULL", models.RoleSeller)
+	if id64, err := strconv.ParseUint(idParam, 10, 64); err == nil {
+		query = query.Where("id = ?", id64)
+	} else {
+		query = query.Where("shop_slug = ?", idParam)
+	}
+
+	var seller models.User
+	if err := query.First(&seller).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Shop not found"})
+	}
+
+	var products []models.Product
+	if err := config.DB.Scopes(models.PublishedProducts).Where("seller_id = ?", seller.ID).
+		Order("created_at DESC").
+		Find(&products).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not fetch products"})
+	}
+
+	return c.JSON(fiber.Map{
+		"shop":          shopProfile(seller),
+		"products":      products,
+		"product_count": len(products),
+	})
+}
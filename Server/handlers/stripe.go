@@ -3,39 +3,66 @@ package handlers
 import (
 	"encoding/json"
 	"log"
+	"math"
 	"os"
 	"strconv"
 
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/stripe/stripe-go/v75"
 	"github.com/stripe/stripe-go/v75/paymentintent"
 	"github.com/stripe/stripe-go/v75/webhook"
+	"gorm.io/gorm"
 )
 
+// CreatePaymentIntentRequest carries the cart rather than an amount, so the charge is
+// always the server's quote for it, discounts, delivery and tax included
 type CreatePaymentIntentRequest struct {
-	Amount      int64  `json:"amount"`
-	Currency    string `json:"currency"`
 	Description string `json:"description"`
 	OrderID     uint   `json:"orderId"`
+
+	Items         []OrderItemInput `json:"items" validate:"required,min=1,dive"`
+	CouponCode    string           `json:"coupon_code"`
+	ShippingCity  string           `json:"shipping_city"`
+	ShippingState string           `json:"shipping_state"`
 }
 
 type CreatePaymentIntentResponse struct {
-	ClientSecret    string `json:"clientSecret"`
-	PaymentIntentID string `json:"paymentIntentId"`
+	ClientSecret    string  `json:"clientSecret"`
+	PaymentIntentID string  `json:"paymentIntentId"`
+	Amount          float64 `json:"amount"`
+	Currency        string  `json:"currency"`
 }
 
+// stripeCurrency is the currency orders are priced in
+const stripeCurrency = "etb"
+
 func CreateStripePaymentIntent(c *fiber.Ctx) error {
 	var req CreatePaymentIntentRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	// Validate required fields
-	if req.Amount <= 0 {
-		return c.Status(400).JSON(fiber.Map{"error": "Amount must be greater than 0"})
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	// Price the order on the server so the payment amount can't be tampered with
+	user := c.Locals("user").(models.User)
+	quote, err := buildOrderQuote(config.DB, user, req.Items, req.CouponCode,
+		shippingDestination{City: req.ShippingCity, State: req.ShippingState})
+	if err != nil {
+		if _, ok := err.(*quoteError); ok {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to price order"})
 	}
-	if req.Currency == "" {
-		req.Currency = "etb" // Default to Ethiopian Birr
+	amount := int64(math.Round(quote.Total * 100))
+	if amount <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Amount must be greater than 0"})
 	}
 	if req.Description == "" {
 		req.Description = "eGebeya Order Payment"
@@ -53,16 +80,17 @@ func CreateStripePaymentIntent(c *fiber.Ctx) error {
 	// Set Stripe API key
 	stripe.Key = stripeKey
 
-	log.Printf("🚀 Creating Stripe payment intent for amount: %d %s", req.Amount, req.Currency)
+	log.Printf("🚀 Creating Stripe payment intent for amount: %d %s", amount, stripeCurrency)
 	log.Printf("📝 Description: %s", req.Description)
 
 	// Create payment intent
 	params := &stripe.PaymentIntentParams{
-		Amount:      stripe.Int64(req.Amount),
-		Currency:    stripe.String(req.Currency),
+		Amount:      stripe.Int64(amount),
+		Currency:    stripe.String(stripeCurrency),
 		Description: stripe.String(req.Description),
 		Metadata: map[string]string{
 			"order_id": strconv.Itoa(int(req.OrderID)),
+			"user_id":  strconv.Itoa(int(user.ID)),
 		},
 		AutomaticPaymentMethods: &stripe.PaymentIntentAutomaticPaymentMethodsParams{
 			Enabled: stripe.Bool(true),
@@ -82,6 +110,8 @@ func CreateStripePaymentIntent(c *fiber.Ctx) error {
 	response := CreatePaymentIntentResponse{
 		ClientSecret:    pi.ClientSecret,
 		PaymentIntentID: pi.ID,
+		Amount:          quote.Total,
+		Currency:        stripeCurrency,
 	}
 
 	return c.JSON(response)
@@ -143,6 +173,56 @@ func StripeWebhook(c *fiber.Ctx) error {
 
 		log.Printf("❌ Payment failed: %s", paymentIntent.ID)
 
+		if userID, err := strconv.Atoi(paymentIntent.Metadata["user_id"]); err == nil && userID > 0 {
+			if err := queuePaymentFailedEmail(config.DB, uint(userID), paymentIntent.ID, float64(paymentIntent.Amount)/100); err != nil {
+				log.Printf("❌ Failed to queue payment failed email for %s: %v", paymentIntent.ID, err)
+			}
+		}
+
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			log.Printf("❌ Error parsing charge.refunded: %v", err)
+			return c.Status(400).JSON(fiber.Map{"error": "Error parsing event"})
+		}
+		if charge.PaymentIntent == nil {
+			break
+		}
+
+		var order models.Order
+		if err := config.DB.Where("payment_id = ?", charge.PaymentIntent.ID).First(&order).Error; err != nil {
+			log.Printf("ℹ️ Refund for unknown payment intent: %s", charge.PaymentIntent.ID)
+			break
+		}
+		// AmountRefunded is the running total, so refunds already recorded from the
+		// admin API only leave the difference, if any, to record here
+		refunded := roundMoney(float64(charge.AmountRefunded) / 100)
+		if refunded <= order.RefundedAmount {
+			break
+		}
+		status := models.PaymentStatusPaid
+		if charge.Refunded || refunded >= order.Total {
+			status = models.PaymentStatusRefunded
+		}
+		if err := config.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.Order{}).
+				Where("id = ? AND refunded_amount = ?", order.ID, order.RefundedAmount).
+				Updates(map[string]interface{}{"refunded_amount": refunded, "payment_status": status})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				// Recorded concurrently by the admin API
+				return nil
+			}
+			return queueRefundIssuedEmail(tx, order, roundMoney(refunded-order.RefundedAmount))
+		}); err != nil {
+			log.Printf("❌ Failed to mark order %s refunded: %v", order.OrderNumber, err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to update order"})
+		}
+
+		log.Printf("💸 Order %s refunded %.2f in total", order.OrderNumber, refunded)
+
 	default:
 		log.Printf("ℹ️ Unhandled event type: %s", event.Type)
 	}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"testing"
+
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStripePaymentIntentNeedsCart(t *testing.T) {
+	db := setupTestDB(t)
+	_, product, _ := setupCheckout(t, db)
+	buyer := createTestUser(t, db, "buyer@example.com", models.RoleBuyer)
+	t.Setenv("STRIPE_SECRET_KEY", "")
+
+	app := fiber.New()
+	app.Post("/create-payment-intent", middleware.RequireAuth, CreateStripePaymentIntent)
+
+	tests := []struct {
+		name    string
+		body    fiber.Map
+		want    int
+		wantErr string
+	}{
+		{"amount chosen by the client", fiber.Map{"amount": 100, "currency": "usd"}, 400, "Validation failed"},
+		{"product out of stock", fiber.Map{"items": []fiber.Map{{"product_id": product.ID, "quantity": 11}}}, 400, ""},
+		// Priced without error, so it gets as far as Stripe, which isn't configured here
+		{"cart priced on the server", fiber.Map{"amount": 1, "items": []fiber.Map{{"product_id": product.ID, "quantity": 1}}}, 500, "Stripe configuration not found. Please contact support."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := doJSON(t, app, "POST", "/create-payment-intent", accessToken(t, db, buyer), tt.body)
+			if res.Status != tt.want || (tt.wantErr != "" && res.Body["error"] != tt.wantErr) {
+				t.Errorf("got %d %v, want %d %q", res.Status, res.Body, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
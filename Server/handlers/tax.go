@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// TaxProfileInput is a seller's tax registration. VAT-registered sellers must give their TIN.
+type TaxProfileInput struct {
+	TIN           string `json:"tin" validate:"required_if=VATRegistered true,omitempty,numeric,len=10"`
+	VATRegistered bool   `json:"vat_registered"`
+}
+
+// TaxRuleInput sets the rates for a product category. Rates are fractions (0.15 for 15%);
+// an empty category is the default rule for categories without one.
+type TaxRuleInput struct {
+	Category string  `json:"category" validate:"max=100"`
+	VATRate  float64 `json:"vat_rate" validate:"min=0,max=1"`
+	TOTRate  float64 `json:"tot_rate" validate:"min=0,max=1"`
+	Exempt   bool    `json:"exempt"`
+}
+
+// GetTaxRules lists the tax rates applied per product category
+func GetTaxRules(c *fiber.Ctx) error {
+	var rules []models.TaxRule
+	if err := config.DB.Order("category ASC").Find(&rules).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch tax rules"})
+	}
+	return c.JSON(fiber.Map{"rules": rules})
+}
+
+// UpdateSellerTaxProfile sets the seller's TIN and VAT registration, which decide
+// whether their sales carry VAT or TOT
+func UpdateSellerTaxProfile(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var input TaxProfileInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	if err := config.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"tin":            input.TIN,
+		"vat_registered": input.VATRegistered,
+	}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update tax profile"})
+	}
+
+	return c.JSON(fiber.Map{"tin": input.TIN, "vat_registered": input.VATRegistered})
+}
+
+// CreateTaxRule adds the rates for a category that doesn't have a rule yet (admin)
+func CreateTaxRule(c *fiber.Ctx) error {
+	input, status, body := parseTaxRuleInput(c)
+	if input == nil {
+		return c.Status(status).JSON(body)
+	}
+
+	rule := models.TaxRule{Category: input.Category, VATRate: input.VATRate, TOTRate: input.TOTRate, Exempt: input.Exempt}
+	if taxRuleExists(input.Category, 0) {
+		return c.Status(409).JSON(fiber.Map{"error": "A tax rule for this category already exists"})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "tax_rule.create", "tax_rule", rule.ID, "", taxRuleAuditDetails(rule))
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create tax rule"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"rule": rule})
+}
+
+// UpdateTaxRule changes a rule's category or rates. Orders already placed keep the tax
+// they were charged. (admin)
+func UpdateTaxRule(c *fiber.Ctx) error {
+	var rule models.TaxRule
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&rule).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Tax rule not found"})
+	}
+
+	input, status, body := parseTaxRuleInput(c)
+	if input == nil {
+		return c.Status(status).JSON(body)
+	}
+	if rule.Category == "" && input.Category != "" {
+		return c.Status(409).JSON(fiber.Map{"error": "The default rule can't be moved to a category"})
+	}
+	if taxRuleExists(input.Category, rule.ID) {
+		return c.Status(409).JSON(fiber.Map{"error": "A tax rule for this category already exists"})
+	}
+
+	previous := taxRuleAuditDetails(rule)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&rule).Updates(map[string]interface{}{
+			"category": input.Category,
+			"vat_rate": input.VATRate,
+			"tot_rate": input.TOTRate,
+			"exempt":   input.Exempt,
+		}).Error; err != nil {
+			return err
+		}
+		details := taxRuleAuditDetails(rule)
+		details["from"] = previous
+		return recordAudit(tx, c, "tax_rule.update", "tax_rule", rule.ID, "", details)
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update tax rule"})
+	}
+
+	return c.JSON(fiber.Map{"rule": rule})
+}
+
+// DeleteTaxRule removes a category's rule so its products fall back to the default rule.
+// The default rule itself can only be changed. (admin)
+func DeleteTaxRule(c *fiber.Ctx) error {
+	var rule models.TaxRule
+	if err := config.DB.Where("id = ?", c.Params("id")).First(&rule).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Tax rule not found"})
+	}
+	if rule.Category == "" {
+		return c.Status(409).JSON(fiber.Map{"error": "The default rule can't be deleted. Set its rates to 0 instead"})
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Hard delete so the category can get a new rule later
+		if err := tx.Unscoped().Delete(&rule).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, "tax_rule.delete", "tax_rule", rule.ID, "", taxRuleAuditDetails(rule))
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete tax rule"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Tax rule deleted"})
+}
+
+// parseTaxRuleInput validates the body. When the input is nil, status and body describe
+// the error response.
+func parseTaxRuleInput(c *fiber.Ctx) (*TaxRuleInput, int, fiber.Map) {
+	var input TaxRuleInput
+	if err := c.BodyParser(&input); err != nil {
+		return nil, 400, fiber.Map{"error": "Invalid request body"}
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return nil, 400, fiber.Map{"error": "Validation failed", "fields": fieldErrors}
+	}
+	if input.Exempt && (input.VATRate > 0 || input.TOTRate > 0) {
+		return nil, 400, fiber.Map{"error": "Exempt categories can't have tax rates"}
+	}
+	input.Category = models.NormalizeCategory(input.Category)
+	return &input, 0, nil
+}
+
+// taxRuleExists reports whether a rule other than exceptID already covers category
+func taxRuleExists(category string, exceptID uint) bool {
+	var count int64
+	config.DB.Unscoped().Model(&models.TaxRule{}).Where("category = ? AND id <> ?", category, exceptID).Count(&count)
+	return count > 0
+}
+
+func taxRuleAuditDetails(rule models.TaxRule) fiber.Map {
+	return fiber.Map{
+		"category": rule.Category,
+		"vat_rate": rule.VATRate,
+		"tot_rate": rule.TOTRate,
+		"exempt":   rule.Exempt,
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTaxRuleAdmin(t *testing.T) {
+	db := setupTestDB(t)
+	models.SeedTaxRules(db)
+	token := accessToken(t, db, createTestUser(t, db, "admin@example.com", models.RoleAdmin))
+
+	app := fiber.New()
+	app.Post("/tax-rules", middleware.RequireAuth, CreateTaxRule)
+	app.Put("/tax-rules/:id", middleware.RequireAuth, UpdateTaxRule)
+	app.Delete("/tax-rules/:id", middleware.RequireAuth, DeleteTaxRule)
+
+	invalid := []struct {
+		name string
+		body fiber.Map
+		want int
+	}{
+		{"rate above 100%", fiber.Map{"category": "spices", "vat_rate": 15}, 400},
+		{"negative rate", fiber.Map{"category": "spices", "tot_rate": -0.02}, 400},
+		{"exempt with rates", fiber.Map{"category": "spices", "vat_rate": 0.15, "exempt": true}, 400},
+		{"second default rule", fiber.Map{"category": "", "vat_rate": 0.1}, 409},
+	}
+	for _, tt := range invalid {
+		if res := doJSON(t, app, "POST", "/tax-rules", token, tt.body); res.Status != tt.want {
+			t.Errorf("%s: got %d, want %d (%v)", tt.name, res.Status, tt.want, res.Body)
+		}
+	}
+
+	res := doJSON(t, app, "POST", "/tax-rules", token, fiber.Map{"category": " Books ", "exempt": true})
+	if res.Status != 201 {
+		t.Fatalf("create: %d %v", res.Status, res.Body)
+	}
+	id := uint(res.Body["rule"].(map[string]interface{})["ID"].(float64))
+	if res := doJSON(t, app, "POST", "/tax-rules", token, fiber.Map{"category": "books"}); res.Status != 409 {
+		t.Errorf("duplicate category: got %d, want 409", res.Status)
+	}
+
+	if res := doJSON(t, app, "PUT", fmt.Sprintf("/tax-rules/%d", id), token, fiber.Map{"category": "books", "vat_rate": 0.05}); res.Status != 200 {
+		t.Fatalf("update: %d %v", res.Status, res.Body)
+	}
+	var rules []models.TaxRule
+	db.Order("id").Find(&rules)
+	if rule := models.MatchTaxRule(rules, "Books"); rule.ID != id || rule.VATRate != 0.05 || rule.Exempt {
+		t.Errorf("books rule after update: %+v", rule)
+	}
+
+	var defaultRule models.TaxRule
+	db.Where("category = ''").First(&defaultRule)
+	if res := doJSON(t, app, "DELETE", fmt.Sprintf("/tax-rules/%d", defaultRule.ID), token, nil); res.Status != 409 {
+		t.Errorf("delete default rule: got %d, want 409", res.Status)
+	}
+	if res := doJSON(t, app, "DELETE", fmt.Sprintf("/tax-rules/%d", id), token, nil); res.Status != 200 {
+		t.Fatalf("delete: %d %v", res.Status, res.Body)
+	}
+	if res := doJSON(t, app, "POST", "/tax-rules", token, fiber.Map{"category": "books", "vat_rate": 0.15}); res.Status != 201 {
+		t.Errorf("recreate deleted category: %d %v", res.Status, res.Body)
+	}
+
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("target_type = ?", "tax_rule").Count(&audits)
+	if audits != 4 {
+		t.Errorf("%d audit entries, want 4", audits)
+	}
+}
@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log"
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// loginChallengeEmailCooldown is the minimum time between sign-in code emails
+const loginChallengeEmailCooldown = time.Minute
+
+// LoginChallengeInput answers a sign-in challenge with an authenticator or email code,
+// or with one of the recovery codes
+type LoginChallengeInput struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode   string `json:"recovery_code" validate:"omitempty,max=20"`
+}
+
+// ChallengeTokenInput identifies a sign-in waiting for its second factor
+type ChallengeTokenInput struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+}
+
+// TOTPCodeInput confirms an authenticator app is set up
+type TOTPCodeInput struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+// ReauthInput re-checks who the user is before a sensitive change: their password, or a
+// current authenticator code for accounts that have no password (phone and social sign-ups)
+type ReauthInput struct {
+	Password string `json:"password"`
+	Code     string `json:"code" validate:"omitempty,numeric,len=6"`
+}
+
+// startLoginChallenge answers a correct password with a challenge instead of a session.
+// Users without an authenticator app are emailed a code straight away.
+func startLoginChallenge(c *fiber.Ctx, user models.User) error {
+	token, tokenHash, err := services.NewSecureToken()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not login"})
+	}
+
+	challenge := models.LoginChallenge{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		Method:    user.LoginTwoFactorMethod(),
+		IP:        c.IP(),
+		UserAgent: c.Get("User-Agent"),
+		ExpiresAt: time.Now().Add(models.LoginChallengeTTL),
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&challenge).Error; err != nil {
+			return err
+		}
+		if challenge.Method == models.TwoFactorEmail {
+			return sendLoginChallengeCode(tx, &challenge, user)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("❌ Failed to start sign-in challenge for user %d: %v", user.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Could not login"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":             "Enter the code from your second factor to finish signing in",
+		"two_factor_required": true,
+		"challenge_token":     token,
+		"method":              challenge.Method,
+		"methods":             loginChallengeMethods(user),
+		"expires_at":          challenge.ExpiresAt,
+	})
+}
+
+// VerifyLoginChallenge checks the second factor and, if it's right, starts the session
+// the same way a password-only login does
+func VerifyLoginChallenge(c *fiber.Ctx) error {
+	var input LoginChallengeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	challenge, user, ok := findLoginChallenge(input.ChallengeToken)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Sign-in expired, please log in again"})
+	}
+	if user.Suspended() {
+		return c.Status(403).JSON(fiber.Map{"error": "Your account has been suspended", "suspended": true})
+	}
+	if status := checkLoginThrottle(c, userThrottleKey(user)); !status.Allowed() {
+		return throttledResponse(c, status)
+	}
+
+	var recoveryCode *models.RecoveryCode
+	valid := false
+	if input.RecoveryCode != "" {
+		recoveryCode, valid = findRecoveryCode(user.ID, input.RecoveryCode)
+	} else {
+		valid = checkLoginChallengeCode(challenge, user, input.Code)
+	}
+
+	if !valid {
+		config.DB.Model(&challenge).Update("attempts", gorm.Expr("attempts + 1"))
+		recordLoginFailure(c, userThrottleKey(user), &user)
+		remaining := models.MaxLoginChallengeAttempts - challenge.Attempts - 1
+		if remaining <= 0 {
+			return c.Status(401).JSON(fiber.Map{"error": "Too many wrong codes, please log in again"})
+		}
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid code", "attempts_remaining": remaining})
+	}
+
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Claiming the challenge in the same statement that checks it makes it single-use
+		result := tx.Model(&models.LoginChallenge{}).
+			Where("id = ? AND completed_at IS NULL", challenge.ID).
+			Update("completed_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if recoveryCode == nil {
+			return nil
+		}
+		result = tx.Model(&models.RecoveryCode{}).
+			Where("id = ? AND used_at IS NULL", recoveryCode.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err == gorm.ErrRecordNotFound {
+		return c.Status(401).JSON(fiber.Map{"error": "Sign-in expired, please log in again"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not login"})
+	}
+
+	if recoveryCode != nil {
+		log.Printf("🔑 User %d signed in with a recovery code", user.ID)
+	}
+	return completeLogin(c, user)
+}
+
+// ResendLoginChallengeCode emails a sign-in code, for users whose authenticator app isn't
+// at hand or whose first email didn't arrive
+func ResendLoginChallengeCode(c *fiber.Ctx) error {
+	var input ChallengeTokenInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	challenge, user, ok := findLoginChallenge(input.ChallengeToken)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Sign-in expired, please log in again"})
+	}
+	if challenge.EmailsSent >= models.MaxLoginChallengeEmails {
+		return c.Status(429).JSON(fiber.Map{"error": "Too many codes sent, please log in again"})
+	}
+	if challenge.CodeSentAt != nil && time.Since(*challenge.CodeSentAt) < loginChallengeEmailCooldown {
+		return c.Status(429).JSON(fiber.Map{"error": "Please wait a minute before asking for another code"})
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return sendLoginChallengeCode(tx, &challenge, user)
+	}); err != nil {
+		log.Printf("❌ Failed to email sign-in code to user %d: %v", user.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to send code"})
+	}
+
+	return c.JSON(fiber.Map{"message": "We've emailed you a sign-in code", "method": models.TwoFactorEmail})
+}
+
+// GetTwoFactorStatus returns the user's 2FA settings
+func GetTwoFactorStatus(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var remaining int64
+	config.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+
+	return c.JSON(fiber.Map{
+		"enabled":                  user.TwoFactorMethod != "",
+		"method":                   user.TwoFactorMethod,
+		"enabled_at":               user.TwoFactorEnabledAt,
+		"required":                 user.Role == models.RoleAdmin,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTOTP starts authenticator app enrolment. The secret only takes effect once
+// EnableTOTP receives a code generated from it.
+func SetupTOTP(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if user.TwoFactorMethod == models.TwoFactorTOTP {
+		return c.Status(409).JSON(fiber.Map{"error": "An authenticator app is already set up. Disable it first to set up a new one"})
+	}
+
+	setup, err := services.NewTOTPSetup(user.Email)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate authenticator secret"})
+	}
+	sealed, err := services.SealSecret(setup.Secret)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate authenticator secret"})
+	}
+	if err := config.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("totp_pending_secret", sealed).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save authenticator secret"})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":      setup.Secret,
+		"otpauth_url": setup.URL,
+		"qr_code":     setup.QRCode,
+	})
+}
+
+// EnableTOTP turns on authenticator app sign-in once the user proves the app works,
+// and returns the recovery codes. They are only shown this once.
+func EnableTOTP(c *fiber.Ctx) error {
+	var input TOTPCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	user := c.Locals("user").(models.User)
+	if user.TOTPPendingSecret == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Start authenticator setup first"})
+	}
+	secret, err := services.OpenSecret(user.TOTPPendingSecret)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Start authenticator setup again"})
+	}
+	counter, ok := services.ValidateTOTP(secret, input.Code, 0)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid code. Check the time on your phone and try again"})
+	}
+
+	var codes []string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"two_factor_method":     models.TwoFactorTOTP,
+			"two_factor_enabled_at": time.Now(),
+			"totp_secret":           user.TOTPPendingSecret,
+			"totp_pending_secret":   "",
+			"totp_last_counter":     counter,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		log.Printf("❌ Failed to enable TOTP for user %d: %v", user.ID, err)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to enable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled. Store your recovery codes somewhere safe",
+		"method":         models.TwoFactorTOTP,
+		"recovery_codes": codes,
+	})
+}
+
+// EnableEmailTwoFactor turns on emailed sign-in codes, for users without an authenticator app
+func EnableEmailTwoFactor(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	if user.TwoFactorMethod == models.TwoFactorTOTP {
+		return c.Status(409).JSON(fiber.Map{"error": "An authenticator app is already set up; email codes are available as a fallback"})
+	}
+	if user.TwoFactorMethod == models.TwoFactorEmail {
+		return c.Status(409).JSON(fiber.Map{"error": "Email sign-in codes are already enabled"})
+	}
+	if user.Email == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Add an email address to your account first"})
+	}
+	// Turning it off again asks for the password, which there'd be no way to give
+	if user.Password == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Set a password first, using Forgot password on the sign-in page, or set up an authenticator app instead"})
+	}
+
+	if err := config.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"two_factor_method":     models.TwoFactorEmail,
+		"two_factor_enabled_at": time.Now(),
+	}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to enable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{"message": "We'll email you a code each time you sign in", "method": models.TwoFactorEmail})
+}
+
+// DisableTwoFactor turns 2FA off after re-authenticating the user. Admins keep getting
+// emailed codes since 2FA is required for them.
+func DisableTwoFactor(c *fiber.Ctx) error {
+	var input ReauthInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	user := c.Locals("user").(models.User)
+	if message, ok := reauthenticate(user, input); !ok {
+		return c.Status(401).JSON(fiber.Map{"error": message})
+	}
+	if user.TwoFactorMethod == "" {
+		return c.Status(409).JSON(fiber.Map{"error": "Two-factor authentication is not enabled"})
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return clearTwoFactor(tx, user.ID)
+	}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to disable two-factor authentication"})
+	}
+
+	response := fiber.Map{"message": "Two-factor authentication disabled"}
+	if user.Role == models.RoleAdmin {
+		response["message"] = "Authenticator app removed. As an admin you'll still get a code by email when you sign in"
+	}
+	return c.JSON(response)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after re-authenticating the user
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	var input ReauthInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(input); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	user := c.Locals("user").(models.User)
+	if message, ok := reauthenticate(user, input); !ok {
+		return c.Status(401).JSON(fiber.Map{"error": message})
+	}
+	if user.TwoFactorMethod != models.TwoFactorTOTP {
+		return c.Status(409).JSON(fiber.Map{"error": "Recovery codes are only used with an authenticator app"})
+	}
+
+	var codes []string
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate recovery codes"})
+	}
+
+	return c.JSON(fiber.Map{"message": "New recovery codes generated; the old ones no longer work", "recovery_codes": codes})
+}
+
+// reauthenticate checks the password, or a current authenticator code when the account
+// has no password, returning what to tell the user when it doesn't match
+func reauthenticate(user models.User, input ReauthInput) (string, bool) {
+	if user.Password != "" {
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)) != nil {
+			return "Incorrect password", false
+		}
+		return "", true
+	}
+	if user.TwoFactorMethod != models.TwoFactorTOTP {
+		return "Set a password first, using Forgot password on the sign-in page", false
+	}
+	if input.Code == "" || !acceptTOTPCode(user, input.Code) {
+		return "Invalid code. Enter the current code from your authenticator app", false
+	}
+	return "", true
+}
+
+// acceptTOTPCode checks a code from the user's authenticator app and remembers it, so
+// it can't be used again
+func acceptTOTPCode(user models.User, code string) bool {
+	if user.TOTPSecret == "" {
+		return false
+	}
+	secret, err := services.OpenSecret(user.TOTPSecret)
+	if err != nil {
+		return false
+	}
+	counter, ok := services.ValidateTOTP(secret, code, user.TOTPLastCounter)
+	if !ok {
+		return false
+	}
+	result := config.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_counter < ?", user.ID, counter).
+		Update("totp_last_counter", counter)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// findLoginChallenge looks up a usable challenge by its token, together with its user
+func findLoginChallenge(token string) (models.LoginChallenge, models.User, bool) {
+	var challenge models.LoginChallenge
+	var user models.User
+	if err := config.DB.Where("token_hash = ?", services.HashToken(token)).First(&challenge).Error; err != nil {
+		return challenge, user, false
+	}
+	if !challenge.Usable() {
+		return challenge, user, false
+	}
+	if err := config.DB.Where("id = ?", challenge.UserID).First(&user).Error; err != nil {
+		return challenge, user, false
+	}
+	return challenge, user, true
+}
+
+// checkLoginChallengeCode accepts a current authenticator code or the code emailed for
+// this challenge. Accepted authenticator codes are remembered so they can't be reused.
+func checkLoginChallengeCode(challenge models.LoginChallenge, user models.User, code string) bool {
+	if user.TwoFactorMethod == models.TwoFactorTOTP && acceptTOTPCode(user, code) {
+		return true
+	}
+
+	if challenge.CodeHash != "" && challenge.CodeSentAt != nil &&
+		time.Since(*challenge.CodeSentAt) < models.LoginChallengeTTL {
+		return subtle.ConstantTimeCompare([]byte(services.HashToken(code)), []byte(challenge.CodeHash)) == 1
+	}
+	return false
+}
+
+// findRecoveryCode looks up an unused recovery code of the user
+func findRecoveryCode(userID uint, code string) (*models.RecoveryCode, bool) {
+	var recoveryCode models.RecoveryCode
+	if err := config.DB.Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, services.HashRecoveryCode(code)).
+		First(&recoveryCode).Error; err != nil {
+		return nil, false
+	}
+	return &recoveryCode, true
+}
+
+// sendLoginChallengeCode emails a new sign-in code for the challenge in tx; earlier codes stop working
+func sendLoginChallengeCode(tx *gorm.DB, challenge *models.LoginChallenge, user models.User) error {
+	code, err := generateResetCode()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := tx.Model(challenge).Updates(map[string]interface{}{
+		"code_hash":    services.HashToken(code),
+		"code_sent_at": now,
+		"emails_sent":  gorm.Expr("emails_sent + 1"),
+	}).Error; err != nil {
+		return err
+	}
+	return services.NewEmailService().Queue(tx).InLocale(user.Locale).
+		SendTwoFactorCodeEmail(user.Email, user.Name, code, models.LoginChallengeTTL)
+}
+
+// loginChallengeMethods lists the ways a user can answer a sign-in challenge
+func loginChallengeMethods(user models.User) []string {
+	if user.TwoFactorMethod == models.TwoFactorTOTP {
+		return []string{models.TwoFactorTOTP, models.TwoFactorEmail, "recovery_code"}
+	}
+	return []string{models.TwoFactorEmail}
+}
+
+// replaceRecoveryCodes issues a fresh set of recovery codes in tx, voiding the old ones
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	codes, hashes, err := services.NewRecoveryCodes(models.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	for _, hash := range hashes {
+		if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: hash}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// clearTwoFactor turns off 2FA for the user in tx and removes their recovery codes
+func clearTwoFactor(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"two_factor_method":     "",
+		"two_factor_enabled_at": nil,
+		"totp_secret":           "",
+		"totp_pending_secret":   "",
+		"totp_last_counter":     0,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
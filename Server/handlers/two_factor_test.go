@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+func TestVerifyLoginChallenge(t *testing.T) {
+	db := setupTestDB(t)
+	setup, err := services.NewTOTPSetup("seller@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := services.SealSecret(setup.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := createTestUser(t, db, "seller@example.com", models.RoleSeller)
+	now := time.Now()
+	db.Model(&user).Updates(map[string]interface{}{
+		"two_factor_method":     models.TwoFactorTOTP,
+		"two_factor_enabled_at": now,
+		"totp_secret":           sealed,
+	})
+	db.First(&user, user.ID)
+
+	var recoveryCodes []string
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		recoveryCodes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Post("/login", func(c *fiber.Ctx) error {
+		var current models.User
+		config.DB.First(&current, user.ID)
+		return startLoginChallenge(c, current)
+	})
+	app.Post("/login/2fa", VerifyLoginChallenge)
+
+	currentCode, err := totp.GenerateCode(setup.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name  string
+		input fiber.Map // challenge_token is added
+		want  int
+	}{
+		{"authenticator code", fiber.Map{"code": currentCode}, 200},
+		{"same authenticator code again", fiber.Map{"code": currentCode}, 401},
+		{"recovery code as printed", fiber.Map{"recovery_code": recoveryCodes[0]}, 200},
+		{"used recovery code", fiber.Map{"recovery_code": recoveryCodes[0]}, 401},
+		{"recovery code typed loosely", fiber.Map{"recovery_code": strings.ToUpper(strings.ReplaceAll(recoveryCodes[1], "-", " "))}, 200},
+		{"made-up recovery code", fiber.Map{"recovery_code": "aaaaa-bbbbb"}, 401},
+	}
+	for _, step := range steps {
+		start := doJSON(t, app, "POST", "/login", "", nil)
+		if start.Body["two_factor_required"] != true || start.Body["method"] != models.TwoFactorTOTP {
+			t.Fatalf("%s: expected a TOTP challenge, got %v", step.name, start.Body)
+		}
+		step.input["challenge_token"] = start.Body["challenge_token"]
+		if res := doJSON(t, app, "POST", "/login/2fa", "", step.input); res.Status != step.want {
+			t.Errorf("%s: got %d, want %d (%v)", step.name, res.Status, step.want, res.Body)
+		}
+		// Failures here are about the codes, not the account lockout
+		db.Where("1 = 1").Delete(&models.AuthThrottle{})
+	}
+
+	// A challenge stops accepting codes, even the right one, after too many wrong ones
+	start := doJSON(t, app, "POST", "/login", "", nil)
+	token := start.Body["challenge_token"]
+	for i := 0; i < models.MaxLoginChallengeAttempts; i++ {
+		doJSON(t, app, "POST", "/login/2fa", "", fiber.Map{"challenge_token": token, "recovery_code": "aaaaa-bbbbb"})
+		db.Where("1 = 1").Delete(&models.AuthThrottle{})
+	}
+	if res := doJSON(t, app, "POST", "/login/2fa", "", fiber.Map{"challenge_token": token, "recovery_code": recoveryCodes[2]}); res.Status != 401 {
+		t.Errorf("right code after too many wrong ones: got %d, want 401", res.Status)
+	}
+}
+
+func TestReauthWithoutPassword(t *testing.T) {
+	db := setupTestDB(t)
+	const secret = "JBSWY3DPEHPK3PXP"
+	sealed, err := services.SealSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	user := models.User{Name: "Phone buyer", Role: models.RoleBuyer, Phone: "+251911000001", PhoneVerifiedAt: &now,
+		TwoFactorMethod: models.TwoFactorTOTP, TwoFactorEnabledAt: &now, TOTPSecret: sealed}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	social := createTestUser(t, db, "social@example.com", models.RoleBuyer) // Signed up with a provider, no password
+
+	app := fiber.New()
+	app.Post("/2fa/disable", middleware.RequireAuth, DisableTwoFactor)
+	app.Post("/2fa/recovery-codes", middleware.RequireAuth, RegenerateRecoveryCodes)
+	app.Post("/2fa/email/enable", middleware.RequireAuth, EnableEmailTwoFactor)
+	token := accessToken(t, db, user)
+
+	codeAt := func(offset time.Duration) string {
+		code, err := totp.GenerateCode(secret, now.Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	previous := codeAt(-30 * time.Second)
+
+	steps := []struct {
+		name  string
+		path  string
+		token string
+		input fiber.Map
+		want  int
+	}{
+		{"no code", "/2fa/disable", token, fiber.Map{}, 401},
+		{"password instead of a code", "/2fa/recovery-codes", token, fiber.Map{"password": ""}, 401},
+		{"wrong code", "/2fa/recovery-codes", token, fiber.Map{"code": wrongCode(codeAt(0))}, 401},
+		{"authenticator code", "/2fa/recovery-codes", token, fiber.Map{"code": previous}, 200},
+		{"same code again", "/2fa/disable", token, fiber.Map{"code": previous}, 401},
+		{"newer code", "/2fa/disable", token, fiber.Map{"code": codeAt(0)}, 200},
+		{"email codes that couldn't be turned off", "/2fa/email/enable", accessToken(t, db, social), fiber.Map{}, 400},
+	}
+	for _, step := range steps {
+		if res := doJSON(t, app, "POST", step.path, step.token, step.input); res.Status != step.want {
+			t.Errorf("%s: got %d, want %d (%v)", step.name, res.Status, step.want, res.Body)
+		}
+	}
+
+	db.First(&user, user.ID)
+	if user.TwoFactorMethod != "" {
+		t.Errorf("two-factor still %q after disabling", user.TwoFactorMethod)
+	}
+}
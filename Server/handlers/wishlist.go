@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+
+	"injera-gebeya-platform/Server/config"
+	"injera-gebeya-platform/Server/middleware"
+	"injera-gebeya-platform/Server/models"
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// AddToWishlistRequest represents the request for saving a product
+type AddToWishlistRequest struct {
+	ProductID uint `json:"product_id" validate:"required"`
+}
+
+// GetWishlist lists the buyer's saved products
+func GetWishlist(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	var items []models.WishlistItem
+	if err := config.DB.Preload("Product", withRemovedProducts).
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Find(&items).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch wishlist"})
+	}
+
+	results := make([]fiber.Map, 0, len(items))
+	for _, item := range items {
+		results = append(results, fiber.Map{
+			"product_id":   item.ProductID,
+			"product":      item.Product,
+			"stock_status": item.Product.StockStatus(),
+			"available":    item.Product.IsPurchasable() && item.Product.DeletedAt.Time.IsZero(),
+			"added_at":     item.CreatedAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{"wishlist": results})
+}
+
+// AddToWishlist saves a product to the buyer's wishlist
+func AddToWishlist(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var req AddToWishlistRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if fieldErrors := middleware.ValidateStruct(req); len(fieldErrors) > 0 {
+		return middleware.ValidationFailed(c, fieldErrors)
+	}
+
+	var product models.Product
+	if err := config.DB.Scopes(models.PublishedProducts).First(&product, req.ProductID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Product not found"})
+	}
+
+	var existing models.WishlistItem
+	if err := config.DB.Where("user_id = ? AND product_id = ?", user.ID, product.ID).First(&existing).Error; err == nil {
+		return c.JSON(fiber.Map{"message": "Product is already in your wishlist"})
+	}
+
+	item := models.WishlistItem{
+		UserID:        user.ID,
+		ProductID:     product.ID,
+		NotifiedPrice: product.Price,
+	}
+	if err := config.DB.Create(&item).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to add to wishlist"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"message": "Added to wishlist"})
+}
+
+// RemoveFromWishlist removes a product from the buyer's wishlist
+func RemoveFromWishlist(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+
+	productID, err := strconv.ParseUint(c.Params("product_id"), 10, 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid product id"})
+	}
+
+	result := config.DB.Unscoped().Where("user_id = ? AND product_id = ?", user.ID, productID).Delete(&models.WishlistItem{})
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to remove from wishlist"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Product is not in your wishlist"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Removed from wishlist"})
+}
+
+// GetWishlistDemand shows sellers how many buyers have saved each of their products
+func GetWishlistDemand(c *fiber.Ctx) error {
+	user := c.Locals("user").(models.User)
+	var demand []struct {
+		ProductID     uint   `json:"product_id"`
+		Name          string `json:"name"`
+		Stock         int    `json:"stock"`
+		WishlistCount int64  `json:"wishlist_count"`
+	}
+	if err := config.DB.Model(&models.Product{}).
+		Select("products.id AS product_id, products.name, products.stock, COUNT(wishlist_items.id) AS wishlist_count").
+		Joins("LEFT JOIN wishlist_items ON wishlist_items.product_id = products.id AND wishlist_items.deleted_at IS NULL").
+		Where("products.seller_id = ?", user.ID).
+		Group("products.id").
+		Order("wishlist_count DESC").
+		Scan(&demand).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch wishlist demand"})
+	}
+
+	return c.JSON(fiber.Map{"products": demand})
+}
+
+// notifyWishlistWatchers emails buyers who saved a product when it gets cheaper
+// or comes back in stock. Runs in the background.
+func notifyWishlistWatchers(before, after models.Product) {
+	priceDropped := after.Price < before.Price
+	backInStock := before.Stock <= 0 && after.Stock > 0
+	if !after.IsPurchasable() || (!priceDropped && !backInStock) {
+		return
+	}
+
+	go func() {
+		var items []models.WishlistItem
+		if err := config.DB.Where("product_id = ?", after.ID).Find(&items).Error; err != nil {
+			log.Printf("❌ Failed to load wishlist watchers for product %d: %v", after.ID, err)
+			return
+		}
+		if len(items) == 0 {
+			return
+		}
+
+		emailService := services.NewEmailService()
+		for _, item := range items {
+			var buyer models.User
+			if err := config.DB.First(&buyer, item.UserID).Error; err != nil {
+				continue
+			}
+
+			err := config.DB.Transaction(func(tx *gorm.DB) error {
+				queued := emailService.Queue(tx).InLocale(buyer.Locale)
+				if backInStock {
+					if err := queued.SendBackInStockEmail(buyer.Email, buyer.Name, after.Name, after.ID); err != nil {
+						return err
+					}
+				}
+
+				// Only notify about prices lower than the last one the buyer was told about
+				if priceDropped && after.Price < item.NotifiedPrice {
+					if err := queued.SendPriceDropEmail(buyer.Email, buyer.Name, after.Name, after.ID, item.NotifiedPrice, after.Price); err != nil {
+						return err
+					}
+					return tx.Model(&item).Update("notified_price", after.Price).Error
+				}
+				return nil
+			})
+			if err != nil {
+				log.Printf("⚠️ Failed to queue wishlist emails to %s: %v", buyer.Email, err)
+			}
+		}
+	}()
+}
@@ -8,6 +8,7 @@ import (
 	"injera-gebeya-platform/Server/models"
 	"injera-gebeya-platform/Server/services"
 	"log"
+	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,14 +17,25 @@ import (
 )
 
 func main() {
-	fmt.Println("🚀 Starting Injera Gebeya Platform Server...")
-
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
 		log.Println("⚠️  No .env file found, using system environment variables")
 	}
 
-	app := fiber.New()
+	// `injera-server create-admin ...` sets up an admin account instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		if err := runCreateAdmin(os.Args[2:]); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		return
+	}
+
+	fmt.Println("🚀 Starting Injera Gebeya Platform Server...")
+
+	app := fiber.New(fiber.Config{
+		// Leaves room for 5MB KYC documents and product import files
+		BodyLimit: 10 * 1024 * 1024,
+	})
 
 	// Security middleware
 	app.Use(middleware.HelmetMiddleware())
@@ -34,7 +46,7 @@ func main() {
 	// CORS configuration
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:5174,http://localhost:5175,http://localhost:80,http://localhost",
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
+		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS",
 		AllowHeaders:     "Origin, Content-Type, Accept, X-Request-ID, Authorization",
 		AllowCredentials: true,
 	}))
@@ -42,9 +54,12 @@ func main() {
 	fmt.Println("🔗 Connecting to database...")
 	config.ConnectDatabase()
 
-	fmt.Println("📊 Running database migrations...")
-	config.DB.AutoMigrate(&models.User{}, &models.Product{}, &models.Order{}, &models.OrderItem{}, &models.PendingRegistration{})
-	fmt.Println("✅ Database migrations completed!")
+	runMigrations()
+
+	// Deliver queued emails in the background
+	services.StartEmailOutboxWorker(config.DB)
+	// Expire unpaid Chapa checkouts and give back the promotion uses they held
+	handlers.StartPendingOrderCleanup()
 
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("Server running!")
@@ -70,46 +85,185 @@ func main() {
 			"status":           "ok",
 			"database":         dbStatus,
 			"email_configured": emailConfigured,
+			"sms_configured":   services.IsSMSConfigured(),
 			"timestamp":        time.Now().Unix(),
 		})
 	})
 
 	// Authentication routes
-	app.Post("/api/register", handlers.Register)
-	app.Post("/api/login", handlers.Login)
+	app.Post("/api/register", middleware.StrictRateLimiter(), handlers.Register)
+	app.Post("/api/login", middleware.StrictRateLimiter(), handlers.Login)
 	app.Post("/api/logout", handlers.Logout)
+	app.Post("/api/password/forgot", middleware.StrictRateLimiter(), handlers.ForgotPassword)
+	app.Post("/api/password/reset", middleware.StrictRateLimiter(), handlers.ResetPassword)
+	app.Post("/api/auth/refresh", middleware.RateLimiter(), handlers.RefreshToken)
+	app.Post("/api/logout/all", middleware.RequireAuth, handlers.LogoutAllDevices)
+	app.Get("/api/sessions", middleware.RequireAuth, middleware.RateLimiter(), handlers.GetSessions)
+	app.Delete("/api/sessions/:id", middleware.RequireAuth, middleware.RateLimiter(), handlers.RevokeSession)
+
+	// Phone sign-up and sign-in with codes sent by SMS
+	app.Post("/api/register/phone/code", middleware.StrictRateLimiter(), handlers.RequestPhoneSignupCode)
+	app.Post("/api/register/phone", middleware.StrictRateLimiter(), handlers.PhoneSignup)
+	app.Post("/api/login/phone/code", middleware.StrictRateLimiter(), handlers.RequestPhoneLoginCode)
+	app.Post("/api/login/phone", middleware.StrictRateLimiter(), handlers.PhoneLogin)
+
+	// Sign-in with Google or another OpenID Connect provider
+	app.Get("/api/auth/oidc/providers", handlers.GetOIDCProviders)
+	app.Post("/api/auth/oidc/callback", middleware.StrictRateLimiter(), handlers.OIDCCallback)
+	app.Post("/api/auth/oidc/signup", middleware.StrictRateLimiter(), handlers.CompleteOIDCSignup)
+	app.Post("/api/auth/oidc/:provider", middleware.StrictRateLimiter(), handlers.StartOIDCLogin)
+
+	// Two-factor authentication: finishing a sign-in, then managing the user's own settings
+	app.Post("/api/login/2fa", middleware.StrictRateLimiter(), handlers.VerifyLoginChallenge)
+	app.Post("/api/login/2fa/email", middleware.StrictRateLimiter(), handlers.ResendLoginChallengeCode)
+	app.Get("/api/2fa", middleware.RequireAuth, middleware.RateLimiter(), handlers.GetTwoFactorStatus)
+	app.Post("/api/2fa/totp/setup", middleware.RequireAuth, middleware.RateLimiter(), handlers.SetupTOTP)
+	app.Post("/api/2fa/totp/enable", middleware.RequireAuth, middleware.StrictRateLimiter(), handlers.EnableTOTP)
+	app.Post("/api/2fa/email/enable", middleware.RequireAuth, middleware.RateLimiter(), handlers.EnableEmailTwoFactor)
+	app.Post("/api/2fa/disable", middleware.RequireAuth, middleware.StrictRateLimiter(), handlers.DisableTwoFactor)
+	app.Post("/api/2fa/recovery-codes", middleware.RequireAuth, middleware.StrictRateLimiter(), handlers.RegenerateRecoveryCodes)
 
 	// Email verification routes
-	app.Post("/api/verify-email", handlers.VerifyEmail)
+	app.Post("/api/verify-email", middleware.StrictRateLimiter(), handlers.VerifyEmail)
 	app.Get("/api/verify-email/info", handlers.GetVerificationInfo)
-	app.Post("/api/resend-verification", handlers.ResendVerificationEmail)
+	app.Post("/api/resend-verification", middleware.StrictRateLimiter(), handlers.ResendVerificationEmail)
 	app.Get("/api/verification-status", middleware.RequireAuth, handlers.CheckVerificationStatus)
 
 	// ✅ New route — no new file needed
 	app.Get("/api/me", middleware.RequireAuth, func(c *fiber.Ctx) error {
 		user := c.Locals("user").(models.User)
 		return c.JSON(fiber.Map{
-			"id":    user.ID,
-			"name":  user.Name,
-			"email": user.Email,
-			"role":  user.Role,
+			"id":     user.ID,
+			"name":   user.Name,
+			"email":  user.Email,
+			"phone":  user.Phone,
+			"role":   user.Role,
+			"locale": user.Locale,
 		})
 	})
+	app.Put("/api/me/locale", middleware.RequireAuth, middleware.RateLimiter(), handlers.UpdateLocale)
+
+	// Linking a phone number or email address to the signed-in account
+	app.Post("/api/me/phone", middleware.RequireAuth, middleware.StrictRateLimiter(), handlers.StartPhoneLink)
+	app.Post("/api/me/phone/verify", middleware.RequireAuth, middleware.StrictRateLimiter(), handlers.VerifyPhoneLink)
+	app.Delete("/api/me/phone", middleware.RequireAuth, middleware.RateLimiter(), handlers.RemovePhone)
+	app.Post("/api/me/email", middleware.RequireAuth, middleware.StrictRateLimiter(), handlers.StartEmailLink)
+	app.Post("/api/me/email/verify", middleware.RequireAuth, middleware.StrictRateLimiter(), handlers.VerifyEmailLink)
+	app.Get("/api/me/oidc", middleware.RequireAuth, handlers.GetOIDCIdentities)
+	app.Post("/api/me/oidc/:provider", middleware.RequireAuth, middleware.StrictRateLimiter(), handlers.StartOIDCLink)
+	app.Delete("/api/me/oidc/:provider", middleware.RequireAuth, middleware.RateLimiter(), handlers.UnlinkOIDCIdentity)
 
-	// Seller routes
-	app.Get("/seller/products", middleware.RequireAuth, handlers.GetSellerProducts)
-	app.Post("/seller/products", middleware.RequireAuth, handlers.CreateProduct)
-	app.Put("/seller/products/:id", middleware.RequireAuth, handlers.UpdateProduct)
-	app.Delete("/seller/products/:id", middleware.RequireAuth, handlers.DeleteProduct)
+	// Role and permission checks, placed after RequireAuth
+	placeOrders := middleware.RequirePermission(models.PermissionPlaceOrders)
+	manageWishlist := middleware.RequirePermission(models.PermissionManageWishlist)
+	manageProducts := middleware.RequirePermission(models.PermissionManageProducts)
+	fulfillOrders := middleware.RequirePermission(models.PermissionFulfillOrders)
+	manageStore := middleware.RequirePermission(models.PermissionManageStore)
+	manageEmails := middleware.RequirePermission(models.PermissionManageEmails)
+	sellersOnly := middleware.RequireRole(models.RoleSeller)
+	adminOnly := middleware.RequireRole(models.RoleAdmin)
+
+	// Seller routes; API keys with the matching scope can call these too
+	readProducts := middleware.APIKeyScope(models.ScopeProductsRead)
+	writeProducts := middleware.APIKeyScope(models.ScopeProductsWrite)
+	app.Get("/seller/products", readProducts, middleware.RequireAuth, manageProducts, handlers.GetSellerProducts)
+	app.Post("/seller/products", writeProducts, middleware.RequireAuth, manageProducts, handlers.CreateProduct)
+	app.Post("/seller/products/import", writeProducts, middleware.RequireAuth, manageProducts, handlers.ImportProducts)
+	app.Get("/seller/products/export", readProducts, middleware.RequireAuth, manageProducts, handlers.ExportProducts)
+	app.Put("/seller/products/:id", writeProducts, middleware.RequireAuth, manageProducts, handlers.UpdateProduct)
+	app.Patch("/seller/products/:id", writeProducts, middleware.RequireAuth, manageProducts, handlers.UpdateProduct)
+	app.Delete("/seller/products/:id", writeProducts, middleware.RequireAuth, manageProducts, handlers.DeleteProduct)
+	app.Post("/seller/products/:id/publish", writeProducts, middleware.RequireAuth, manageProducts, handlers.PublishProduct)
+	app.Post("/seller/products/:id/unpublish", writeProducts, middleware.RequireAuth, manageProducts, handlers.UnpublishProduct)
+
+	// Seller API keys (managed from a signed-in session only)
+	app.Get("/api/seller/api-keys", middleware.RequireAuth, sellersOnly, middleware.RateLimiter(), handlers.GetAPIKeys)
+	app.Post("/api/seller/api-keys", middleware.RequireAuth, sellersOnly, middleware.RateLimiter(), handlers.CreateAPIKey)
+	app.Delete("/api/seller/api-keys/:id", middleware.RequireAuth, sellersOnly, middleware.RateLimiter(), handlers.RevokeAPIKey)
+
+	// Seller onboarding: upload KYC documents and submit them for review
+	app.Get("/api/seller/application", middleware.RequireAuth, sellersOnly, middleware.RateLimiter(), handlers.GetSellerApplication)
+	app.Post("/api/seller/application/documents/:kind", middleware.RequireAuth, sellersOnly, middleware.StrictRateLimiter(), handlers.UploadSellerDocument)
+	app.Post("/api/seller/application/submit", middleware.RequireAuth, sellersOnly, middleware.RateLimiter(), handlers.SubmitSellerApplication)
 
 	// Order routes with rate limiting and validation
-	app.Post("/api/orders", middleware.RequireAuth, middleware.OrderRateLimiter(), middleware.ValidateOrderInput, handlers.CreateOrder)
+	app.Post("/api/orders", middleware.RequireAuth, placeOrders, middleware.OrderRateLimiter(), middleware.ValidateOrderInput, handlers.CreateOrder)
 	app.Get("/api/orders", middleware.RequireAuth, middleware.RateLimiter(), handlers.GetUserOrders)
 	// Place the more specific tx_ref route BEFORE the :id route to avoid conflicts
 	app.Get("/api/orders/tx/:tx_ref", middleware.RequireAuth, middleware.RateLimiter(), handlers.GetOrderByTxRef)
 	app.Get("/api/orders/:id", middleware.RequireAuth, middleware.RateLimiter(), handlers.GetOrder)
-	app.Put("/api/orders/:id/status", middleware.RequireAuth, middleware.OrderRateLimiter(), middleware.ValidateStatusUpdate, handlers.UpdateOrderStatus)
-	app.Get("/api/seller/orders", middleware.RequireAuth, middleware.RateLimiter(), handlers.GetSellerOrders)
+	app.Get("/api/orders/:id/invoice.pdf", middleware.RequireAuth, middleware.RateLimiter(), handlers.GetOrderInvoice)
+	app.Put("/api/orders/:id/status", middleware.RequireAuth, fulfillOrders, middleware.OrderRateLimiter(), middleware.ValidateStatusUpdate, handlers.UpdateOrderStatus)
+	app.Get("/api/seller/orders", middleware.APIKeyScope(models.ScopeOrdersRead), middleware.RequireAuth, fulfillOrders, middleware.RateLimiter(), handlers.GetSellerOrders)
+
+	// Review routes
+	app.Post("/api/products/:id/reviews", middleware.RequireAuth, middleware.RateLimiter(), handlers.CreateReview)
+	app.Put("/api/reviews/:id/reply", middleware.RequireAuth, manageStore, middleware.RateLimiter(), handlers.ReplyToReview)
+	app.Post("/api/reviews/:id/flag", middleware.RequireAuth, middleware.RateLimiter(), handlers.FlagReview)
+
+	// Promotion routes
+	app.Post("/api/promotions/quote", middleware.RequireAuth, middleware.RateLimiter(), handlers.QuoteOrder)
+	app.Get("/api/seller/promotions", middleware.RequireAuth, manageStore, middleware.RateLimiter(), handlers.GetSellerPromotions)
+	app.Post("/api/seller/promotions", middleware.RequireAuth, manageStore, middleware.RateLimiter(), handlers.CreateSellerPromotion)
+	app.Delete("/api/seller/promotions/:id", middleware.RequireAuth, manageStore, middleware.RateLimiter(), handlers.DeactivateSellerPromotion)
+
+	// Shipping routes
+	app.Get("/api/shipping/zones", handlers.GetShippingZones)
+	app.Post("/api/shipping/quote", middleware.RequireAuth, middleware.RateLimiter(), handlers.QuoteShipping)
+	app.Get("/api/seller/shipping-rates", middleware.RequireAuth, manageStore, middleware.RateLimiter(), handlers.GetSellerShippingRates)
+	app.Put("/api/seller/shipping-rates", middleware.RequireAuth, manageStore, middleware.RateLimiter(), handlers.SetSellerShippingRate)
+
+	// Tax routes
+	app.Get("/api/tax/rules", handlers.GetTaxRules)
+	app.Put("/api/seller/tax-profile", middleware.RequireAuth, manageStore, middleware.RateLimiter(), handlers.UpdateSellerTaxProfile)
+
+	// Wishlist routes
+	app.Get("/api/wishlist", middleware.RequireAuth, manageWishlist, middleware.RateLimiter(), handlers.GetWishlist)
+	app.Post("/api/wishlist", middleware.RequireAuth, manageWishlist, middleware.RateLimiter(), handlers.AddToWishlist)
+	app.Delete("/api/wishlist/:product_id", middleware.RequireAuth, manageWishlist, middleware.RateLimiter(), handlers.RemoveFromWishlist)
+	app.Get("/api/seller/wishlist-demand", middleware.RequireAuth, manageStore, middleware.RateLimiter(), handlers.GetWishlistDemand)
+
+	// Admin routes
+	app.Get("/api/admin/email-outbox", middleware.RequireAuth, manageEmails, middleware.RateLimiter(), handlers.GetEmailOutbox)
+	app.Post("/api/admin/email-outbox/:id/resend", middleware.RequireAuth, manageEmails, middleware.RateLimiter(), handlers.ResendEmail)
+	app.Get("/api/admin/email-templates", middleware.RequireAuth, manageEmails, middleware.RateLimiter(), handlers.GetEmailTemplates)
+	app.Get("/api/admin/email-templates/:name/preview", middleware.RequireAuth, manageEmails, middleware.RateLimiter(), handlers.PreviewEmailTemplate)
+
+	// Admin back-office; every change is recorded in the audit log
+	app.Get("/api/admin/stats", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetAdminStats)
+	app.Get("/api/admin/audit-log", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetAuditLog)
+	app.Get("/api/admin/users", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetAdminUsers)
+	app.Get("/api/admin/users/:id", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetAdminUser)
+	app.Post("/api/admin/users/:id/suspend", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.SuspendUser)
+	app.Post("/api/admin/users/:id/unsuspend", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.UnsuspendUser)
+	app.Put("/api/admin/users/:id/role", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.UpdateUserRole)
+	app.Post("/api/admin/users/:id/reset-2fa", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.ResetUserTwoFactor)
+	app.Get("/api/admin/seller-applications", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetSellerApplications)
+	app.Get("/api/admin/seller-applications/:id", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetAdminSellerApplication)
+	app.Get("/api/admin/seller-applications/:id/documents/:kind", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetSellerApplicationDocument)
+	app.Post("/api/admin/seller-applications/:id/approve", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.ApproveSellerApplication)
+	app.Post("/api/admin/seller-applications/:id/reject", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.RejectSellerApplication)
+	app.Get("/api/admin/products", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetAdminProducts)
+	app.Post("/api/admin/products/:id/block", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.BlockProduct)
+	app.Post("/api/admin/products/:id/unblock", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.UnblockProduct)
+	app.Get("/api/admin/reviews", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetAdminReviews)
+	app.Get("/api/admin/reviews/:id", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetAdminReview)
+	app.Post("/api/admin/reviews/:id/hide", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.HideReview)
+	app.Post("/api/admin/reviews/:id/restore", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.RestoreReview)
+	app.Post("/api/admin/reviews/:id/dismiss-flags", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.DismissReviewFlags)
+	app.Get("/api/admin/orders", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetAdminOrders)
+	app.Get("/api/admin/orders/:id", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetAdminOrder)
+	app.Post("/api/admin/orders/:id/cancel", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.AdminCancelOrder)
+	app.Post("/api/admin/orders/:id/refund", middleware.RequireAuth, adminOnly, middleware.StrictRateLimiter(), handlers.AdminRefundOrder)
+	app.Put("/api/admin/orders/:id/status", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.AdminOverrideOrderStatus)
+	app.Get("/api/admin/promotions", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetPlatformPromotions)
+	app.Post("/api/admin/promotions", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.CreatePlatformPromotion)
+	app.Delete("/api/admin/promotions/:id", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.DeactivatePlatformPromotion)
+	app.Post("/api/admin/tax-rules", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.CreateTaxRule)
+	app.Put("/api/admin/tax-rules/:id", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.UpdateTaxRule)
+	app.Delete("/api/admin/tax-rules/:id", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.DeleteTaxRule)
+	app.Get("/api/admin/shipping-rates", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.GetPlatformShippingRates)
+	app.Put("/api/admin/shipping-rates", middleware.RequireAuth, adminOnly, middleware.RateLimiter(), handlers.SetPlatformShippingRate)
 
 	// Payment routes
 	app.Post("/api/create-payment-intent", middleware.RequireAuth, handlers.CreateStripePaymentIntent)
@@ -131,6 +285,9 @@ func main() {
 	})
 
 	app.Get("/products", handlers.GetPublicProducts)
+	app.Get("/products/:id", handlers.GetProduct)
+	app.Get("/products/:id/reviews", handlers.GetProductReviews)
+	app.Get("/shops/:id", handlers.GetShop)
 
 	fmt.Println("🌐 Server starting on port 3000...")
 	fmt.Println("📡 Available endpoints:")
@@ -138,20 +295,78 @@ func main() {
 	fmt.Println("   GET  /health - Health check")
 	fmt.Println("   POST /api/register - User registration")
 	fmt.Println("   POST /api/login - User login")
+	fmt.Println("   POST /api/register/phone - Register a buyer with a phone number and SMS code")
+	fmt.Println("   POST /api/login/phone - Log in with a phone number and SMS code")
+	fmt.Println("   POST /api/auth/oidc/:provider - Start sign-in with Google or another OpenID Connect provider")
+	fmt.Println("   POST /api/auth/oidc/signup - Pick a role after a first social sign-in")
+	fmt.Println("   POST /api/login/2fa - Finish a login with an authenticator, email or recovery code")
+	fmt.Println("   POST /api/2fa/totp/setup - Set up an authenticator app (QR code)")
+	fmt.Println("   POST /api/password/forgot - Email a password reset code and link")
+	fmt.Println("   POST /api/password/reset - Set a new password with the reset code or link token")
+	fmt.Println("   POST /api/auth/refresh - Rotate refresh token for a new access token")
+	fmt.Println("   POST /api/logout/all - Log out of all devices")
+	fmt.Println("   GET  /api/sessions - List signed-in devices")
 	fmt.Println("   GET  /products - Get products")
+	fmt.Println("   GET  /products/:id - Get product details")
+	fmt.Println("   GET  /shops/:id - Get seller storefront")
+	fmt.Println("   GET  /products/:id/reviews - Get product reviews")
+	fmt.Println("   POST /api/products/:id/reviews - Review a delivered product")
 	fmt.Println("   POST /api/orders - Create order")
 	fmt.Println("   GET  /api/orders - Get user orders")
 	fmt.Println("   GET  /api/orders/:id - Get specific order")
+	fmt.Println("   GET  /api/orders/:id/invoice.pdf - Download order invoice")
 	fmt.Println("   PUT  /api/orders/:id/status - Update order status")
 	fmt.Println("   GET  /api/seller/orders - Get seller orders")
+	fmt.Println("   POST /api/seller/api-keys - Create a scoped API key for integrations")
+	fmt.Println("   POST /api/seller/application/documents/:kind - Upload trade licence or national ID for review")
+	fmt.Println("   POST /api/seller/application/submit - Submit seller documents for approval")
+	fmt.Println("   POST /api/promotions/quote - Price a cart with discounts")
+	fmt.Println("   POST /api/shipping/quote - Price a cart with shipping before payment")
+	fmt.Println("   PUT  /api/seller/tax-profile - Set seller TIN and VAT registration")
+	fmt.Println("   POST /api/admin/tax-rules - Add VAT/TOT rates for a category; change or remove under /api/admin/tax-rules/:id (admin)")
 	fmt.Println("   POST /api/create-payment-intent - Create Stripe payment intent (TEST MODE)")
 	fmt.Println("   POST /api/stripe/webhook - Stripe webhook handler")
 	fmt.Println("   POST /api/create-chapa-payment - Create Chapa payment (TEST MODE)")
 	fmt.Println("   POST /api/chapa/callback - Chapa payment callback")
 	fmt.Println("   GET  /api/chapa/verify/:tx_ref - Verify Chapa payment")
+	fmt.Println("   PUT  /api/me/locale - Set email language (en, am, om)")
+	fmt.Println("   GET  /api/admin/email-outbox - Inspect queued and failed emails (admin)")
+	fmt.Println("   GET  /api/admin/email-templates/:name/preview - Preview an email with sample data (admin)")
+	fmt.Println("   GET  /api/admin/stats - Marketplace KPIs (admin)")
+	fmt.Println("   GET  /api/admin/users - Search users; suspend and change roles under /api/admin/users/:id (admin)")
+	fmt.Println("   GET  /api/admin/seller-applications - Seller KYC reviews; approve or reject under /api/admin/seller-applications/:id (admin)")
+	fmt.Println("   GET  /api/admin/orders - Any order; cancel, refund or override status under /api/admin/orders/:id (admin)")
+	fmt.Println("   POST /api/admin/products/:id/block - Take a product down (admin)")
+	fmt.Println("   GET  /api/admin/reviews - Flagged reviews; hide, restore or dismiss flags under /api/admin/reviews/:id (admin)")
+	fmt.Println("   GET  /api/admin/audit-log - Actions taken by admins (admin)")
 
 	err := app.Listen(":3000")
 	if err != nil {
 		fmt.Printf("❌ Server failed to start: %v\n", err)
 	}
 }
+
+// runMigrations creates and updates the tables, then backfills and seeds data
+func runMigrations() {
+	fmt.Println("📊 Running database migrations...")
+	// Sellers from before onboarding are grandfathered in once, when its table is created
+	introducingOnboarding := !config.DB.Migrator().HasTable(&models.SellerApplication{})
+	// Shop slugs became unique; sellers sharing one have to be told apart before the index
+	models.DedupeShopSlugs(config.DB)
+	config.DB.AutoMigrate(&models.User{}, &models.Product{}, &models.ProductImage{}, &models.Order{}, &models.OrderItem{}, &models.PendingRegistration{},
+		&models.Review{}, &models.ReviewPhoto{}, &models.ReviewFlag{}, &models.WishlistItem{},
+		&models.Promotion{}, &models.PromotionRedemption{}, &models.ShippingZone{}, &models.ShippingRate{},
+		&models.TaxRule{}, &models.OrderTaxLine{}, &models.EmailOutbox{}, &models.Session{}, &models.PasswordReset{}, &models.APIKey{}, &models.AuditLog{}, &models.SellerApplication{},
+		&models.LoginChallenge{}, &models.RecoveryCode{}, &models.AuthThrottle{}, &models.OneTimeCode{},
+		&models.OAuthIdentity{}, &models.OAuthLogin{}, &models.OAuthSignup{})
+	if introducingOnboarding {
+		models.ApproveExistingSellers(config.DB)
+	}
+	models.BackfillShopSlugs(config.DB)
+	models.BackfillOrderItemSnapshots(config.DB)
+	models.SeedShippingZones(config.DB)
+	models.SeedTaxRules(config.DB)
+	models.RedactSentEmails(config.DB)
+	models.BackfillRefundedAmounts(config.DB)
+	fmt.Println("✅ Database migrations completed!")
+}
@@ -1,53 +1,115 @@
 package middleware
 
 import (
-	"fmt"
 	"injera-gebeya-platform/Server/config"
 	"injera-gebeya-platform/Server/models"
-	"os"
+	"injera-gebeya-platform/Server/services"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func RequireAuth(c *fiber.Ctx) error {
-	tokenStr := c.Cookies("token")
-	if tokenStr == "" {
-		return c.Status(401).JSON(fiber.Map{"error": "Missing token"})
+// lastSeenInterval limits how often a session's last-seen time and IP are written
+const lastSeenInterval = time.Minute
+
+// SetSessionCookies stores the access token, and the refresh token when one was issued,
+// in HTTP-only cookies
+func SetSessionCookies(c *fiber.Ctx, tokens *services.SessionTokens) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "token",
+		Value:    tokens.AccessToken,
+		Expires:  tokens.AccessExpiresAt,
+		HTTPOnly: true,
+		Secure:   false, // true in production
+		SameSite: "Lax",
+		Path:     "/",
+	})
+	if tokens.RefreshToken == "" {
+		return
 	}
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    tokens.RefreshToken,
+		Expires:  tokens.RefreshExpiresAt,
+		HTTPOnly: true,
+		Secure:   false, // true in production
+		SameSite: "Lax",
+		Path:     "/",
+	})
+}
 
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "supersecret"
+// ClearSessionCookies removes the access and refresh token cookies
+func ClearSessionCookies(c *fiber.Ctx) {
+	for _, name := range []string{"token", "refresh_token"} {
+		c.Cookie(&fiber.Cookie{
+			Name:     name,
+			Value:    "",
+			Expires:  time.Now().Add(-1 * time.Hour), // Set to past time to delete
+			HTTPOnly: true,
+			Secure:   false, // true in production
+			SameSite: "Lax",
+			Path:     "/",
+		})
 	}
+}
 
-	// Parse and validate token
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return []byte(secret), nil
-	})
-	if err != nil || !token.Valid {
-		return c.Status(401).JSON(fiber.Map{"error": "Invalid token"})
+// BearerToken returns the credential from an "Authorization: Bearer" header, if any
+func BearerToken(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
 	}
+	return ""
+}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return c.Status(401).JSON(fiber.Map{"error": "Invalid claims"})
+// APIKeyScope lets API keys holding scope call the route. RequireAuth turns API keys
+// away from routes without it, so a key only reaches the endpoints it was made for.
+func APIKeyScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals("api_key_scope", scope)
+		return c.Next()
 	}
+}
 
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		return c.Status(401).JSON(fiber.Map{"error": "Invalid user id in token"})
+// RequireAuth accepts an access token, from the Authorization header or the token
+// cookie, whose session has not been revoked, or a seller API key on routes that allow
+// it. When the access token cookie has expired, browsers are refreshed transparently
+// with the refresh token cookie so they don't have to handle token expiry themselves.
+func RequireAuth(c *fiber.Ctx) error {
+	var userID uint
+	if bearer := BearerToken(c); services.IsAPIKey(bearer) {
+		key, err := services.AuthenticateAPIKey(config.DB, bearer)
+		if err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "Invalid API key"})
+		}
+		scope, _ := c.Locals("api_key_scope").(string)
+		if scope == "" {
+			return c.Status(403).JSON(fiber.Map{"error": "API keys can't be used for this endpoint"})
+		}
+		if !key.HasScope(scope) {
+			return c.Status(403).JSON(fiber.Map{"error": "API key is missing the " + scope + " scope"})
+		}
+		userID = key.UserID
+		c.Locals("api_key_id", key.ID)
+	} else {
+		session, status, msg := authenticateSession(c, bearer)
+		if session == nil {
+			return c.Status(status).JSON(fiber.Map{"error": msg})
+		}
+		userID = session.UserID
+		c.Locals("session_id", session.ID)
 	}
 
 	var user models.User
-	if err := config.DB.First(&user, uint(userIDFloat)).Error; err != nil {
+	if err := config.DB.Where("id = ?", userID).First(&user).Error; err != nil {
 		return c.Status(401).JSON(fiber.Map{"error": "User not found"})
 	}
+	if user.Suspended() {
+		return c.Status(403).JSON(fiber.Map{"error": "Your account has been suspended", "suspended": true})
+	}
 
-	// Check if email is verified for protected operations
+	// Check if the email or phone number is verified for protected operations
 	// Allow access to verification endpoints without email verification
 	path := c.Path()
 	isVerificationEndpoint := path == "/api/verify-email" ||
@@ -55,7 +117,7 @@ func RequireAuth(c *fiber.Ctx) error {
 		path == "/api/verification-info" ||
 		path == "/api/verification-status"
 
-	if !user.EmailVerified && !isVerificationEndpoint {
+	if !user.Verified() && !isVerificationEndpoint {
 		return c.Status(403).JSON(fiber.Map{
 			"error":                "Please verify your email before accessing this resource",
 			"email":                user.Email,
@@ -63,9 +125,67 @@ func RequireAuth(c *fiber.Ctx) error {
 		})
 	}
 
-	c.Locals("user_id", uint(userIDFloat))
+	c.Locals("user_id", userID)
 	c.Locals("role", user.Role)
 	c.Locals("user", user) // ✅ Attach full user object
 
 	return c.Next()
 }
+
+// SessionUserID returns the user behind the request's access token or session cookies,
+// for public routes that behave differently for a signed-in user. API keys don't count.
+func SessionUserID(c *fiber.Ctx) (uint, bool) {
+	bearer := BearerToken(c)
+	if services.IsAPIKey(bearer) {
+		return 0, false
+	}
+	session, _, _ := authenticateSession(c, bearer)
+	if session == nil {
+		return 0, false
+	}
+	return session.UserID, true
+}
+
+// authenticateSession checks a bearer access token, or the cookies when there is none,
+// and returns the live session behind it
+func authenticateSession(c *fiber.Ctx, bearer string) (*models.Session, int, string) {
+	var claims *services.AccessClaims
+	if bearer != "" {
+		// API clients refresh their own tokens through /api/auth/refresh
+		parsed, err := services.ParseAccessToken(bearer)
+		if err != nil {
+			return nil, 401, "Invalid token"
+		}
+		claims = parsed
+	} else {
+		tokenStr := c.Cookies("token")
+		refreshToken := c.Cookies("refresh_token")
+		if tokenStr == "" && refreshToken == "" {
+			return nil, 401, "Missing token"
+		}
+
+		parsed, err := services.ParseAccessToken(tokenStr)
+		if err != nil {
+			if refreshToken == "" {
+				return nil, 401, "Invalid token"
+			}
+			tokens, err := services.RefreshSession(config.DB, refreshToken, c.Get("User-Agent"), c.IP())
+			if err != nil {
+				ClearSessionCookies(c)
+				return nil, 401, "Session expired, please log in again"
+			}
+			SetSessionCookies(c, tokens)
+			parsed = &services.AccessClaims{UserID: tokens.Session.UserID, SessionID: tokens.Session.ID}
+		}
+		claims = parsed
+	}
+
+	var session models.Session
+	if err := config.DB.Where("id = ? AND user_id = ?", claims.SessionID, claims.UserID).First(&session).Error; err != nil || !session.Active() {
+		return nil, 401, "Session has been revoked"
+	}
+	if time.Since(session.LastSeenAt) > lastSeenInterval {
+		config.DB.Model(&session).Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip": c.IP()})
+	}
+	return &session, 0, ""
+}
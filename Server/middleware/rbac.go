@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole only lets users with one of roles through. It goes after RequireAuth.
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		for _, r := range roles {
+			if r == role {
+				return c.Next()
+			}
+		}
+		return c.Status(403).JSON(fiber.Map{"error": "Your account doesn't have access to this resource"})
+	}
+}
+
+// RequirePermission only lets users whose role grants permission through. It goes
+// after RequireAuth.
+func RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if !models.HasPermission(role, permission) {
+			return c.Status(403).JSON(fiber.Map{
+				"error":      "You don't have permission to do this",
+				"permission": permission,
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"injera-gebeya-platform/Server/services"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+// validate is the shared struct-tag validator used by all handlers
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// Report JSON field names instead of Go struct field names
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	// et_phone accepts Ethiopian mobile numbers in any form NormalizePhone understands
+	v.RegisterValidation("et_phone", func(fl validator.FieldLevel) bool {
+		_, ok := services.NormalizePhone(fl.Field().String())
+		return ok
+	})
+	return v
+}
+
+// FieldError describes a single failed validation rule
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidateStruct checks the `validate:` tags on s and returns one entry per failing field
+func ValidateStruct(s interface{}) []FieldError {
+	err := validate.Struct(s)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []FieldError{{Field: "", Rule: "invalid", Message: err.Error()}}
+	}
+
+	fieldErrors := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		field := fieldPath(fe)
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Message: fieldErrorMessage(field, fe),
+		})
+	}
+	return fieldErrors
+}
+
+// ValidationFailed writes the standard 400 response for field-level validation errors
+func ValidationFailed(c *fiber.Ctx, fieldErrors []FieldError) error {
+	return c.Status(400).JSON(fiber.Map{
+		"error":  "Validation failed",
+		"fields": fieldErrors,
+	})
+}
+
+// fieldPath drops the top-level struct name, e.g. "CreateOrderRequest.items[0].quantity" -> "items[0].quantity"
+func fieldPath(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if idx := strings.Index(namespace, "."); idx >= 0 {
+		return namespace[idx+1:]
+	}
+	return fe.Field()
+}
+
+func fieldErrorMessage(field string, fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "min":
+		return fmt.Sprintf("%s must be at least %s%s", field, fe.Param(), lengthUnit(fe.Kind(), fe.Param()))
+	case "max":
+		return fmt.Sprintf("%s must be at most %s%s", field, fe.Param(), lengthUnit(fe.Kind(), fe.Param()))
+	case "required_if", "required_without":
+		return fmt.Sprintf("%s is required", field)
+	case "len":
+		return fmt.Sprintf("%s must be exactly %s%s", field, fe.Param(), lengthUnit(fe.Kind(), fe.Param()))
+	case "numeric":
+		return fmt.Sprintf("%s must contain only digits", field)
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, fe.Param())
+	case "gte":
+		return fmt.Sprintf("%s must be %s or more", field, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", field)
+	case "et_phone":
+		return fmt.Sprintf("%s must be an Ethiopian mobile number, e.g. 0912345678 or +251912345678", field)
+	case "http_url", "url":
+		return fmt.Sprintf("%s must be a valid http(s) URL", field)
+	default:
+		return fmt.Sprintf("%s failed the %s rule", field, fe.Tag())
+	}
+}
+
+// lengthUnit describes what min/max count for strings and slices
+func lengthUnit(kind reflect.Kind, param string) string {
+	unit := ""
+	switch kind {
+	case reflect.String:
+		unit = " character"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " item"
+	default:
+		return ""
+	}
+	if param != "1" {
+		unit += "s"
+	}
+	return unit
+}
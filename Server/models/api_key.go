@@ -0,0 +1,55 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// API key scopes sellers can grant to integrations
+const (
+	ScopeProductsRead  = "products:read"
+	ScopeProductsWrite = "products:write"
+	ScopeOrdersRead    = "orders:read"
+)
+
+// APIKeyScopes lists every scope an API key can be given
+var APIKeyScopes = []string{ScopeProductsRead, ScopeProductsWrite, ScopeOrdersRead}
+
+// APIKey is a personal access key a seller creates for an inventory system or other
+// integration. Only its SHA-256 hash is stored; Prefix identifies it in listings.
+type APIKey struct {
+	gorm.Model
+	UserID     uint       `json:"-" gorm:"index;not null"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;size:64"`
+	Scopes     string     `json:"-"` // Comma-separated, e.g. "products:read,products:write"
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ScopeList returns the key's scopes
+func (k APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// HasScope reports whether the key was granted scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the key can still be used
+func (k APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AuditLog records an action taken through the admin API: who did it, to what, and why.
+// Entries are only ever added.
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+	ActorID    uint      `json:"actor_id" gorm:"index"`
+	ActorEmail string    `json:"actor_email"`
+	Action     string    `json:"action" gorm:"index"` // e.g. "user.suspend", "order.refund"
+	TargetType string    `json:"target_type" gorm:"index:idx_audit_target"`
+	TargetID   uint      `json:"target_id" gorm:"index:idx_audit_target"`
+	Reason     string    `json:"reason"`
+	Details    string    `json:"details" gorm:"type:text"` // JSON with the values before and after
+	IP         string    `json:"ip"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// What an AuthThrottle counts failures for
+const (
+	ThrottleAccount = "account" // Key is the lowercased email, whether or not the account exists
+	ThrottleIP      = "ip"
+)
+
+// AuthThrottle counts recent failed sign-in and verification attempts for one account
+// or IP address. After a few failures each attempt has to wait longer (RetryAt); too
+// many in a row lock the key out until LockedUntil, and each lockout lasts longer.
+type AuthThrottle struct {
+	ID            uint       `gorm:"primarykey"`
+	Scope         string     `gorm:"uniqueIndex:idx_auth_throttle_key;size:16"`
+	Key           string     `gorm:"uniqueIndex:idx_auth_throttle_key"`
+	Failures      int        `gorm:"default:0"`
+	Lockouts      int        `gorm:"default:0"` // Lockouts since the last success, to lengthen the next one
+	LastFailureAt time.Time  `gorm:"index"`
+	RetryAt       *time.Time // No attempts are checked before this
+	LockedUntil   *time.Time
+	UpdatedAt     time.Time
+}
+
+// Locked reports whether the key is in a lockout
+func (t AuthThrottle) Locked() bool {
+	return t.LockedUntil != nil && time.Now().Before(*t.LockedUntil)
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmailStatus tracks an outbox message through delivery
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending"
+	EmailStatusSent    EmailStatus = "sent"
+	EmailStatusDead    EmailStatus = "dead" // Gave up after MaxEmailAttempts; resend from the admin API
+)
+
+// MaxEmailAttempts is how many times the outbox worker tries a message before dead-lettering it
+const MaxEmailAttempts = 8
+
+// EmailOutbox is a rendered email waiting to be sent. Rows are written in the same
+// transaction as the change that triggers the email, then delivered by a background worker.
+// Sent rows keep their envelope for the admin API but not their body.
+type EmailOutbox struct {
+	gorm.Model
+	Template      string      `json:"template" gorm:"index"`
+	To            string      `json:"to" gorm:"not null"`
+	Subject       string      `json:"subject"`
+	ContentType   string      `json:"-"`
+	Body          string      `json:"-" gorm:"type:text"` // Cleared once sent, as it can hold one-time codes and links
+	Status        EmailStatus `json:"status" gorm:"index;default:'pending'"`
+	Attempts      int         `json:"attempts" gorm:"default:0"`
+	NextAttemptAt time.Time   `json:"next_attempt_at" gorm:"index"`
+	LastError     string      `json:"last_error"`
+	SentAt        *time.Time  `json:"sent_at"`
+}
+
+// TableName keeps the table name singular, as it is a queue rather than a collection
+func (EmailOutbox) TableName() string {
+	return "email_outbox"
+}
+
+// RedactSentEmails clears the bodies of emails sent before bodies were cleared on delivery
+func RedactSentEmails(db *gorm.DB) {
+	db.Model(&EmailOutbox{}).Where("status = ? AND body <> ''", EmailStatusSent).Update("body", "")
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// OAuthLoginTTL is how long the user has to sign in at the provider and come back
+	OAuthLoginTTL = 10 * time.Minute
+	// OAuthSignupTTL is how long a first-time user has to pick their role
+	OAuthSignupTTL = 30 * time.Minute
+)
+
+// OAuthIdentity links a user to their account at an OpenID Connect provider. The
+// provider's subject identifies the account, since its email can change.
+type OAuthIdentity struct {
+	gorm.Model
+	UserID      uint       `json:"-" gorm:"index;not null"`
+	Provider    string     `json:"provider" gorm:"uniqueIndex:idx_oauth_identity_subject;size:32"`
+	Subject     string     `json:"-" gorm:"uniqueIndex:idx_oauth_identity_subject"`
+	Email       string     `json:"email"` // As the provider last reported it
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty"`
+}
+
+// OAuthLogin is a sign-in waiting for the user to come back from the provider. The
+// state sent to the provider is only stored hashed; the nonce and PKCE verifier bind
+// the returned code and ID token to this sign-in.
+type OAuthLogin struct {
+	ID           uint   `gorm:"primarykey"`
+	StateHash    string `gorm:"uniqueIndex;size:64"`
+	Provider     string `gorm:"size:32"`
+	Nonce        string
+	CodeVerifier string
+	UserID       uint // Set when a signed-in user is linking the provider to their account
+	IP           string
+	ExpiresAt    time.Time `gorm:"index"`
+	CompletedAt  *time.Time
+	CreatedAt    time.Time
+}
+
+// OAuthSignup holds what a provider told us about a first-time user while they pick
+// whether to join as a buyer or a seller
+type OAuthSignup struct {
+	ID            uint   `gorm:"primarykey"`
+	TokenHash     string `gorm:"uniqueIndex;size:64"`
+	Provider      string `gorm:"size:32"`
+	Subject       string
+	Email         string
+	EmailVerified bool // The provider vouches for the email, so we don't send our own code
+	Name          string
+	ExpiresAt     time.Time `gorm:"index"`
+	CompletedAt   *time.Time
+	CreatedAt     time.Time
+}
+
+// Usable reports whether the signup can still be completed
+func (s OAuthSignup) Usable() bool {
+	return s.CompletedAt == nil && time.Now().Before(s.ExpiresAt)
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// What a OneTimeCode proves the user can receive
+const (
+	CodePhoneSignup = "phone_signup" // A phone number being registered
+	CodePhoneLogin  = "phone_login"  // The phone number of an existing account
+	CodeLinkPhone   = "link_phone"   // A phone number being added to a signed-in account
+	CodeLinkEmail   = "link_email"   // An email address being added to a signed-in account
+	CodeSignupEmail = "signup_email" // An email a social login provider didn't vouch for
+)
+
+const (
+	// OneTimeCodeTTL is how long a texted or emailed code stays valid
+	OneTimeCodeTTL = 10 * time.Minute
+	// MaxOneTimeCodeAttempts is how many wrong codes are accepted before the code is void
+	MaxOneTimeCodeAttempts = 5
+)
+
+// OneTimeCode is a 6-digit code sent by SMS (or by email for an email address) to
+// prove the user controls the destination. Only its hash is stored, and a newer code
+// for the same purpose and destination replaces it.
+type OneTimeCode struct {
+	gorm.Model
+	Purpose     string     `json:"-" gorm:"index;size:16"`
+	Destination string     `json:"-" gorm:"index"` // +2519XXXXXXXX or a lowercased email
+	UserID      uint       `json:"-" gorm:"index"` // 0 while signing up
+	CodeHash    string     `json:"-" gorm:"size:64"`
+	Attempts    int        `json:"-" gorm:"default:0"` // Wrong codes entered
+	IP          string     `json:"-"`
+	ExpiresAt   time.Time  `json:"-" gorm:"index"`
+	UsedAt      *time.Time `json:"-"`
+}
+
+// Usable reports whether the code can still be entered
+func (c OneTimeCode) Usable() bool {
+	return c.UsedAt == nil && c.Attempts < MaxOneTimeCodeAttempts && time.Now().Before(c.ExpiresAt)
+}
@@ -44,12 +44,21 @@ type Order struct {
 	ShippingState   string `json:"shipping_state" gorm:"not null"`
 	ShippingZip     string `json:"shipping_zip"`
 	ShippingPhone   string `json:"shipping_phone" gorm:"not null"`
+	ShippingZone    string `json:"shipping_zone"` // Zone code used to price delivery
 	Notes           string `json:"notes"`
 
 	// Pricing
-	Subtotal    float64 `json:"subtotal" gorm:"not null"`
-	ShippingFee float64 `json:"shipping_fee" gorm:"default:0"`
-	Total       float64 `json:"total" gorm:"not null"`
+	Subtotal      float64 `json:"subtotal" gorm:"not null"`
+	Discount      float64 `json:"discount" gorm:"default:0"`
+	PromotionID   *uint   `json:"promotion_id"`
+	PromotionCode string  `json:"promotion_code"`
+	ShippingFee   float64 `json:"shipping_fee" gorm:"default:0"`
+	Tax           float64 `json:"tax" gorm:"default:0"` // Sum of TaxLines, included in Total
+	Total         float64 `json:"total" gorm:"not null"`
+
+	// RefundedAmount adds up every refund issued. PaymentStatus stays paid until it
+	// reaches Total.
+	RefundedAmount float64 `json:"refunded_amount" gorm:"default:0"`
 
 	// Timestamps
 	CreatedAt time.Time      `json:"created_at"`
@@ -57,7 +66,8 @@ type Order struct {
 	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 
 	// Relationships
-	OrderItems []OrderItem `json:"order_items" gorm:"foreignKey:OrderID"`
+	OrderItems []OrderItem    `json:"order_items" gorm:"foreignKey:OrderID"`
+	TaxLines   []OrderTaxLine `json:"tax_lines" gorm:"foreignKey:OrderID"`
 }
 
 // OrderItem represents an item within an order
@@ -71,12 +81,54 @@ type OrderItem struct {
 	Price     float64 `json:"price" gorm:"not null"` // Price at time of order
 	Total     float64 `json:"total" gorm:"not null"` // Quantity * Price
 
+	// Product snapshot at time of order, so later edits don't rewrite history
+	ProductName    string `json:"product_name"`
+	ProductImage   string `json:"product_image"`
+	Variant        string `json:"variant"`
+	SellerID       uint   `json:"seller_id" gorm:"index"`
+	SellerShopName string `json:"seller_shop_name"`
+
+	// Tax charged on this line after its share of any discount
+	TaxType   TaxType `json:"tax_type"`
+	TaxRate   float64 `json:"tax_rate" gorm:"default:0"`
+	TaxAmount float64 `json:"tax_amount" gorm:"default:0"`
+
 	// Timestamps
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
 
+// NewOrderItem builds an order item that snapshots the product and seller as they are now
+func NewOrderItem(product Product, seller User, quantity int, variant string) OrderItem {
+	return OrderItem{
+		ProductID:      product.ID,
+		Quantity:       quantity,
+		Price:          product.Price,
+		Total:          product.Price * float64(quantity),
+		ProductName:    product.Name,
+		ProductImage:   product.ImageURL,
+		Variant:        variant,
+		SellerID:       product.SellerID,
+		SellerShopName: seller.ShopName,
+	}
+}
+
+// BackfillOrderItemSnapshots fills snapshot fields on order items created before snapshots existed
+func BackfillOrderItemSnapshots(db *gorm.DB) {
+	db.Exec(`UPDATE order_items SET
+			product_name = products.name,
+			product_image = products.image_url,
+			seller_id = products.seller_id
+		FROM products
+		WHERE order_items.product_id = products.id
+			AND (order_items.product_name IS NULL OR order_items.product_name = '')`)
+	db.Exec(`UPDATE order_items SET seller_shop_name = users.shop_name
+		FROM users
+		WHERE order_items.seller_id = users.id
+			AND (order_items.seller_shop_name IS NULL OR order_items.seller_shop_name = '')`)
+}
+
 // BeforeCreate hook to generate order number
 func (o *Order) BeforeCreate(tx *gorm.DB) error {
 	if o.OrderNumber == "" {
@@ -117,3 +169,10 @@ func (o *Order) CanBeShipped() bool {
 func (o *Order) CanBeDelivered() bool {
 	return o.Status == OrderStatusShipped
 }
+
+// BackfillRefundedAmounts records the full total on orders refunded before partial
+// refunds were tracked
+func BackfillRefundedAmounts(db *gorm.DB) {
+	db.Model(&Order{}).Where("payment_status = ? AND refunded_amount = 0", PaymentStatusRefunded).
+		Update("refunded_amount", gorm.Expr("total"))
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// PasswordResetTTL is how long a forgot-password code and link stay valid
+	PasswordResetTTL = 30 * time.Minute
+	// MaxPasswordResetAttempts is how many wrong codes are accepted before the reset is void
+	MaxPasswordResetAttempts = 5
+)
+
+// PasswordReset is a forgot-password request. The email carries both a link token and a
+// 6-digit code; only their hashes are stored and either can be used once before ExpiresAt.
+type PasswordReset struct {
+	gorm.Model
+	UserID    uint       `json:"-" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;size:64"`
+	CodeHash  string     `json:"-" gorm:"size:64"`
+	Attempts  int        `json:"-" gorm:"default:0"` // Wrong codes entered
+	IP        string     `json:"-"`
+	ExpiresAt time.Time  `json:"-" gorm:"index"`
+	UsedAt    *time.Time `json:"-"`
+}
+
+// Usable reports whether the reset can still change the password
+func (r PasswordReset) Usable() bool {
+	return r.UsedAt == nil && r.Attempts < MaxPasswordResetAttempts && time.Now().Before(r.ExpiresAt)
+}
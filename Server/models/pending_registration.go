@@ -6,14 +6,20 @@ import (
 	"gorm.io/gorm"
 )
 
+// MaxVerificationAttempts is how many wrong codes a pending registration accepts before
+// a new code has to be requested
+const MaxVerificationAttempts = 5
+
 type PendingRegistration struct {
 	gorm.Model
-	Name               string     `json:"name"`
-	Email              string     `json:"email" gorm:"unique"`
-	Password           string     `json:"-"`
-	Address            string     `json:"address"`
-	Role               string     `json:"role"`               // "buyer" or "seller"
-	ShopName           string     `json:"shopName,omitempty"` // Only for sellers
-	VerificationToken  string     `json:"-" gorm:"unique"`
-	VerificationExpiry *time.Time `json:"-"`
+	Name                 string     `json:"name"`
+	Email                string     `json:"email" gorm:"unique"`
+	Password             string     `json:"-"`
+	Address              string     `json:"address"`
+	Role                 string     `json:"role"`               // "buyer" or "seller"
+	ShopName             string     `json:"shopName,omitempty"` // Only for sellers
+	Locale               string     `json:"locale"`             // Language for emails, carried over to the user
+	VerificationToken    string     `json:"-" gorm:"unique"`
+	VerificationExpiry   *time.Time `json:"-"`
+	VerificationAttempts int        `json:"-" gorm:"default:0"` // Wrong codes entered for the current code
 }
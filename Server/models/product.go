@@ -2,12 +2,81 @@ package models
 
 import "gorm.io/gorm"
 
+// ProductStatus represents where a product is in its lifecycle
+type ProductStatus string
+
+const (
+	ProductStatusDraft     ProductStatus = "draft"
+	ProductStatusPublished ProductStatus = "published"
+	ProductStatusArchived  ProductStatus = "archived"
+	ProductStatusBlocked   ProductStatus = "blocked" // Taken down by a moderator; only an admin can lift it
+)
+
+// LowStockThreshold is the stock level at or below which a product is reported as low stock
+const LowStockThreshold = 5
+
 type Product struct {
 	gorm.Model
-	SellerID    uint    `json:"seller_id"`
-	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
-	Description string  `json:"description"`
-	ImageURL    string  `json:"image_url"`
-	Stock       int     `json:"stock"` // new
+	SellerID    uint           `json:"seller_id" gorm:"uniqueIndex:idx_seller_sku,where:sku <> ''"`
+	SKU         string         `json:"sku" gorm:"uniqueIndex:idx_seller_sku,where:sku <> ''"` // Seller's own stock keeping unit
+	Name        string         `json:"name"`
+	Price       float64        `json:"price"`
+	Description string         `json:"description"`
+	ImageURL    string         `json:"image_url"`
+	Stock       int            `json:"stock"`                                   // new
+	Status      ProductStatus  `json:"status" gorm:"index;default:'published'"` // The default keeps products from before statuses existed live; handlers create new ones as drafts
+	WeightKg    float64        `json:"weight_kg" gorm:"default:0"`              // Shipping weight per unit
+	Category    string         `json:"category" gorm:"index"`                   // Lowercase, selects the tax rule
+	Images      []ProductImage `json:"images,omitempty" gorm:"foreignKey:ProductID"`
+
+	ModerationNote string `json:"moderation_note,omitempty"` // Why a moderator blocked the product
+
+	// Rating summary
+	RatingAverage float64 `json:"rating_average" gorm:"default:0"`
+	RatingCount   int     `json:"rating_count" gorm:"default:0"`
+}
+
+// ProductImage is an additional gallery image for a product
+type ProductImage struct {
+	gorm.Model
+	ProductID uint   `json:"product_id" gorm:"index;not null"`
+	URL       string `json:"url" gorm:"not null"`
+	Position  int    `json:"position" gorm:"default:0"`
+}
+
+// PublishedProducts scopes a query to products visible in the catalog, leaving out
+// those of suspended sellers
+func PublishedProducts(db *gorm.DB) *gorm.DB {
+	return db.Where("products.status = ?", ProductStatusPublished).
+		Where("products.seller_id NOT IN (SELECT id FROM users WHERE suspended_at IS NOT NULL)")
+}
+
+// IsPurchasable returns true if the product can be added to a new order
+func (p *Product) IsPurchasable() bool {
+	return p.Status == ProductStatusPublished
+}
+
+// StockStatus returns "in_stock", "low_stock" or "out_of_stock"
+func (p *Product) StockStatus() string {
+	if p.Stock <= 0 {
+		return "out_of_stock"
+	}
+	if p.Stock <= LowStockThreshold {
+		return "low_stock"
+	}
+	return "in_stock"
+}
+
+// ImageURLs returns the main image followed by the gallery images
+func (p *Product) ImageURLs() []string {
+	urls := []string{}
+	if p.ImageURL != "" {
+		urls = append(urls, p.ImageURL)
+	}
+	for _, img := range p.Images {
+		if img.URL != "" && img.URL != p.ImageURL {
+			urls = append(urls, img.URL)
+		}
+	}
+	return urls
 }
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PromotionType represents how a promotion's value is applied
+type PromotionType string
+
+const (
+	PromotionTypePercentage PromotionType = "percentage"
+	PromotionTypeFixed      PromotionType = "fixed"
+)
+
+// Promotion is a coupon code or, when Code is empty, an automatic discount.
+// A nil SellerID makes it platform-wide; otherwise it only discounts that seller's items.
+type Promotion struct {
+	gorm.Model
+	Code           string        `json:"code" gorm:"uniqueIndex:idx_promotion_code,where:code <> ''"`
+	Name           string        `json:"name" gorm:"not null"`
+	Type           PromotionType `json:"type" gorm:"not null"`
+	Value          float64       `json:"value" gorm:"not null"`         // Percent (0-100) or fixed ETB amount
+	MaxDiscount    float64       `json:"max_discount" gorm:"default:0"` // Cap for percentage discounts, 0 = no cap
+	SellerID       *uint         `json:"seller_id" gorm:"index"`
+	MinOrderAmount float64       `json:"min_order_amount" gorm:"default:0"`
+	UsageLimit     int           `json:"usage_limit" gorm:"default:0"`    // Total redemptions allowed, 0 = unlimited
+	PerUserLimit   int           `json:"per_user_limit" gorm:"default:0"` // Redemptions per buyer, 0 = unlimited
+	UsedCount      int           `json:"used_count" gorm:"default:0"`
+	StartsAt       *time.Time    `json:"starts_at"`
+	EndsAt         *time.Time    `json:"ends_at"`
+	Active         bool          `json:"active" gorm:"default:true"`
+}
+
+// PromotionRedemption records a promotion being used on an order
+type PromotionRedemption struct {
+	gorm.Model
+	PromotionID uint    `json:"promotion_id" gorm:"index;not null;uniqueIndex:idx_promotion_redemption_slot,priority:1"`
+	UserID      uint    `json:"user_id" gorm:"index;not null;uniqueIndex:idx_promotion_redemption_slot,priority:2"`
+	OrderID     uint    `json:"order_id" gorm:"index;not null"` // 0 while the buyer is still paying
+	Amount      float64 `json:"amount" gorm:"not null"`
+	// Slot numbers the buyer's uses of a promotion with a per-user limit, from 1 up to
+	// the limit. It's unique per buyer, so racing checkouts can't take the same use.
+	// Nil for promotions without a per-user limit.
+	Slot *int `json:"-" gorm:"uniqueIndex:idx_promotion_redemption_slot,priority:3"`
+}
+
+// NormalizeCouponCode makes coupon codes case-insensitive
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// IsAutomatic returns true for promotions applied without a coupon code
+func (p *Promotion) IsAutomatic() bool {
+	return p.Code == ""
+}
+
+// IsRunning returns true if the promotion is active and inside its validity window
+func (p *Promotion) IsRunning(now time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil && now.Before(*p.StartsAt) {
+		return false
+	}
+	if p.EndsAt != nil && now.After(*p.EndsAt) {
+		return false
+	}
+	return p.UsageLimit == 0 || p.UsedCount < p.UsageLimit
+}
+
+// DiscountFor returns the discount on an eligible amount, never more than the amount itself
+func (p *Promotion) DiscountFor(eligible float64) float64 {
+	if eligible <= 0 || eligible < p.MinOrderAmount {
+		return 0
+	}
+
+	var discount float64
+	switch p.Type {
+	case PromotionTypePercentage:
+		discount = eligible * p.Value / 100
+		if p.MaxDiscount > 0 && discount > p.MaxDiscount {
+			discount = p.MaxDiscount
+		}
+	case PromotionTypeFixed:
+		discount = p.Value
+	}
+
+	if discount > eligible {
+		discount = eligible
+	}
+	return math.Round(discount*100) / 100
+}
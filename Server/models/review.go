@@ -0,0 +1,77 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReviewStatus represents the moderation state of a review
+type ReviewStatus string
+
+const (
+	ReviewStatusVisible ReviewStatus = "visible"
+	ReviewStatusFlagged ReviewStatus = "flagged" // Hidden until a moderator looks at it
+	ReviewStatusHidden  ReviewStatus = "hidden"
+)
+
+// ReviewFlagThreshold is the number of flags after which a review is hidden pending moderation
+const ReviewFlagThreshold = 3
+
+// Review is a verified buyer's rating of a product
+type Review struct {
+	gorm.Model
+	ProductID   uint          `json:"product_id" gorm:"not null;uniqueIndex:idx_review_product_user"`
+	UserID      uint          `json:"user_id" gorm:"not null;uniqueIndex:idx_review_product_user"`
+	User        User          `json:"-" gorm:"foreignKey:UserID"`
+	OrderItemID uint          `json:"order_item_id" gorm:"not null"` // The delivered purchase that verifies the review
+	Rating      int           `json:"rating" gorm:"not null"`        // 1-5 stars
+	Body        string        `json:"body"`
+	Photos      []ReviewPhoto `json:"photos" gorm:"foreignKey:ReviewID"`
+	Status      ReviewStatus  `json:"status" gorm:"index;default:'visible'"`
+	FlagCount   int           `json:"-" gorm:"default:0"` // Open flags; dismissing them resets it
+
+	ModerationNote string `json:"moderation_note,omitempty"` // Why a moderator hid the review
+
+	// Seller reply
+	SellerReply     string     `json:"seller_reply,omitempty"`
+	SellerRepliedAt *time.Time `json:"seller_replied_at,omitempty"`
+}
+
+// ReviewPhoto is an optional photo attached to a review
+type ReviewPhoto struct {
+	gorm.Model
+	ReviewID uint   `json:"review_id" gorm:"index;not null"`
+	URL      string `json:"url" gorm:"not null"`
+}
+
+// ReviewFlag records a user reporting a review
+type ReviewFlag struct {
+	gorm.Model
+	ReviewID uint   `json:"review_id" gorm:"not null;uniqueIndex:idx_flag_review_user"`
+	UserID   uint   `json:"user_id" gorm:"not null;uniqueIndex:idx_flag_review_user"`
+	Reason   string `json:"reason"`
+
+	DismissedAt *time.Time `json:"dismissed_at,omitempty"` // A moderator found nothing wrong
+}
+
+// RefreshProductRating recalculates a product's rating summary from its visible reviews
+func RefreshProductRating(db *gorm.DB, productID uint) error {
+	var summary struct {
+		Average float64
+		Count   int
+	}
+	if err := db.Model(&Review{}).
+		Select("COALESCE(AVG(rating), 0) AS average, COUNT(*) AS count").
+		Where("product_id = ? AND status = ?", productID, ReviewStatusVisible).
+		Scan(&summary).Error; err != nil {
+		return err
+	}
+	summary.Average = math.Round(summary.Average*100) / 100
+
+	return db.Model(&Product{}).Unscoped().Where("id = ?", productID).Updates(map[string]interface{}{
+		"rating_average": summary.Average,
+		"rating_count":   summary.Count,
+	}).Error
+}
@@ -0,0 +1,54 @@
+package models
+
+// Roles a user can have. Only buyers and sellers can sign up; admins are created with
+// the create-admin command, and support staff are promoted by an admin
+// (PUT /api/admin/users/:id/role).
+const (
+	RoleBuyer   = "buyer"
+	RoleSeller  = "seller"
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+// Roles lists every role
+var Roles = []string{RoleBuyer, RoleSeller, RoleAdmin, RoleSupport}
+
+// Permissions checked by middleware.RequirePermission
+const (
+	PermissionPlaceOrders    = "orders:place"
+	PermissionManageWishlist = "wishlist:manage"
+	PermissionManageProducts = "products:manage"
+	PermissionFulfillOrders  = "orders:fulfill"
+	PermissionManageStore    = "store:manage" // Promotions, shipping rates, tax profile, review replies
+	PermissionManageEmails   = "emails:manage"
+)
+
+// RolePermissions is what each role may do. Admins may do everything and aren't listed.
+var RolePermissions = map[string][]string{
+	RoleBuyer:   {PermissionPlaceOrders, PermissionManageWishlist},
+	RoleSeller:  {PermissionManageProducts, PermissionFulfillOrders, PermissionManageStore},
+	RoleSupport: {PermissionManageEmails},
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether users with role are allowed permission
+func HasPermission(role, permission string) bool {
+	if role == RoleAdmin {
+		return true
+	}
+	for _, p := range RolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
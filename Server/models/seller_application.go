@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SellerApplicationStatus is where a seller is in onboarding
+type SellerApplicationStatus string
+
+const (
+	SellerApplicationApplied            SellerApplicationStatus = "applied"
+	SellerApplicationDocumentsSubmitted SellerApplicationStatus = "documents_submitted"
+	SellerApplicationApproved           SellerApplicationStatus = "approved"
+	SellerApplicationRejected           SellerApplicationStatus = "rejected"
+)
+
+// Documents a seller uploads for KYC review
+const (
+	KYCDocumentTradeLicense = "trade_license"
+	KYCDocumentNationalID   = "national_id"
+)
+
+// SellerApplication tracks a seller's KYC review. Sellers can't publish products until
+// it is approved. Document fields hold file names in the private KYC document store.
+type SellerApplication struct {
+	gorm.Model
+	UserID           uint                    `json:"user_id" gorm:"uniqueIndex;not null"`
+	User             User                    `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Status           SellerApplicationStatus `json:"status" gorm:"index;default:'applied'"`
+	TradeLicenseFile string                  `json:"-"`
+	NationalIDFile   string                  `json:"-"`
+	SubmittedAt      *time.Time              `json:"submitted_at"`
+	ReviewedAt       *time.Time              `json:"reviewed_at"`
+	ReviewedBy       *uint                   `json:"reviewed_by,omitempty"`
+	RejectionReason  string                  `json:"rejection_reason,omitempty"`
+}
+
+// sellerApplicationTransitions lists the statuses each status can move to. Rejected
+// sellers can fix their documents and submit again.
+var sellerApplicationTransitions = map[SellerApplicationStatus][]SellerApplicationStatus{
+	SellerApplicationApplied:            {SellerApplicationDocumentsSubmitted},
+	SellerApplicationDocumentsSubmitted: {SellerApplicationApproved, SellerApplicationRejected},
+	SellerApplicationRejected:           {SellerApplicationDocumentsSubmitted},
+	SellerApplicationApproved:           {},
+}
+
+// CanTransitionTo reports whether the application can move to status
+func (a SellerApplication) CanTransitionTo(status SellerApplicationStatus) bool {
+	for _, next := range sellerApplicationTransitions[a.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Editable reports whether the seller can still change their documents
+func (a SellerApplication) Editable() bool {
+	return a.Status == SellerApplicationApplied || a.Status == SellerApplicationRejected
+}
+
+// DocumentFile returns the stored file name for a KYC document kind
+func (a SellerApplication) DocumentFile(kind string) string {
+	switch kind {
+	case KYCDocumentTradeLicense:
+		return a.TradeLicenseFile
+	case KYCDocumentNationalID:
+		return a.NationalIDFile
+	}
+	return ""
+}
+
+// Documents reports which KYC documents have been uploaded
+func (a SellerApplication) Documents() map[string]bool {
+	return map[string]bool{
+		KYCDocumentTradeLicense: a.TradeLicenseFile != "",
+		KYCDocumentNationalID:   a.NationalIDFile != "",
+	}
+}
+
+// ApproveExistingSellers approves every seller that signed up before onboarding existed,
+// so their shops and already-published products stay live. Run it only when the
+// seller_applications table is first created; sellers after that go through KYC review.
+func ApproveExistingSellers(db *gorm.DB) {
+	db.Model(&User{}).Where("role = ? AND seller_approved_at IS NULL", RoleSeller).
+		Update("seller_approved_at", time.Now())
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is one signed-in device. Access tokens carry the session ID so they stop
+// working as soon as the session is revoked; the refresh token, stored only as a
+// SHA-256 hash, is replaced every time it is used.
+type Session struct {
+	gorm.Model
+	UserID            uint       `json:"-" gorm:"index;not null"`
+	RefreshTokenHash  string     `json:"-" gorm:"uniqueIndex;size:64"`
+	PreviousTokenHash string     `json:"-" gorm:"index;size:64"` // Detects a rotated-out refresh token being replayed
+	RotatedAt         *time.Time `json:"-"`
+	UserAgent         string     `json:"user_agent"`
+	Device            string     `json:"device"`
+	IP                string     `json:"ip"`
+	LastSeenAt        time.Time  `json:"last_seen_at"`
+	ExpiresAt         time.Time  `json:"expires_at" gorm:"index"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the session can still be used
+func (s Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"math"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ShippingZone groups delivery destinations that share a rate. A zone matches an
+// order's ShippingState, optionally narrowed to specific cities or Addis Ababa sub-cities.
+type ShippingZone struct {
+	gorm.Model
+	Code      string `json:"code" gorm:"uniqueIndex;not null"`
+	Name      string `json:"name" gorm:"not null"`
+	State     string `json:"state"`                           // Region or city administration, empty for the default zone
+	Cities    string `json:"cities"`                          // Comma-separated cities/sub-cities, empty = whole state
+	IsDefault bool   `json:"is_default" gorm:"default:false"` // Used when no other zone matches
+}
+
+// ShippingRate prices delivery to a zone. A nil SellerID is the platform rate
+// used for sellers who haven't set their own.
+type ShippingRate struct {
+	gorm.Model
+	ZoneID                uint    `json:"zone_id" gorm:"not null;uniqueIndex:idx_rate_zone_seller"`
+	SellerID              *uint   `json:"seller_id" gorm:"uniqueIndex:idx_rate_zone_seller"`
+	BaseFee               float64 `json:"base_fee" gorm:"default:0"`
+	PerKgFee              float64 `json:"per_kg_fee" gorm:"default:0"`
+	FreeShippingThreshold float64 `json:"free_shipping_threshold" gorm:"default:0"` // Seller subtotal for free delivery, 0 = never free
+}
+
+// FeeFor returns the delivery fee for one seller's items in an order
+func (r *ShippingRate) FeeFor(weightKg, sellerSubtotal float64) float64 {
+	if r.FreeShippingThreshold > 0 && sellerSubtotal >= r.FreeShippingThreshold {
+		return 0
+	}
+	fee := r.BaseFee + r.PerKgFee*weightKg
+	return math.Round(fee*100) / 100
+}
+
+// Covers returns true if the zone includes the city in the given state
+func (z *ShippingZone) Covers(city, state string) bool {
+	if !strings.EqualFold(strings.TrimSpace(z.State), strings.TrimSpace(state)) {
+		return false
+	}
+	if strings.TrimSpace(z.Cities) == "" {
+		return true
+	}
+	for _, zoneCity := range strings.Split(z.Cities, ",") {
+		if strings.EqualFold(strings.TrimSpace(zoneCity), strings.TrimSpace(city)) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindShippingZone picks the most specific zone for a destination: a city match,
+// then a whole-state match, then the default zone.
+func FindShippingZone(db *gorm.DB, city, state string) (*ShippingZone, error) {
+	var zones []ShippingZone
+	if err := db.Find(&zones).Error; err != nil {
+		return nil, err
+	}
+
+	var stateMatch, fallback *ShippingZone
+	for i := range zones {
+		zone := &zones[i]
+		if zone.Covers(city, state) {
+			if strings.TrimSpace(zone.Cities) != "" {
+				return zone, nil
+			}
+			stateMatch = zone
+		}
+		if zone.IsDefault {
+			fallback = zone
+		}
+	}
+	if stateMatch != nil {
+		return stateMatch, nil
+	}
+	return fallback, nil
+}
+
+// SeedShippingZones creates the standard zones the first time the server starts
+func SeedShippingZones(db *gorm.DB) {
+	var count int64
+	db.Model(&ShippingZone{}).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	zones := []ShippingZone{
+		{Code: "addis-inner", Name: "Addis Ababa (inner sub-cities)", State: "Addis Ababa",
+			Cities: "Arada,Kirkos,Lideta,Addis Ketema,Bole,Yeka,Gulele"},
+		{Code: "addis-outer", Name: "Addis Ababa (outer sub-cities)", State: "Addis Ababa"},
+		{Code: "regions", Name: "Regional cities", IsDefault: true},
+	}
+	db.Create(&zones)
+}
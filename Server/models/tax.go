@@ -0,0 +1,80 @@
+package models
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// TaxType identifies which Ethiopian tax applies to a sale
+type TaxType string
+
+const (
+	TaxTypeVAT  TaxType = "VAT" // Value Added Tax, charged by VAT-registered sellers
+	TaxTypeTOT  TaxType = "TOT" // Turnover Tax, charged by sellers below the VAT threshold
+	TaxTypeNone TaxType = ""
+)
+
+// TaxRule sets the VAT and TOT rates for a product category. The rule with an
+// empty Category is the default for products whose category has no rule.
+type TaxRule struct {
+	gorm.Model
+	Category string  `json:"category" gorm:"uniqueIndex"`
+	VATRate  float64 `json:"vat_rate" gorm:"default:0"` // e.g. 0.15 for 15%
+	TOTRate  float64 `json:"tot_rate" gorm:"default:0"` // e.g. 0.02 for 2%
+	Exempt   bool    `json:"exempt" gorm:"default:false"`
+}
+
+// OrderTaxLine is an order's tax total for one tax type and rate, as shown on invoices
+type OrderTaxLine struct {
+	gorm.Model
+	OrderID       uint    `json:"order_id" gorm:"index;not null"`
+	TaxType       TaxType `json:"tax_type" gorm:"not null"`
+	Rate          float64 `json:"rate"`
+	TaxableAmount float64 `json:"taxable_amount"`
+	Amount        float64 `json:"amount"`
+}
+
+// TaxFor returns the tax type and rate for a sale by a seller with the given VAT registration
+func (r *TaxRule) TaxFor(vatRegistered bool) (TaxType, float64) {
+	if r == nil || r.Exempt {
+		return TaxTypeNone, 0
+	}
+	if vatRegistered {
+		return TaxTypeVAT, r.VATRate
+	}
+	if r.TOTRate > 0 {
+		return TaxTypeTOT, r.TOTRate
+	}
+	return TaxTypeNone, 0
+}
+
+// NormalizeCategory trims and lowercases a product category so rules match regardless of case
+func NormalizeCategory(category string) string {
+	return strings.ToLower(strings.TrimSpace(category))
+}
+
+// MatchTaxRule picks the rule for a category from rules, falling back to the default rule
+func MatchTaxRule(rules []TaxRule, category string) *TaxRule {
+	category = NormalizeCategory(category)
+	var fallback *TaxRule
+	for i := range rules {
+		switch rules[i].Category {
+		case category:
+			return &rules[i]
+		case "":
+			fallback = &rules[i]
+		}
+	}
+	return fallback
+}
+
+// SeedTaxRules creates the default rule (15% VAT, 2% TOT on goods) the first time the server starts
+func SeedTaxRules(db *gorm.DB) {
+	var count int64
+	db.Model(&TaxRule{}).Count(&count)
+	if count > 0 {
+		return
+	}
+	db.Create(&TaxRule{Category: "", VATRate: 0.15, TOTRate: 0.02})
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Second factors a user can sign in with
+const (
+	TwoFactorTOTP  = "totp"
+	TwoFactorEmail = "email"
+)
+
+const (
+	// LoginChallengeTTL is how long a user has to enter their second factor after the password
+	LoginChallengeTTL = 10 * time.Minute
+	// MaxLoginChallengeAttempts is how many wrong codes are accepted before the sign-in starts over
+	MaxLoginChallengeAttempts = 5
+	// MaxLoginChallengeEmails caps the email codes sent for one sign-in
+	MaxLoginChallengeEmails = 3
+	// RecoveryCodeCount is how many recovery codes are issued when TOTP is enabled
+	RecoveryCodeCount = 10
+)
+
+// LoginChallenge is a sign-in waiting for the second factor. The password was correct;
+// the session is only started once a code is accepted. The client holds the token, which
+// is stored as a SHA-256 hash, as is the emailed code.
+type LoginChallenge struct {
+	gorm.Model
+	UserID      uint       `json:"-" gorm:"index;not null"`
+	TokenHash   string     `json:"-" gorm:"uniqueIndex;size:64"`
+	Method      string     `json:"-"`
+	CodeHash    string     `json:"-" gorm:"size:64"` // Email code, when one was sent
+	CodeSentAt  *time.Time `json:"-"`
+	EmailsSent  int        `json:"-" gorm:"default:0"`
+	Attempts    int        `json:"-" gorm:"default:0"` // Wrong codes entered
+	IP          string     `json:"-"`
+	UserAgent   string     `json:"-"`
+	ExpiresAt   time.Time  `json:"-" gorm:"index"`
+	CompletedAt *time.Time `json:"-"`
+}
+
+// Usable reports whether the challenge can still be answered
+func (c LoginChallenge) Usable() bool {
+	return c.CompletedAt == nil && c.Attempts < MaxLoginChallengeAttempts && time.Now().Before(c.ExpiresAt)
+}
+
+// RecoveryCode is a single-use code for signing in without the authenticator app.
+// Only the hash is stored; the codes are shown once when they are generated.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `json:"-" gorm:"index;not null"`
+	CodeHash string     `json:"-" gorm:"uniqueIndex;size:64"`
+	UsedAt   *time.Time `json:"-"`
+}
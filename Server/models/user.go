@@ -1,6 +1,9 @@
 package models
 
 import (
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -9,12 +12,168 @@ import (
 type User struct {
 	gorm.Model
 	Name               string     `json:"name"`
-	Email              string     `json:"email" gorm:"unique"`
+	Email              string     `json:"email" gorm:"unique;default:null"` // Empty for accounts registered by phone
 	Password           string     `json:"-"`
 	Address            string     `json:"address"`
-	Role               string     `json:"role"`               // "buyer" or "seller"
-	ShopName           string     `json:"shopName,omitempty"` // Only for sellers
+	Role               string     `json:"role"`                                                                                   // See RoleBuyer and the other roles in role.go
+	ShopName           string     `json:"shopName,omitempty"`                                                                     // Only for sellers
+	ShopSlug           string     `json:"shopSlug,omitempty" gorm:"uniqueIndex:idx_users_shop_slug_unique,where:shop_slug <> ''"` // Derived from ShopName
+	TIN                string     `json:"tin,omitempty"`                                                                          // Taxpayer Identification Number, sellers only
+	VATRegistered      bool       `json:"vatRegistered" gorm:"default:false"`                                                     // Seller charges VAT instead of TOT
+	Locale             string     `json:"locale" gorm:"size:5;default:'en'"`                                                      // Language for emails: "en", "am" or "om"
 	EmailVerified      bool       `json:"emailVerified" gorm:"default:false"`
-	VerificationToken  string     `json:"-" gorm:"unique"`
+	Phone              string     `json:"phone,omitempty" gorm:"unique;default:null;size:13"` // +2519XXXXXXXX, set once verified by SMS
+	PhoneVerifiedAt    *time.Time `json:"phoneVerifiedAt,omitempty"`
+	VerificationToken  string     `json:"-" gorm:"unique;default:null"`
 	VerificationExpiry *time.Time `json:"-"`
+	SellerApprovedAt   *time.Time `json:"sellerApprovedAt,omitempty"` // Set when an admin approves the shop
+	SuspendedAt        *time.Time `json:"suspendedAt,omitempty"`      // Suspended accounts can't sign in and their shop is hidden
+	SuspensionReason   string     `json:"suspensionReason,omitempty"`
+	TwoFactorMethod    string     `json:"twoFactorMethod,omitempty"` // "totp", "email" or empty when 2FA is off
+	TwoFactorEnabledAt *time.Time `json:"twoFactorEnabledAt,omitempty"`
+	TOTPSecret         string     `json:"-"` // Encrypted; see services.SealSecret
+	TOTPPendingSecret  string     `json:"-"` // Encrypted secret waiting for its first code during setup
+	TOTPLastCounter    int64      `json:"-"` // Time step of the last accepted code, so codes can't be replayed
+}
+
+// Suspended reports whether an admin has suspended the account
+func (u User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// Verified reports whether the user has proven they own their email address or phone number
+func (u User) Verified() bool {
+	return u.EmailVerified || u.PhoneVerifiedAt != nil
+}
+
+// RequiresTwoFactor reports whether signing in needs a second factor. Admins always
+// need one; without an authenticator app they get a code by email.
+func (u User) RequiresTwoFactor() bool {
+	return u.TwoFactorMethod != "" || u.Role == RoleAdmin
+}
+
+// LoginTwoFactorMethod is the second factor asked for first when signing in
+func (u User) LoginTwoFactorMethod() string {
+	if u.TwoFactorMethod == TwoFactorTOTP {
+		return TwoFactorTOTP
+	}
+	return TwoFactorEmail
+}
+
+var (
+	slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+	slugDedupeSuffix = regexp.MustCompile(`-[0-9]+$`) // Added by UniqueShopSlug when the base is taken
+)
+
+// Slugify converts a shop name into a URL-friendly slug
+func Slugify(name string) string {
+	slug := slugInvalidChars.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-")
+	return strings.Trim(slug, "-")
+}
+
+// UniqueShopSlug derives a slug from the shop name that no other user owns yet
+func UniqueShopSlug(db *gorm.DB, shopName string, userID uint) string {
+	base := shopSlugBase(shopName)
+	if base == "" {
+		return ""
+	}
+
+	slug := base
+	for i := 2; ; i++ {
+		// Deleted users keep their slug, and the unique index counts them too
+		var count int64
+		db.Unscoped().Model(&User{}).Where("shop_slug = ? AND id <> ?", slug, userID).Count(&count)
+		if count == 0 {
+			return slug
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// shopSlugAttempts is how many times RetryShopSlugConflicts tries before giving up
+const shopSlugAttempts = 5
+
+// IsShopSlugConflict reports whether err is the unique index refusing a shop slug that
+// another user took after UniqueShopSlug checked it
+func IsShopSlugConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := err.Error()
+	return strings.Contains(message, "shop_slug") &&
+		(strings.Contains(message, "duplicate key") || strings.Contains(message, "UNIQUE constraint"))
+}
+
+// RetryShopSlugConflicts runs save again while it fails on a shop slug conflict. save
+// must derive the slug afresh each time, so the retry gets the next free suffix.
+func RetryShopSlugConflicts(save func() error) error {
+	var err error
+	for i := 0; i < shopSlugAttempts; i++ {
+		if err = save(); !IsShopSlugConflict(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// shopSlugBase is the slug a shop name gets before any dedupe suffix
+func shopSlugBase(shopName string) string {
+	base := Slugify(shopName)
+	if base == "" && shopName != "" {
+		// Names written entirely in Ethiopic script have no ASCII characters left
+		base = "shop"
+	}
+	return base
+}
+
+// shopSlugMatches reports whether slug was derived from the shop name, with or without
+// a dedupe suffix, so renaming "Abebe Injera" to "Abebe" still gets a new slug
+func shopSlugMatches(slug, shopName string) bool {
+	base := shopSlugBase(shopName)
+	return slug == base || slugDedupeSuffix.ReplaceAllString(slug, "") == base
+}
+
+// BeforeSave keeps the shop slug in sync with the shop name
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	if u.ShopName == "" {
+		u.ShopSlug = ""
+		return nil
+	}
+	if u.ShopSlug == "" || !shopSlugMatches(u.ShopSlug, u.ShopName) {
+		u.ShopSlug = UniqueShopSlug(tx.Session(&gorm.Session{NewDB: true}), u.ShopName, u.ID)
+	}
+	return nil
+}
+
+// DedupeShopSlugs gives every seller but the first a new slug where several share one,
+// so the unique index can be created, and drops the index it replaces. Runs before
+// AutoMigrate.
+func DedupeShopSlugs(db *gorm.DB) {
+	if !db.Migrator().HasColumn(&User{}, "shop_slug") {
+		return
+	}
+	var shared []string
+	db.Unscoped().Model(&User{}).Where("shop_slug <> ''").
+		Group("shop_slug").Having("COUNT(*) > 1").Pluck("shop_slug", &shared)
+	for _, slug := range shared {
+		var sellers []User
+		db.Unscoped().Where("shop_slug = ?", slug).Order("id").Find(&sellers)
+		for _, seller := range sellers[1:] {
+			db.Unscoped().Model(&User{}).Where("id = ?", seller.ID).
+				UpdateColumn("shop_slug", UniqueShopSlug(db, seller.ShopName, seller.ID))
+		}
+	}
+	if db.Migrator().HasIndex(&User{}, "idx_users_shop_slug") {
+		db.Migrator().DropIndex(&User{}, "idx_users_shop_slug")
+	}
+}
+
+// BackfillShopSlugs assigns slugs to sellers created before shop slugs existed
+func BackfillShopSlugs(db *gorm.DB) {
+	var sellers []User
+	db.Where("shop_name <> '' AND (shop_slug IS NULL OR shop_slug = '')").Find(&sellers)
+	for _, seller := range sellers {
+		slug := UniqueShopSlug(db, seller.ShopName, seller.ID)
+		db.Model(&User{}).Where("id = ?", seller.ID).Update("shop_slug", slug)
+	}
 }
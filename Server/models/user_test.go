@@ -0,0 +1,122 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestShopSlugMatches(t *testing.T) {
+	tests := []struct {
+		slug, shopName string
+		want           bool
+	}{
+		{"abebe-injera", "Abebe Injera", true},
+		{"abebe-injera-2", "Abebe Injera", true},
+		{"abebe-injera", "Abebe", false},
+		{"abebe-injera-2", "Abebe", false},
+		{"abebe", "Abebe Injera", false},
+		{"shop-2", "Shop 2", true},
+		{"shop-3", "የአበበ እንጀራ", true},
+		{"shop", "የአበበ እንጀራ", true},
+	}
+	for _, tt := range tests {
+		if got := shopSlugMatches(tt.slug, tt.shopName); got != tt.want {
+			t.Errorf("shopSlugMatches(%q, %q) = %v, want %v", tt.slug, tt.shopName, got, tt.want)
+		}
+	}
+}
+
+// openUsersDB returns a fresh in-memory database with the users table
+func openUsersDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&User{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestShopSlugConflictRetry(t *testing.T) {
+	db := openUsersDB(t)
+	first := User{Name: "Abebe", Email: "abebe@example.com", Role: RoleSeller, ShopName: "Abebe Injera"}
+	if err := db.Create(&first).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Buyers have no slug, and any number of them can share the blank one
+	for _, email := range []string{"buyer1@example.com", "buyer2@example.com"} {
+		if err := db.Create(&User{Name: "Buyer", Email: email, Role: RoleBuyer}).Error; err != nil {
+			t.Fatalf("second user without a shop: %v", err)
+		}
+	}
+
+	// The second seller checked the slug before the first one's save committed
+	second := User{Name: "Almaz", Email: "almaz@example.com", Role: RoleSeller, ShopName: "Abebe Injera"}
+	attempts := 0
+	err := RetryShopSlugConflicts(func() error {
+		attempts++
+		second.ID, second.ShopSlug = 0, ""
+		if attempts == 1 {
+			second.ShopSlug = "abebe-injera"
+		}
+		return db.Create(&second).Error
+	})
+	if err != nil || attempts != 2 || second.ShopSlug != "abebe-injera-2" {
+		t.Errorf("got slug %q after %d attempts, %v; want abebe-injera-2 after 2", second.ShopSlug, attempts, err)
+	}
+
+	// A deleted shop keeps its slug, so a new one with the same name can't take it
+	db.Delete(&first)
+	third := User{Name: "Hana", Email: "hana@example.com", Role: RoleSeller, ShopName: "Abebe Injera"}
+	if err := db.Create(&third).Error; err != nil || third.ShopSlug != "abebe-injera-3" {
+		t.Errorf("got slug %q, %v; want abebe-injera-3", third.ShopSlug, err)
+	}
+
+	if err := RetryShopSlugConflicts(func() error { return gorm.ErrRecordNotFound }); err != gorm.ErrRecordNotFound {
+		t.Errorf("other errors should come back as they are, got %v", err)
+	}
+}
+
+func TestDedupeShopSlugs(t *testing.T) {
+	db := openUsersDB(t)
+	// The table as it was before slugs were unique
+	db.Migrator().DropIndex(&User{}, "idx_users_shop_slug_unique")
+	db.Exec("CREATE INDEX idx_users_shop_slug ON users (shop_slug)")
+	var ids []uint
+	for _, email := range []string{"abebe@example.com", "almaz@example.com", "hana@example.com"} {
+		user := User{Name: "Seller", Email: email, Role: RoleSeller, ShopName: "Abebe Injera"}
+		db.Create(&user)
+		db.Model(&user).UpdateColumn("shop_slug", "abebe-injera")
+		ids = append(ids, user.ID)
+	}
+
+	DedupeShopSlugs(db)
+	if err := db.AutoMigrate(&User{}); err != nil {
+		t.Fatalf("unique index after deduping: %v", err)
+	}
+
+	var slugs []string
+	db.Model(&User{}).Order("id").Pluck("shop_slug", &slugs)
+	if want := []string{"abebe-injera", "abebe-injera-2", "abebe-injera-3"}; !reflect.DeepEqual(slugs, want) {
+		t.Errorf("got slugs %q, want %q: the first seller keeps the slug", slugs, want)
+	}
+	if db.Migrator().HasIndex(&User{}, "idx_users_shop_slug") {
+		t.Error("the old shop slug index is still there")
+	}
+	if err := db.Model(&User{}).Where("id = ?", ids[2]).UpdateColumn("shop_slug", "abebe-injera").Error; !IsShopSlugConflict(err) {
+		t.Errorf("duplicate slug after migrating: got %v, want a shop slug conflict", err)
+	}
+}
@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// WishlistItem is a product a buyer has saved for later
+type WishlistItem struct {
+	gorm.Model
+	UserID    uint    `json:"user_id" gorm:"not null;uniqueIndex:idx_wishlist_user_product"`
+	ProductID uint    `json:"product_id" gorm:"not null;uniqueIndex:idx_wishlist_user_product;index"`
+	Product   Product `json:"product" gorm:"foreignKey:ProductID"`
+
+	// Price the buyer last saw, either when saving or in the latest price-drop email
+	NotifiedPrice float64 `json:"-"`
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix starts every API key, so they are recognizable in Authorization headers
+// and in leaked-secret scanners
+const APIKeyPrefix = "egb_"
+
+// apiKeyLastUsedInterval limits how often a key's last-used time is written
+const apiKeyLastUsedInterval = time.Minute
+
+var ErrInvalidAPIKey = errors.New("API key is invalid, expired or revoked")
+
+// IsAPIKey reports whether a bearer credential is an API key rather than an access token
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// CreateAPIKey stores a new key for the user and returns it with the plaintext key,
+// which is shown once and cannot be recovered
+func CreateAPIKey(db *gorm.DB, userID uint, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	token, _, err := NewSecureToken()
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext := APIKeyPrefix + token
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plaintext[:len(APIKeyPrefix)+6],
+		KeyHash:   HashToken(plaintext),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := db.Create(&key).Error; err != nil {
+		return nil, "", err
+	}
+	return &key, plaintext, nil
+}
+
+// AuthenticateAPIKey finds the active key for a plaintext API key and records its use
+func AuthenticateAPIKey(db *gorm.DB, plaintext string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := db.Where("key_hash = ?", HashToken(plaintext)).First(&key).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if !key.Active() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyLastUsedInterval {
+		db.Model(&key).Update("last_used_at", time.Now())
+	}
+	return &key, nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ThrottlePolicy sets how quickly failed attempts slow down and lock out a key
+type ThrottlePolicy struct {
+	FreeAttempts    int           // Failures allowed before attempts are delayed
+	LockoutAfter    int           // Failures that start a lockout
+	MaxDelay        time.Duration // Longest delay between attempts before the lockout
+	LockoutDuration time.Duration // First lockout; each further one doubles
+	MaxLockout      time.Duration
+	Window          time.Duration // Failures older than this are forgotten
+}
+
+// throttlePolicies are deliberately looser for IPs, which many buyers on mobile
+// networks share
+var throttlePolicies = map[string]ThrottlePolicy{
+	models.ThrottleAccount: {
+		FreeAttempts:    3,
+		LockoutAfter:    10,
+		MaxDelay:        time.Minute,
+		LockoutDuration: 15 * time.Minute,
+		MaxLockout:      24 * time.Hour,
+		Window:          24 * time.Hour,
+	},
+	models.ThrottleIP: {
+		FreeAttempts:    10,
+		LockoutAfter:    50,
+		MaxDelay:        time.Minute,
+		LockoutDuration: 15 * time.Minute,
+		MaxLockout:      2 * time.Hour,
+		Window:          time.Hour,
+	},
+}
+
+// ThrottleStatus says whether an attempt may be checked now
+type ThrottleStatus struct {
+	RetryAfter time.Duration // Zero when the attempt can go ahead
+	Locked     bool          // The key is locked out rather than just delayed
+}
+
+// Allowed reports whether the attempt can go ahead
+func (s ThrottleStatus) Allowed() bool {
+	return s.RetryAfter <= 0
+}
+
+// CheckThrottle reports whether an attempt for the key has to wait. Call it before
+// checking the password or code, so waiting attempts are refused without a guess.
+func CheckThrottle(db *gorm.DB, scope, key string) ThrottleStatus {
+	var throttle models.AuthThrottle
+	if err := db.Where("scope = ? AND key = ?", scope, key).First(&throttle).Error; err != nil {
+		return ThrottleStatus{}
+	}
+
+	now := time.Now()
+	if throttle.Locked() {
+		return ThrottleStatus{RetryAfter: throttle.LockedUntil.Sub(now), Locked: true}
+	}
+	if throttle.RetryAt != nil && now.Before(*throttle.RetryAt) {
+		return ThrottleStatus{RetryAfter: throttle.RetryAt.Sub(now)}
+	}
+	return ThrottleStatus{}
+}
+
+// RecordFailure counts a failed attempt for the key and sets how long the next one has
+// to wait. It returns the lockout end when this failure started a lockout.
+func RecordFailure(db *gorm.DB, scope, key string) (*time.Time, error) {
+	policy := throttlePolicies[scope]
+
+	var lockedUntil *time.Time
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var throttle models.AuthThrottle
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("scope = ? AND key = ?", scope, key).First(&throttle).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			throttle = models.AuthThrottle{Scope: scope, Key: key}
+		} else if err != nil {
+			return err
+		}
+
+		if now.Sub(throttle.LastFailureAt) > policy.Window {
+			throttle.Failures = 0
+			throttle.Lockouts = 0
+		}
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		throttle.RetryAt = nil
+
+		switch {
+		case throttle.Failures >= policy.LockoutAfter:
+			duration := time.Duration(float64(policy.LockoutDuration) * math.Pow(2, float64(throttle.Lockouts)))
+			if duration > policy.MaxLockout {
+				duration = policy.MaxLockout
+			}
+			until := now.Add(duration)
+			throttle.LockedUntil = &until
+			throttle.Lockouts++
+			throttle.Failures = 0
+			lockedUntil = &until
+		case throttle.Failures > policy.FreeAttempts:
+			// 1s, 2s, 4s, ... between attempts
+			delay := time.Second * time.Duration(math.Pow(2, float64(throttle.Failures-policy.FreeAttempts-1)))
+			if delay > policy.MaxDelay {
+				delay = policy.MaxDelay
+			}
+			retryAt := now.Add(delay)
+			throttle.RetryAt = &retryAt
+		}
+
+		return tx.Save(&throttle).Error
+	})
+	return lockedUntil, err
+}
+
+// ResetThrottle forgets the failures for the key after a successful attempt
+func ResetThrottle(db *gorm.DB, scope, key string) error {
+	return db.Where("scope = ? AND key = ?", scope, key).Delete(&models.AuthThrottle{}).Error
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+)
+
+func TestThrottlePolicy(t *testing.T) {
+	db := openTestDB(t, &models.AuthThrottle{})
+	const key = "buyer@example.com"
+
+	// clearDelay lets the next failure be recorded without waiting out the delay before it
+	clearDelay := func() {
+		db.Model(&models.AuthThrottle{}).Where("key = ?", key).Update("retry_at", nil)
+	}
+	// expireLockout ends the current lockout without forgetting that it happened
+	expireLockout := func() {
+		db.Model(&models.AuthThrottle{}).Where("key = ?", key).Update("locked_until", time.Now().Add(-time.Second))
+	}
+
+	steps := []struct {
+		name       string
+		before     func()
+		failures   int           // Failures recorded in this step
+		wantDelay  time.Duration // Wait after the last of them, rounded to the second
+		wantLocked bool
+	}{
+		{name: "free attempts", failures: 3},
+		{name: "first delayed attempt", failures: 1, wantDelay: time.Second},
+		{name: "delay doubles", before: clearDelay, failures: 1, wantDelay: 2 * time.Second},
+		{name: "delay keeps doubling", before: clearDelay, failures: 4, wantDelay: 32 * time.Second},
+		{name: "lockout", before: clearDelay, failures: 1, wantDelay: 15 * time.Minute, wantLocked: true},
+		{name: "failures start over after a lockout", before: expireLockout, failures: 3},
+		{name: "second lockout is twice as long", before: clearDelay, failures: 7, wantDelay: 30 * time.Minute, wantLocked: true},
+		{name: "failures outside the window are forgotten", before: func() {
+			expireLockout()
+			db.Model(&models.AuthThrottle{}).Where("key = ?", key).
+				Update("last_failure_at", time.Now().Add(-25*time.Hour))
+		}, failures: 3},
+		{name: "lockout after the window starts at its first length", before: clearDelay, failures: 7, wantDelay: 15 * time.Minute, wantLocked: true},
+	}
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		var lockedUntil *time.Time
+		for i := 0; i < step.failures; i++ {
+			if i > 0 {
+				clearDelay()
+			}
+			until, err := RecordFailure(db, models.ThrottleAccount, key)
+			if err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			lockedUntil = until
+		}
+
+		status := CheckThrottle(db, models.ThrottleAccount, key)
+		if delay := status.RetryAfter.Round(time.Second); delay != step.wantDelay || status.Locked != step.wantLocked {
+			t.Errorf("%s: got wait %s locked %v, want %s locked %v", step.name, delay, status.Locked, step.wantDelay, step.wantLocked)
+		}
+		if (lockedUntil != nil) != step.wantLocked {
+			t.Errorf("%s: RecordFailure returned lockout %v", step.name, lockedUntil)
+		}
+	}
+
+	if status := CheckThrottle(db, models.ThrottleIP, key); !status.Allowed() {
+		t.Error("account failures throttled the IP scope")
+	}
+	if err := ResetThrottle(db, models.ThrottleAccount, key); err != nil {
+		t.Fatal(err)
+	}
+	if status := CheckThrottle(db, models.ThrottleAccount, key); !status.Allowed() {
+		t.Errorf("still throttled after a reset: %+v", status)
+	}
+}
+
+func TestIPThrottleIsLooser(t *testing.T) {
+	db := openTestDB(t, &models.AuthThrottle{})
+	ip, account := throttlePolicies[models.ThrottleIP], throttlePolicies[models.ThrottleAccount]
+	if ip.FreeAttempts <= account.FreeAttempts || ip.LockoutAfter <= account.LockoutAfter {
+		t.Error("IPs, which mobile networks share, should get more attempts than accounts")
+	}
+
+	for i := 0; i < ip.FreeAttempts; i++ {
+		RecordFailure(db, models.ThrottleIP, "196.188.0.1")
+	}
+	if status := CheckThrottle(db, models.ThrottleIP, "196.188.0.1"); !status.Allowed() {
+		t.Errorf("IP throttled within its %d free attempts", ip.FreeAttempts)
+	}
+	RecordFailure(db, models.ThrottleIP, "196.188.0.1")
+	if status := CheckThrottle(db, models.ThrottleIP, "196.188.0.1"); status.Allowed() {
+		t.Error("IP not delayed after its free attempts")
+	}
+}
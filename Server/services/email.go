@@ -2,20 +2,37 @@ package services
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
-	"html/template"
 	"log"
-	"math/rand"
-	"net/smtp"
+	"math/big"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
 	"os"
+	"time"
+
+	"gorm.io/gorm"
 )
 
+// EmailAttachment is a file sent along with an email
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
 type EmailService struct {
 	SMTPHost     string
 	SMTPPort     string
 	SMTPUsername string
 	SMTPPassword string
 	FromEmail    string
+
+	mailer Mailer
+	locale string   // Language emails are rendered in, DefaultLocale when empty
+	outbox *gorm.DB // When set, emails are written to the outbox instead of sent directly
 }
 
 func NewEmailService() *EmailService {
@@ -24,11 +41,13 @@ func NewEmailService() *EmailService {
 		SMTPPort:     getEnv("SMTP_PORT", "587"),
 		SMTPUsername: getEnv("SMTP_USERNAME", ""),
 		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		mailer:       newMailer(),
 	}
 	es.FromEmail = getEnv("FROM_EMAIL", es.SMTPUsername)
 
 	// Log email configuration status (without sensitive data)
 	log.Printf("📧 Email Service initialized:")
+	log.Printf("   Transport: %T", es.mailer)
 	log.Printf("   SMTP Host: %s", es.SMTPHost)
 	log.Printf("   SMTP Port: %s", es.SMTPPort)
 	log.Printf("   SMTP Username: %s (length: %d)", maskEmail(es.SMTPUsername), len(es.SMTPUsername))
@@ -45,6 +64,13 @@ func NewEmailService() *EmailService {
 	return es
 }
 
+// InLocale returns a copy of the service that renders emails in the given language
+func (es *EmailService) InLocale(locale string) *EmailService {
+	localized := *es
+	localized.locale = NormalizeLocale(locale)
+	return &localized
+}
+
 func maskEmail(email string) string {
 	if email == "" {
 		return "(not set)"
@@ -64,9 +90,12 @@ func getEnv(key, defaultValue string) string {
 
 // GenerateVerificationCode creates a secure 6-digit verification code
 func (es *EmailService) GenerateVerificationCode() (string, error) {
-	// Generate a random 6-digit number
-	code := rand.Intn(900000) + 100000 // Ensures 6 digits (100000-999999)
-	return fmt.Sprintf("%06d", code), nil
+	// Generate a random 6-digit number from a secure source so codes can't be predicted
+	n, err := rand.Int(rand.Reader, big.NewInt(900000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()+100000), nil // Ensures 6 digits (100000-999999)
 }
 
 // SendVerificationEmail sends email verification to user
@@ -74,8 +103,8 @@ func (es *EmailService) SendVerificationEmail(email, name, code string) error {
 	// Always log verification code for debugging (even when email is sent)
 	log.Printf("📧 Verification code for %s (%s): %s", email, name, code)
 
-	// Check if email service is configured
-	if !es.IsEmailConfigured() {
+	// Check if email service is configured (queued emails wait in the outbox until it is)
+	if es.outbox == nil && !es.IsEmailConfigured() {
 		log.Printf("⚠️ Email service not configured!")
 		log.Printf("   SMTP_USERNAME: %s", maskEmail(es.SMTPUsername))
 		log.Printf("   SMTP_PASSWORD: %v", es.SMTPPassword != "")
@@ -83,71 +112,6 @@ func (es *EmailService) SendVerificationEmail(email, name, code string) error {
 		return fmt.Errorf("email service not configured")
 	}
 
-	// Email template
-	emailTemplate := `
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>Verify Your Email - Injera Gebeya</title>
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-        .header { background: linear-gradient(135deg, #8B4513, #D2691E); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
-        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
-        .button { display: inline-block; background: #8B4513; color: white; padding: 15px 30px; text-decoration: none; border-radius: 5px; margin: 20px 0; }
-        .footer { text-align: center; margin-top: 30px; color: #666; font-size: 14px; }
-        .logo { font-size: 24px; font-weight: bold; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <div class="logo">🍽️ eGebeya</div>
-            <h1>Welcome to eGebeya!</h1>
-        </div>
-        <div class="content">
-            <h2>Hello {{.Name}}!</h2>
-            <p>Thank you for registering with eGebeya - your gateway to authentic Ethiopian cuisine!</p>
-            <p>To complete your registration and start enjoying our delicious injera and traditional dishes, please verify your email address using the code below:</p>
-            
-            <div style="text-align: center; margin: 30px 0;">
-                <div style="background: #f0f0f0; border: 2px dashed #8B4513; padding: 20px; border-radius: 10px; display: inline-block;">
-                    <p style="margin: 0; font-size: 14px; color: #666;">Your verification code is:</p>
-                    <p style="margin: 10px 0; font-size: 32px; font-weight: bold; color: #8B4513; letter-spacing: 3px; font-family: monospace;">{{.VerificationCode}}</p>
-                </div>
-            </div>
-            
-            <p><strong>This verification code will expire in 24 hours.</strong></p>
-            
-            <p>Go to <a href="{{.FrontendURL}}/verify-email" style="color: #8B4513; text-decoration: none; font-weight: bold;">eGebeya Verification Page</a> and enter this code to complete your registration.</p>
-            
-            <p>Once verified, you'll be able to:</p>
-            <ul>
-                <li>🍽️ Browse our delicious injera and traditional dishes</li>
-                <li>🛒 Add items to your cart and checkout securely</li>
-                <li>📦 Track your orders in real-time</li>
-                <li>💳 Make secure payments with Chapa or Stripe</li>
-            </ul>
-            
-            <p>If you didn't create an account with eGebeya, please ignore this email.</p>
-        </div>
-        <div class="footer">
-            <p>© 2024 eGebeya. All rights reserved.</p>
-            <p>This email was sent to {{.Email}}. If you have any questions, please contact our support team.</p>
-        </div>
-    </div>
-</body>
-</html>`
-
-	// Parse template
-	tmpl, err := template.New("verification").Parse(emailTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse email template: %v", err)
-	}
-
-	// Execute template
-	var body bytes.Buffer
 	data := struct {
 		Name             string
 		Email            string
@@ -160,131 +124,292 @@ func (es *EmailService) SendVerificationEmail(email, name, code string) error {
 		FrontendURL:      getEnv("FRONTEND_URL", "http://localhost:5174"),
 	}
 
-	if err := tmpl.Execute(&body, data); err != nil {
-		return fmt.Errorf("failed to execute email template: %v", err)
+	return es.sendEmail(email, "verification", data)
+}
+
+// SendWelcomeEmail sends welcome email after verification
+func (es *EmailService) SendWelcomeEmail(email, name string) error {
+	data := struct {
+		Name        string
+		FrontendURL string
+	}{
+		Name:        name,
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
 	}
 
-	// Email headers
-	subject := "Verify Your Email - Injera Gebeya"
-	headers := make(map[string]string)
-	headers["From"] = es.FromEmail
-	headers["To"] = email
-	headers["Subject"] = subject
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=UTF-8"
-
-	// Build email message
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
+	return es.sendEmail(email, "welcome", data)
+}
+
+// SendPasswordResetEmail sends the forgot-password code and a link that carries the reset token
+func (es *EmailService) SendPasswordResetEmail(email, name, code, token string, expiresIn time.Duration) error {
+	frontendURL := getEnv("FRONTEND_URL", "http://localhost:5174")
+	data := struct {
+		Name             string
+		Code             string
+		ResetURL         string
+		ExpiresInMinutes int
+	}{
+		Name:             name,
+		Code:             code,
+		ResetURL:         frontendURL + "/reset-password?token=" + url.QueryEscape(token),
+		ExpiresInMinutes: int(expiresIn.Minutes()),
 	}
-	message += "\r\n" + body.String()
-
-	// Send email
-	auth := smtp.PlainAuth("", es.SMTPUsername, es.SMTPPassword, es.SMTPHost)
-	addr := es.SMTPHost + ":" + es.SMTPPort
-
-	log.Printf("📧 Attempting to send email to: %s", email)
-	log.Printf("📧 SMTP Server: %s", addr)
-	log.Printf("📧 From: %s", es.FromEmail)
-	log.Printf("📧 SMTP Username: %s", maskEmail(es.SMTPUsername))
-
-	if err := smtp.SendMail(addr, auth, es.FromEmail, []string{email}, []byte(message)); err != nil {
-		log.Printf("❌ Failed to send email to %s: %v", email, err)
-		log.Printf("❌ Error details: %+v", err)
-		// Log more context for common SMTP errors
-		if err.Error() != "" {
-			log.Printf("❌ SMTP Error message: %s", err.Error())
-		}
-		return fmt.Errorf("failed to send email: %v", err)
+
+	return es.sendEmail(email, "password-reset", data)
+}
+
+// SendTwoFactorCodeEmail sends the one-time code that finishes a sign-in
+func (es *EmailService) SendTwoFactorCodeEmail(email, name, code string, expiresIn time.Duration) error {
+	data := struct {
+		Name             string
+		Code             string
+		ExpiresInMinutes int
+		FrontendURL      string
+	}{
+		Name:             name,
+		Code:             code,
+		ExpiresInMinutes: int(expiresIn.Minutes()),
+		FrontendURL:      getEnv("FRONTEND_URL", "http://localhost:5174"),
 	}
 
-	log.Printf("✅ Email sent successfully to: %s", email)
-	return nil
+	return es.sendEmail(email, "two-factor-code", data)
 }
 
-// SendWelcomeEmail sends welcome email after verification
-func (es *EmailService) SendWelcomeEmail(email, name string) error {
-	welcomeTemplate := `
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>Welcome to Injera Gebeya!</title>
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-        .header { background: linear-gradient(135deg, #8B4513, #D2691E); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
-        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
-        .footer { text-align: center; margin-top: 30px; color: #666; font-size: 14px; }
-        .logo { font-size: 24px; font-weight: bold; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <div class="logo">🍽️ eGebeya</div>
-            <h1>Welcome Aboard!</h1>
-        </div>
-        <div class="content">
-            <h2>Hello {{.Name}}!</h2>
-            <p>🎉 Congratulations! Your email has been successfully verified.</p>
-            <p>You're now ready to explore eGebeya and discover the authentic taste of Ethiopia!</p>
-            
-            <p><strong>What's next?</strong></p>
-            <ul>
-                <li>🍽️ Browse our delicious injera and traditional dishes</li>
-                <li>🛒 Add items to your cart and checkout securely</li>
-                <li>📦 Track your orders in real-time</li>
-                <li>💳 Make secure payments with Chapa or Stripe</li>
-            </ul>
-            
-            <p>Start your culinary journey now: <a href="{{.FrontendURL}}/products">Browse Products</a></p>
-        </div>
-        <div class="footer">
-            <p>© 2024 eGebeya. All rights reserved.</p>
-        </div>
-    </div>
-</body>
-</html>`
-
-	tmpl, err := template.New("welcome").Parse(welcomeTemplate)
-	if err != nil {
-		return fmt.Errorf("failed to parse welcome template: %v", err)
+// SendConfirmEmailCode sends the code that proves the user owns an email address
+// they're adding to their account
+func (es *EmailService) SendConfirmEmailCode(email, name, code string, expiresIn time.Duration) error {
+	data := struct {
+		Name             string
+		Code             string
+		ExpiresInMinutes int
+	}{
+		Name:             name,
+		Code:             code,
+		ExpiresInMinutes: int(expiresIn.Minutes()),
+	}
+
+	return es.sendEmail(email, "confirm-email", data)
+}
+
+// SendAccountLockedEmail tells the user sign-in was locked after repeated failed attempts
+func (es *EmailService) SendAccountLockedEmail(email, name string, lockedUntil time.Time, ip string) error {
+	data := struct {
+		Name        string
+		LockedUntil string
+		IP          string
+		FrontendURL string
+	}{
+		Name:        name,
+		LockedUntil: lockedUntil.UTC().Format("2006-01-02 15:04 UTC"),
+		IP:          ip,
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
+	}
+
+	return es.sendEmail(email, "account-locked", data)
+}
+
+// SendPasswordChangedEmail tells the user their password was changed and their sessions ended
+func (es *EmailService) SendPasswordChangedEmail(email, name string, changedAt time.Time) error {
+	data := struct {
+		Name        string
+		ChangedAt   string
+		FrontendURL string
+	}{
+		Name:        name,
+		ChangedAt:   changedAt.UTC().Format("2006-01-02 15:04 UTC"),
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
 	}
 
-	var body bytes.Buffer
+	return es.sendEmail(email, "password-changed", data)
+}
+
+// SendSellerApprovedEmail tells a seller their KYC review passed and they can publish products
+func (es *EmailService) SendSellerApprovedEmail(email, name, shopName string) error {
+	data := struct {
+		Name        string
+		ShopName    string
+		FrontendURL string
+	}{
+		Name:        name,
+		ShopName:    shopName,
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
+	}
+
+	return es.sendEmail(email, "seller-approved", data)
+}
+
+// SendSellerRejectedEmail tells a seller why their KYC review failed so they can resubmit
+func (es *EmailService) SendSellerRejectedEmail(email, name, shopName, reason string) error {
+	data := struct {
+		Name        string
+		ShopName    string
+		Reason      string
+		FrontendURL string
+	}{
+		Name:        name,
+		ShopName:    shopName,
+		Reason:      reason,
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
+	}
+
+	return es.sendEmail(email, "seller-rejected", data)
+}
+
+// SendPriceDropEmail tells a buyer that a product on their wishlist got cheaper
+func (es *EmailService) SendPriceDropEmail(email, name, productName string, productID uint, oldPrice, newPrice float64) error {
 	data := struct {
-		Name string
+		Name        string
+		ProductName string
+		ProductID   uint
+		OldPrice    float64
+		NewPrice    float64
+		FrontendURL string
 	}{
-		Name: name,
+		Name:        name,
+		ProductName: productName,
+		ProductID:   productID,
+		OldPrice:    oldPrice,
+		NewPrice:    newPrice,
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
+	}
+
+	return es.sendEmail(email, "price-drop", data)
+}
+
+// SendBackInStockEmail tells a buyer that a product on their wishlist is available again
+func (es *EmailService) SendBackInStockEmail(email, name, productName string, productID uint) error {
+	data := struct {
+		Name        string
+		ProductName string
+		ProductID   uint
+		FrontendURL string
+	}{
+		Name:        name,
+		ProductName: productName,
+		ProductID:   productID,
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
+	}
+
+	return es.sendEmail(email, "back-in-stock", data)
+}
+
+// sendEmail renders the named template in the service's locale and sends it as
+// HTML with a plaintext alternative and optional attachments
+func (es *EmailService) sendEmail(to, templateName string, data interface{}, attachments ...EmailAttachment) error {
+	if to == "" {
+		// Accounts registered by phone have no address to send to
+		return nil
+	}
+	if es.outbox == nil && !es.IsEmailConfigured() {
+		return fmt.Errorf("email service not configured")
+	}
+
+	subject, html, text, err := RenderEmail(templateName, es.locale, data)
+	if err != nil {
+		return err
 	}
 
-	if err := tmpl.Execute(&body, data); err != nil {
-		return fmt.Errorf("failed to execute welcome template: %v", err)
+	var content bytes.Buffer
+	contentType, err := writeEmailBody(&content, html, text, attachments)
+	if err != nil {
+		return fmt.Errorf("failed to build %s email: %v", templateName, err)
 	}
 
-	subject := "Welcome to Injera Gebeya!"
-	headers := make(map[string]string)
-	headers["From"] = es.FromEmail
-	headers["To"] = email
-	headers["Subject"] = subject
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=UTF-8"
-
-	message := ""
-	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
+	if es.outbox != nil {
+		return enqueueEmail(es.outbox, templateName, to, subject, contentType, content.String())
 	}
-	message += "\r\n" + body.String()
 
-	auth := smtp.PlainAuth("", es.SMTPUsername, es.SMTPPassword, es.SMTPHost)
-	addr := es.SMTPHost + ":" + es.SMTPPort
+	if err := es.deliver(to, subject, contentType, content.String()); err != nil {
+		log.Printf("❌ Failed to send %s email to %s: %v", templateName, to, err)
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	log.Printf("✅ %s email sent to: %s", templateName, to)
+	return nil
+}
+
+// deliver sends an already rendered message body through the configured transport
+func (es *EmailService) deliver(to, subject, contentType, body string) error {
+	return es.mailer.Send(Message{
+		From:        es.FromEmail,
+		To:          to,
+		Subject:     subject,
+		ContentType: contentType,
+		Body:        body,
+	})
+}
 
-	return smtp.SendMail(addr, auth, es.FromEmail, []string{email}, []byte(message))
+// writeEmailBody writes the message body and returns its Content-Type header. HTML-only
+// messages are sent as-is; a plaintext version makes it multipart/alternative, and
+// attachments wrap that in multipart/mixed.
+func writeEmailBody(w *bytes.Buffer, html, text string, attachments []EmailAttachment) (string, error) {
+	if text == "" && len(attachments) == 0 {
+		w.WriteString(html)
+		return "text/html; charset=UTF-8", nil
+	}
+
+	var alternative bytes.Buffer
+	bodyType := "text/html; charset=UTF-8"
+	if text != "" {
+		aw := multipart.NewWriter(&alternative)
+		for _, part := range []struct{ contentType, content string }{
+			{"text/plain; charset=UTF-8", text},
+			{"text/html; charset=UTF-8", html},
+		} {
+			pw, err := aw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+			if err != nil {
+				return "", err
+			}
+			if _, err := pw.Write([]byte(part.content)); err != nil {
+				return "", err
+			}
+		}
+		if err := aw.Close(); err != nil {
+			return "", err
+		}
+		bodyType = "multipart/alternative; boundary=" + aw.Boundary()
+	} else {
+		alternative.WriteString(html)
+	}
+
+	if len(attachments) == 0 {
+		w.Write(alternative.Bytes())
+		return bodyType, nil
+	}
+
+	mw := multipart.NewWriter(w)
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {bodyType}})
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(alternative.Bytes()); err != nil {
+		return "", err
+	}
+
+	for _, attachment := range attachments {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf(`attachment; filename="%s"`, attachment.Filename)},
+		})
+		if err != nil {
+			return "", err
+		}
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	return "multipart/mixed; boundary=" + mw.Boundary(), nil
 }
 
 // IsEmailConfigured checks if email service is properly configured
 func (es *EmailService) IsEmailConfigured() bool {
-	return es.SMTPUsername != "" && es.SMTPPassword != ""
+	return es.mailer.Configured()
 }
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Email templates live in templates/email. Each email is a pair of files: <name>.html
+// defines "heading" and "content" (and optionally "footer") for the shared layout.html,
+// and <name>.txt defines "subject" and the plaintext "content" for layout.txt.
+// User-facing strings come from the message catalogs in templates/locales and are
+// looked up with {{t "key" args...}}; keys missing from a locale fall back to English.
+
+//go:embed templates
+var templateFS embed.FS
+
+// DefaultLocale is used for users without a locale and for untranslated strings
+const DefaultLocale = "en"
+
+// SupportedLocales are the languages emails can be sent in: English, Amharic and Afaan Oromo
+var SupportedLocales = []string{"en", "am", "om"}
+
+// ErrUnknownEmailTemplate is returned when rendering a template that doesn't exist
+var ErrUnknownEmailTemplate = errors.New("unknown email template")
+
+// emailPartials are shared by every email and are not emails themselves
+var emailPartials = map[string]bool{"layout": true, "features": true}
+
+var (
+	emailTranslations  = map[string]map[string]string{}
+	htmlEmailTemplates = map[string]*template.Template{}
+	textEmailTemplates = map[string]*texttemplate.Template{}
+	emailTemplateNames []string
+)
+
+func init() {
+	for _, locale := range SupportedLocales {
+		data, err := templateFS.ReadFile("templates/locales/" + locale + ".json")
+		if err != nil {
+			panic(fmt.Sprintf("missing %s email translations: %v", locale, err))
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("invalid %s email translations: %v", locale, err))
+		}
+		emailTranslations[locale] = messages
+	}
+
+	files, err := fs.Glob(templateFS, "templates/email/*.html")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".html")
+		if emailPartials[name] {
+			continue
+		}
+
+		htmlTmpl, err := template.New(name).Option("missingkey=error").Funcs(htmlEmailFuncs(DefaultLocale)).
+			ParseFS(templateFS, "templates/email/layout.html", "templates/email/features.html", file)
+		if err != nil {
+			panic(fmt.Sprintf("failed to parse %s email template: %v", name, err))
+		}
+		textTmpl, err := texttemplate.New(name).Option("missingkey=error").Funcs(textEmailFuncs(DefaultLocale)).
+			ParseFS(templateFS, "templates/email/layout.txt", "templates/email/features.txt", "templates/email/"+name+".txt")
+		if err != nil {
+			panic(fmt.Sprintf("failed to parse %s email text template: %v", name, err))
+		}
+
+		htmlEmailTemplates[name] = htmlTmpl
+		textEmailTemplates[name] = textTmpl
+		emailTemplateNames = append(emailTemplateNames, name)
+	}
+	sort.Strings(emailTemplateNames)
+}
+
+// NormalizeLocale picks the first supported language from a locale or an
+// Accept-Language header ("am-ET,am;q=0.9,en;q=0.8"), or DefaultLocale
+func NormalizeLocale(locale string) string {
+	for _, part := range strings.Split(locale, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if i := strings.IndexAny(tag, "-_"); i >= 0 {
+			tag = tag[:i]
+		}
+		lang := strings.ToLower(tag)
+		for _, supported := range SupportedLocales {
+			if lang == supported {
+				return supported
+			}
+		}
+	}
+	return DefaultLocale
+}
+
+// translate looks up a message in the locale's catalog and fills in its arguments
+func translate(locale, key string, args ...interface{}) string {
+	format, ok := emailTranslations[locale][key]
+	if !ok {
+		format, ok = emailTranslations[DefaultLocale][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+func formatMoney(locale string, amount float64) string {
+	return translate(locale, "common.currency", fmt.Sprintf("%.2f", amount))
+}
+
+// htmlEmailFuncs are the template helpers for HTML emails. Translations are trusted,
+// arguments are escaped unless another helper already produced HTML.
+func htmlEmailFuncs(locale string) template.FuncMap {
+	escape := func(v interface{}) string {
+		if html, ok := v.(template.HTML); ok {
+			return string(html)
+		}
+		return template.HTMLEscapeString(fmt.Sprint(v))
+	}
+
+	return template.FuncMap{
+		"locale": func() string { return locale },
+		"t": func(key string, args ...interface{}) template.HTML {
+			format := template.HTMLEscapeString(translate(locale, key))
+			if len(args) == 0 {
+				return template.HTML(format)
+			}
+			escaped := make([]interface{}, len(args))
+			for i, arg := range args {
+				escaped[i] = escape(arg)
+			}
+			return template.HTML(fmt.Sprintf(format, escaped...))
+		},
+		"money": func(amount float64) string { return formatMoney(locale, amount) },
+		"strong": func(v interface{}) template.HTML {
+			return template.HTML("<strong>" + escape(v) + "</strong>")
+		},
+		"highlight": func(v interface{}) template.HTML {
+			return template.HTML(`<strong class="highlight" style="color: #8B4513;">` + escape(v) + "</strong>")
+		},
+		"link": func(url string, label interface{}) template.HTML {
+			return template.HTML(`<a href="` + template.HTMLEscapeString(url) + `" style="color: #8B4513; font-weight: bold;">` + escape(label) + "</a>")
+		},
+	}
+}
+
+// textEmailFuncs are the plaintext counterparts of htmlEmailFuncs
+func textEmailFuncs(locale string) texttemplate.FuncMap {
+	plain := func(v interface{}) string { return fmt.Sprint(v) }
+
+	return texttemplate.FuncMap{
+		"locale": func() string { return locale },
+		"t": func(key string, args ...interface{}) string {
+			if len(args) == 0 {
+				return translate(locale, key)
+			}
+			// Catalogs use %s throughout, so numbers are stringified as in the HTML helper
+			strs := make([]interface{}, len(args))
+			for i, arg := range args {
+				strs[i] = plain(arg)
+			}
+			return fmt.Sprintf(translate(locale, key), strs...)
+		},
+		"money":     func(amount float64) string { return formatMoney(locale, amount) },
+		"strong":    plain,
+		"highlight": plain,
+		"link":      func(url string, label interface{}) string { return url },
+	}
+}
+
+// EmailTemplateNames lists the emails that can be rendered
+func EmailTemplateNames() []string {
+	return append([]string(nil), emailTemplateNames...)
+}
+
+// RenderEmail renders an email's subject, HTML and plaintext bodies in the given locale
+func RenderEmail(name, locale string, data interface{}) (subject, html, text string, err error) {
+	htmlTmpl, ok := htmlEmailTemplates[name]
+	if !ok {
+		return "", "", "", fmt.Errorf("%w: %s", ErrUnknownEmailTemplate, name)
+	}
+	textTmpl := textEmailTemplates[name]
+	locale = NormalizeLocale(locale)
+
+	htmlClone, err := htmlTmpl.Clone()
+	if err != nil {
+		return "", "", "", err
+	}
+	var htmlBody bytes.Buffer
+	if err := htmlClone.Funcs(htmlEmailFuncs(locale)).ExecuteTemplate(&htmlBody, "layout", data); err != nil {
+		return "", "", "", fmt.Errorf("failed to execute %s template: %v", name, err)
+	}
+
+	textClone, err := textTmpl.Clone()
+	if err != nil {
+		return "", "", "", err
+	}
+	textClone.Funcs(textEmailFuncs(locale))
+	var subjectBuf, textBody bytes.Buffer
+	if err := textClone.ExecuteTemplate(&subjectBuf, "subject", data); err != nil {
+		return "", "", "", fmt.Errorf("failed to execute %s subject: %v", name, err)
+	}
+	if err := textClone.ExecuteTemplate(&textBody, "layout", data); err != nil {
+		return "", "", "", fmt.Errorf("failed to execute %s text template: %v", name, err)
+	}
+
+	return strings.TrimSpace(subjectBuf.String()), htmlBody.String(), textBody.String(), nil
+}
+
+// PreviewEmail renders an email with sample data, for checking templates and translations
+func PreviewEmail(name, locale string) (subject, html, text string, err error) {
+	sample, ok := emailSamples[name]
+	if !ok {
+		return "", "", "", fmt.Errorf("%w: %s", ErrUnknownEmailTemplate, name)
+	}
+	return RenderEmail(name, locale, sample)
+}
+
+// emailSamples is the preview data for each email; keys match the fields its Send method passes
+var emailSamples = map[string]map[string]interface{}{
+	"verification": {
+		"Name": "Abebe Kebede", "Email": "abebe@example.com", "VerificationCode": "482913",
+		"FrontendURL": "https://egebeya.example.com",
+	},
+	"welcome": {
+		"Name": "Abebe Kebede", "FrontendURL": "https://egebeya.example.com",
+	},
+	"password-reset": {
+		"Name": "Abebe Kebede", "Code": "730514", "ExpiresInMinutes": 30,
+		"ResetURL": "https://egebeya.example.com/reset-password?token=sample-token",
+	},
+	"two-factor-code": {
+		"Name": "Abebe Kebede", "Code": "482913", "ExpiresInMinutes": 10, "FrontendURL": "https://egebeya.example.com",
+	},
+	"confirm-email": {
+		"Name": "Abebe Kebede", "Code": "482913", "ExpiresInMinutes": 10,
+	},
+	"account-locked": {
+		"Name": "Abebe Kebede", "LockedUntil": "2024-01-01 09:45 UTC", "IP": "196.188.10.20", "FrontendURL": "https://egebeya.example.com",
+	},
+	"password-changed": {
+		"Name": "Abebe Kebede", "ChangedAt": "2024-01-01 09:30 UTC", "FrontendURL": "https://egebeya.example.com",
+	},
+	"seller-approved": {
+		"Name": "Abebe Kebede", "ShopName": "Abebe's Injera", "FrontendURL": "https://egebeya.example.com",
+	},
+	"seller-rejected": {
+		"Name": "Abebe Kebede", "ShopName": "Abebe's Injera",
+		"Reason": "The trade licence photo is too blurry to read", "FrontendURL": "https://egebeya.example.com",
+	},
+	"price-drop": {
+		"Name": "Abebe Kebede", "ProductName": "Teff Injera (10 pcs)", "ProductID": 42,
+		"OldPrice": 250.0, "NewPrice": 199.5, "FrontendURL": "https://egebeya.example.com",
+	},
+	"back-in-stock": {
+		"Name": "Abebe Kebede", "ProductName": "Teff Injera (10 pcs)", "ProductID": 42,
+		"FrontendURL": "https://egebeya.example.com",
+	},
+	"order-confirmation": {
+		"Name": "Abebe Kebede", "OrderNumber": "ORD-20240101-0001", "OrderID": 1001, "Total": 1437.5,
+		"FrontendURL": "https://egebeya.example.com",
+	},
+	"new-order": {
+		"Name": "Tigist Alemu", "ShopName": "Tigist's Kitchen", "OrderNumber": "ORD-20240101-0001",
+		"ShippingCity": "Addis Ababa", "Total": 1250.0, "FrontendURL": "https://egebeya.example.com",
+		"Items": []OrderEmailItem{
+			{Name: "Teff Injera", Variant: "10 pcs", Quantity: 3, Total: 750},
+			{Name: "Berbere Spice", Quantity: 2, Total: 500},
+		},
+	},
+	"order-status": {
+		"Name": "Abebe Kebede", "OrderNumber": "ORD-20240101-0001", "OrderID": 1001, "Status": "shipped",
+		"FrontendURL": "https://egebeya.example.com",
+	},
+	"payment-failed": {
+		"Name": "Abebe Kebede", "Reference": "tx-5f2c9a", "Amount": 1437.5,
+		"FrontendURL": "https://egebeya.example.com",
+	},
+	"refund-issued": {
+		"Name": "Abebe Kebede", "OrderNumber": "ORD-20240101-0001", "OrderID": 1001, "Amount": 1437.5,
+		"FrontendURL": "https://egebeya.example.com",
+	},
+}
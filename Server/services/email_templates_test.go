@@ -0,0 +1,37 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+// Every template renders in every locale without missing translations or format errors
+func TestPreviewEmailTemplates(t *testing.T) {
+	for _, name := range EmailTemplateNames() {
+		for _, locale := range SupportedLocales {
+			subject, html, text, err := PreviewEmail(name, locale)
+			if err != nil {
+				t.Errorf("%s/%s: %v", name, locale, err)
+				continue
+			}
+			for part, body := range map[string]string{"subject": subject, "html": html, "text": text} {
+				if strings.TrimSpace(body) == "" {
+					t.Errorf("%s/%s: empty %s", name, locale, part)
+				}
+				if strings.Contains(body, "%!") {
+					t.Errorf("%s/%s: bad format verb in %s: %q", name, locale, part, body)
+				}
+			}
+		}
+	}
+}
+
+func TestPasswordResetTextShowsExpiry(t *testing.T) {
+	_, _, text, err := PreviewEmail("password-reset", "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "30 minutes") {
+		t.Errorf("plaintext email doesn't state the expiry:\n%s", text)
+	}
+}
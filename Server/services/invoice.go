@@ -0,0 +1,372 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/signintech/gopdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// Invoices are rendered with the Go fonts for Latin text and Noto Sans Ethiopic
+// for Amharic/Tigrinya product and shop names. The Ethiopic fonts are read from
+// INVOICE_FONT_DIR (default "assets/fonts"); without them Ethiopic text is left blank.
+
+const (
+	invoiceMargin      = 40.0
+	invoicePageWidth   = 595.0 // A4 in points
+	invoicePageHeight  = 842.0
+	invoiceLineHeight  = 16.0
+	invoiceBottomLimit = invoicePageHeight - 80
+)
+
+var (
+	ethiopicFontsOnce sync.Once
+	ethiopicRegular   []byte
+	ethiopicBold      []byte
+)
+
+func loadEthiopicFonts() {
+	ethiopicFontsOnce.Do(func() {
+		dir := getEnv("INVOICE_FONT_DIR", "assets/fonts")
+		var err error
+		ethiopicRegular, err = os.ReadFile(filepath.Join(dir, "NotoSansEthiopic-Regular.ttf"))
+		if err != nil {
+			log.Printf("⚠️  Ethiopic invoice font not found in %s, Amharic text will not render: %v", dir, err)
+			return
+		}
+		ethiopicBold, err = os.ReadFile(filepath.Join(dir, "NotoSansEthiopic-Bold.ttf"))
+		if err != nil {
+			ethiopicBold = ethiopicRegular
+		}
+	})
+}
+
+// invoiceDoc wraps gopdf, switching between the Latin and Ethiopic fonts per run of text
+type invoiceDoc struct {
+	pdf         *gopdf.GoPdf
+	hasEthiopic bool
+	bold        bool
+	size        float64
+	y           float64
+}
+
+func newInvoiceDoc() (*invoiceDoc, error) {
+	loadEthiopicFonts()
+
+	pdf := &gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
+
+	fonts := map[string][]byte{"latin": goregular.TTF, "latin-bold": gobold.TTF}
+	if ethiopicRegular != nil {
+		fonts["ethiopic"] = ethiopicRegular
+		fonts["ethiopic-bold"] = ethiopicBold
+	}
+	for name, data := range fonts {
+		if err := pdf.AddTTFFontData(name, data); err != nil {
+			return nil, fmt.Errorf("failed to load invoice font %s: %v", name, err)
+		}
+	}
+
+	doc := &invoiceDoc{pdf: pdf, hasEthiopic: ethiopicRegular != nil, size: 10}
+	doc.newPage()
+	return doc, nil
+}
+
+func (d *invoiceDoc) newPage() {
+	d.pdf.AddPage()
+	d.y = invoiceMargin
+}
+
+// ensureSpace starts a new page if the next height points would run into the footer
+func (d *invoiceDoc) ensureSpace(height float64) {
+	if d.y+height > invoiceBottomLimit {
+		d.newPage()
+	}
+}
+
+func (d *invoiceDoc) font(bold bool, size float64) {
+	d.bold = bold
+	d.size = size
+}
+
+func isEthiopic(r rune) bool {
+	return (r >= 0x1200 && r <= 0x139F) || (r >= 0x2D80 && r <= 0x2DDF) || (r >= 0xAB00 && r <= 0xAB2F)
+}
+
+// textRun is a piece of text drawn with a single font
+type textRun struct {
+	family string
+	text   string
+}
+
+// runs splits s into pieces that share a script, so each can use the right font
+func (d *invoiceDoc) runs(s string) []textRun {
+	var result []textRun
+	for _, r := range s {
+		family := "latin"
+		if d.hasEthiopic && isEthiopic(r) {
+			family = "ethiopic"
+		}
+		if d.bold {
+			family += "-bold"
+		}
+		if n := len(result); n > 0 && result[n-1].family == family {
+			result[n-1].text += string(r)
+		} else {
+			result = append(result, textRun{family, string(r)})
+		}
+	}
+	return result
+}
+
+func (d *invoiceDoc) width(s string) float64 {
+	total := 0.0
+	for _, run := range d.runs(s) {
+		if err := d.pdf.SetFont(run.family, "", d.size); err != nil {
+			continue
+		}
+		if w, err := d.pdf.MeasureTextWidth(run.text); err == nil {
+			total += w
+		}
+	}
+	return total
+}
+
+// text draws s with its left edge at x on the current line
+func (d *invoiceDoc) text(x float64, s string) {
+	for _, run := range d.runs(s) {
+		if err := d.pdf.SetFont(run.family, "", d.size); err != nil {
+			continue
+		}
+		d.pdf.SetXY(x, d.y)
+		d.pdf.Cell(nil, run.text)
+		if w, err := d.pdf.MeasureTextWidth(run.text); err == nil {
+			x += w
+		}
+	}
+}
+
+// textRight draws s with its right edge at x
+func (d *invoiceDoc) textRight(x float64, s string) {
+	d.text(x-d.width(s), s)
+}
+
+// fit shortens s with an ellipsis so it is at most maxWidth wide
+func (d *invoiceDoc) fit(s string, maxWidth float64) string {
+	if d.width(s) <= maxWidth {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && d.width(string(runes)+"…") > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+func (d *invoiceDoc) rule() {
+	d.pdf.SetStrokeColor(200, 200, 200)
+	d.pdf.SetLineWidth(0.5)
+	d.pdf.Line(invoiceMargin, d.y, invoicePageWidth-invoiceMargin, d.y)
+	d.y += 6
+}
+
+func (d *invoiceDoc) newLine() {
+	d.y += invoiceLineHeight
+}
+
+func formatETB(amount float64) string {
+	return fmt.Sprintf("%.2f ETB", amount)
+}
+
+// GenerateInvoicePDF renders an order as a tax invoice / receipt. The order must have its
+// User, OrderItems and TaxLines loaded; sellers are keyed by user ID and supply shop TINs.
+func GenerateInvoicePDF(order models.Order, sellers map[uint]models.User) ([]byte, error) {
+	doc, err := newInvoiceDoc()
+	if err != nil {
+		return nil, err
+	}
+	doc.pdf.SetInfo(gopdf.PdfInfo{
+		Title:        "Invoice " + order.OrderNumber,
+		Author:       "Injera Gebeya",
+		Creator:      "Injera Gebeya",
+		CreationDate: time.Now(),
+	})
+
+	right := invoicePageWidth - invoiceMargin
+
+	// Header
+	doc.pdf.SetTextColor(180, 83, 9)
+	doc.font(true, 20)
+	doc.text(invoiceMargin, "Injera Gebeya")
+	doc.pdf.SetTextColor(0, 0, 0)
+	doc.font(true, 14)
+	doc.textRight(right, "TAX INVOICE / RECEIPT")
+	doc.y += 28
+
+	doc.font(false, 10)
+	doc.text(invoiceMargin, "Order number: "+order.OrderNumber)
+	doc.textRight(right, "Date: "+order.CreatedAt.Format("02 Jan 2006"))
+	doc.newLine()
+	doc.text(invoiceMargin, fmt.Sprintf("Payment: %s (%s)", strings.ToUpper(order.PaymentMethod), order.PaymentStatus))
+	if order.PaymentID != "" {
+		doc.textRight(right, "Reference: "+order.PaymentID)
+	}
+	doc.newLine()
+	doc.y += 6
+	doc.rule()
+
+	// Buyer and delivery address
+	doc.font(true, 10)
+	doc.text(invoiceMargin, "Billed to")
+	doc.text(320, "Deliver to")
+	doc.newLine()
+	doc.font(false, 10)
+	billTo := []string{order.User.Name, order.User.Email}
+	deliverTo := []string{order.ShippingAddress, strings.Trim(order.ShippingCity+", "+order.ShippingState, ", "), order.ShippingPhone}
+	for i := 0; i < len(billTo) || i < len(deliverTo); i++ {
+		if i < len(billTo) {
+			doc.text(invoiceMargin, doc.fit(billTo[i], 260))
+		}
+		if i < len(deliverTo) {
+			doc.text(320, doc.fit(deliverTo[i], right-320))
+		}
+		doc.newLine()
+	}
+	doc.y += 6
+
+	// Sellers with their tax registration
+	sellerIDs := make([]uint, 0)
+	seen := make(map[uint]bool)
+	for _, item := range order.OrderItems {
+		if !seen[item.SellerID] {
+			seen[item.SellerID] = true
+			sellerIDs = append(sellerIDs, item.SellerID)
+		}
+	}
+	sort.Slice(sellerIDs, func(i, j int) bool { return sellerIDs[i] < sellerIDs[j] })
+
+	doc.font(true, 10)
+	doc.text(invoiceMargin, "Sold by")
+	doc.newLine()
+	doc.font(false, 10)
+	for _, id := range sellerIDs {
+		seller := sellers[id]
+		name := seller.ShopName
+		if name == "" {
+			name = seller.Name
+		}
+		tin := "TIN: not provided"
+		if seller.TIN != "" {
+			tin = "TIN: " + seller.TIN
+		}
+		registration := "TOT"
+		if seller.VATRegistered {
+			registration = "VAT registered"
+		}
+		doc.ensureSpace(invoiceLineHeight)
+		doc.text(invoiceMargin, doc.fit(name, 260))
+		doc.text(320, tin+" · "+registration)
+		doc.newLine()
+	}
+	doc.y += 6
+
+	// Items
+	columns := struct{ item, qty, price, tax, amount float64 }{invoiceMargin, 330, 410, 475, right}
+	itemHeader := func() {
+		doc.font(true, 10)
+		doc.pdf.SetFillColor(245, 240, 230)
+		doc.pdf.RectFromUpperLeftWithStyle(invoiceMargin, doc.y-3, right-invoiceMargin, invoiceLineHeight, "F")
+		doc.text(columns.item, "Item")
+		doc.textRight(columns.qty, "Qty")
+		doc.textRight(columns.price, "Unit price")
+		doc.textRight(columns.tax, "Tax")
+		doc.textRight(columns.amount, "Amount")
+		doc.newLine()
+		doc.font(false, 10)
+	}
+	itemHeader()
+	for _, item := range order.OrderItems {
+		if doc.y+2*invoiceLineHeight > invoiceBottomLimit {
+			doc.newPage()
+			itemHeader()
+		}
+		name := item.ProductName
+		if item.Variant != "" {
+			name += " (" + item.Variant + ")"
+		}
+		tax := "-"
+		if item.TaxAmount > 0 {
+			tax = fmt.Sprintf("%s %g%%", item.TaxType, item.TaxRate*100)
+		}
+		doc.text(columns.item, doc.fit(name, columns.qty-columns.item-40))
+		doc.textRight(columns.qty, fmt.Sprintf("%d", item.Quantity))
+		doc.textRight(columns.price, fmt.Sprintf("%.2f", item.Price))
+		doc.textRight(columns.tax, tax)
+		doc.textRight(columns.amount, fmt.Sprintf("%.2f", item.Total))
+		doc.newLine()
+		if item.SellerShopName != "" {
+			doc.pdf.SetTextColor(110, 110, 110)
+			doc.font(false, 8)
+			doc.text(columns.item+8, doc.fit("Sold by "+item.SellerShopName, columns.qty-columns.item-48))
+			doc.pdf.SetTextColor(0, 0, 0)
+			doc.font(false, 10)
+			doc.y += 12
+		}
+	}
+	doc.y += 4
+	doc.rule()
+
+	// Totals
+	summary := [][2]string{{"Subtotal", formatETB(order.Subtotal)}}
+	if order.Discount > 0 {
+		label := "Discount"
+		if order.PromotionCode != "" {
+			label += " (" + order.PromotionCode + ")"
+		}
+		summary = append(summary, [2]string{label, "-" + formatETB(order.Discount)})
+	}
+	shipping := "Shipping"
+	if order.ShippingZone != "" {
+		shipping += " (" + order.ShippingZone + ")"
+	}
+	summary = append(summary, [2]string{shipping, formatETB(order.ShippingFee)})
+	for _, line := range order.TaxLines {
+		summary = append(summary, [2]string{
+			fmt.Sprintf("%s %g%% on %.2f", line.TaxType, line.Rate*100, line.TaxableAmount),
+			formatETB(line.Amount),
+		})
+	}
+
+	doc.ensureSpace(float64(len(summary)+2) * invoiceLineHeight)
+	doc.font(false, 10)
+	for _, row := range summary {
+		doc.textRight(columns.tax, row[0])
+		doc.textRight(columns.amount, row[1])
+		doc.newLine()
+	}
+	doc.font(true, 12)
+	doc.y += 4
+	doc.textRight(columns.tax, "Total (tax included)")
+	doc.textRight(columns.amount, formatETB(order.Total))
+	doc.newLine()
+
+	// Footer
+	doc.pdf.SetTextColor(110, 110, 110)
+	doc.font(false, 8)
+	doc.y = invoicePageHeight - 50
+	doc.text(invoiceMargin, "Thank you for shopping with Injera Gebeya. Keep this document as your receipt.")
+	doc.y += 11
+	doc.text(invoiceMargin, "Prices are in Ethiopian Birr. VAT/TOT is charged by each seller according to their registration.")
+
+	return doc.pdf.GetBytesPdf(), nil
+}
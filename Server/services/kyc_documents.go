@@ -0,0 +1,65 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// MaxKYCDocumentSize is the largest trade licence or ID scan a seller can upload
+const MaxKYCDocumentSize = 5 * 1024 * 1024
+
+// ErrUnsupportedDocument is returned for uploads that aren't a PDF, JPEG or PNG
+var ErrUnsupportedDocument = errors.New("document must be a PDF, JPEG or PNG file")
+
+// kycDocumentTypes maps the accepted content types to the extension they are stored with
+var kycDocumentTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+// KYCDocumentDir is where seller verification documents are kept. It must not be served
+// publicly; admins download documents through the API.
+func KYCDocumentDir() string {
+	return getEnv("KYC_DOCUMENT_DIR", "uploads/kyc")
+}
+
+// SaveKYCDocument stores an uploaded document under a random name and returns the name.
+// The type is taken from the content, not the uploaded file name.
+func SaveKYCDocument(userID uint, kind string, data []byte) (string, error) {
+	ext, ok := kycDocumentTypes[http.DetectContentType(data)]
+	if !ok {
+		return "", ErrUnsupportedDocument
+	}
+
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%d-%s-%s%s", userID, kind, hex.EncodeToString(random), ext)
+
+	if err := os.MkdirAll(KYCDocumentDir(), 0o700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(KYCDocumentDir(), name), data, 0o600); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// KYCDocumentPath returns where a stored document is on disk
+func KYCDocumentPath(name string) string {
+	return filepath.Join(KYCDocumentDir(), filepath.Base(name))
+}
+
+// RemoveKYCDocument deletes a stored document that has been replaced
+func RemoveKYCDocument(name string) {
+	if name != "" {
+		os.Remove(KYCDocumentPath(name))
+	}
+}
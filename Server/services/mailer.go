@@ -0,0 +1,414 @@
+package services
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a rendered email ready for delivery. Body is already MIME-encoded
+// according to ContentType (plain HTML, multipart/alternative or multipart/mixed).
+type Message struct {
+	From        string
+	To          string
+	Subject     string
+	ContentType string
+	Body        string
+}
+
+// Bytes returns the message as an RFC 5322 email with headers
+func (m Message) Bytes() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", m.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: %s\r\n", m.ContentType)
+	buf.WriteString("\r\n")
+	buf.WriteString(m.Body)
+	return buf.Bytes()
+}
+
+// Mailer delivers rendered messages. The transport is chosen with EMAIL_TRANSPORT:
+//
+//	smtp     - SMTP server (default), SMTP_TLS=starttls|tls|none
+//	sendgrid - SendGrid v3 HTTP API, EMAIL_API_KEY
+//	mailgun  - Mailgun HTTP API, EMAIL_API_KEY and MAILGUN_DOMAIN
+//	file     - writes .eml files to EMAIL_CAPTURE_DIR for local development
+//	memory   - keeps messages in CapturedMail so tests can assert on them
+type Mailer interface {
+	Send(msg Message) error
+	// Configured reports whether the transport has the settings it needs to send
+	Configured() bool
+}
+
+// CapturedMail holds the messages sent with EMAIL_TRANSPORT=memory
+var CapturedMail = &CaptureMailer{}
+
+var (
+	mailerMu       sync.RWMutex
+	mailerOverride Mailer
+)
+
+// UseMailer makes every EmailService use m instead of the transport from the
+// environment. Pass nil to go back to the environment's transport.
+func UseMailer(m Mailer) {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	mailerOverride = m
+}
+
+// newMailer returns the override set with UseMailer or the transport named by EMAIL_TRANSPORT
+func newMailer() Mailer {
+	mailerMu.RLock()
+	override := mailerOverride
+	mailerMu.RUnlock()
+	if override != nil {
+		return override
+	}
+
+	switch strings.ToLower(getEnv("EMAIL_TRANSPORT", "smtp")) {
+	case "sendgrid":
+		return &HTTPMailer{
+			Provider: "sendgrid",
+			APIKey:   getEnv("EMAIL_API_KEY", ""),
+			Endpoint: getEnv("EMAIL_API_URL", "https://api.sendgrid.com/v3/mail/send"),
+		}
+	case "mailgun":
+		domain := getEnv("MAILGUN_DOMAIN", "")
+		return &HTTPMailer{
+			Provider: "mailgun",
+			APIKey:   getEnv("EMAIL_API_KEY", ""),
+			Endpoint: getEnv("EMAIL_API_URL", "https://api.mailgun.net/v3/"+domain+"/messages.mime"),
+		}
+	case "file":
+		return &CaptureMailer{Dir: getEnv("EMAIL_CAPTURE_DIR", "tmp/mail")}
+	case "memory":
+		return CapturedMail
+	default:
+		port := getEnv("SMTP_PORT", "587")
+		tlsMode := "starttls"
+		if port == "465" {
+			tlsMode = "tls"
+		}
+		return &SMTPMailer{
+			Host:     getEnv("SMTP_HOST", "smtp.gmail.com"),
+			Port:     port,
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			TLS:      strings.ToLower(getEnv("SMTP_TLS", tlsMode)),
+		}
+	}
+}
+
+// SMTPMailer sends through an SMTP server. TLS is "starttls" (upgrade a plain
+// connection, usually port 587), "tls" (implicit TLS, usually port 465) or "none".
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	TLS      string
+}
+
+func (m *SMTPMailer) Configured() bool {
+	return m.Username != "" && m.Password != ""
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	addr := net.JoinHostPort(m.Host, m.Port)
+	tlsConfig := &tls.Config{ServerName: m.Host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if m.TLS == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+
+	from := msg.From
+	if parsed, err := mail.ParseAddress(msg.From); err == nil {
+		from = parsed.Address
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// HTTPMailer sends through a provider's HTTP API. Mailgun accepts the MIME message
+// as-is; for SendGrid the parts are unpacked into its JSON format.
+type HTTPMailer struct {
+	Provider string // "sendgrid" or "mailgun"
+	APIKey   string
+	Endpoint string
+	Client   *http.Client
+}
+
+func (m *HTTPMailer) Configured() bool {
+	return m.APIKey != ""
+}
+
+func (m *HTTPMailer) Send(msg Message) error {
+	var req *http.Request
+	var err error
+	switch m.Provider {
+	case "sendgrid":
+		req, err = m.sendgridRequest(msg)
+	case "mailgun":
+		req, err = m.mailgunRequest(msg)
+	default:
+		return fmt.Errorf("unknown email provider %q", m.Provider)
+	}
+	if err != nil {
+		return err
+	}
+
+	client := m.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %d: %s", m.Provider, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (m *HTTPMailer) sendgridRequest(msg Message) (*http.Request, error) {
+	html, text, attachments, err := splitMessageParts(msg.ContentType, msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	type attachment struct {
+		Content     string `json:"content"`
+		Filename    string `json:"filename"`
+		Type        string `json:"type"`
+		Disposition string `json:"disposition"`
+	}
+
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		from = &mail.Address{Address: msg.From}
+	}
+
+	payload := map[string]interface{}{
+		"personalizations": []map[string]interface{}{{"to": []map[string]string{{"email": msg.To}}}},
+		"from":             map[string]string{"email": from.Address, "name": from.Name},
+		"subject":          msg.Subject,
+	}
+	var contents []content
+	if text != "" {
+		contents = append(contents, content{"text/plain", text})
+	}
+	contents = append(contents, content{"text/html", html})
+	payload["content"] = contents
+
+	if len(attachments) > 0 {
+		var list []attachment
+		for _, a := range attachments {
+			list = append(list, attachment{base64.StdEncoding.EncodeToString(a.Data), a.Filename, a.ContentType, "attachment"})
+		}
+		payload["attachments"] = list
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", m.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func (m *HTTPMailer) mailgunRequest(msg Message) (*http.Request, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("to", msg.To); err != nil {
+		return nil, err
+	}
+	part, err := form.CreateFormFile("message", "message.eml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(msg.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", m.Endpoint, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth("api", m.APIKey)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req, nil
+}
+
+// splitMessageParts unpacks a body built by writeEmailBody into its HTML, plaintext and attachments
+func splitMessageParts(contentType, body string) (html, text string, attachments []EmailAttachment, err error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		if mediaType == "text/plain" {
+			return "", body, nil, nil
+		}
+		return body, "", nil, nil
+	}
+
+	reader := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", "", nil, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return "", "", nil, err
+		}
+
+		partType := part.Header.Get("Content-Type")
+		if filename := part.FileName(); filename != "" {
+			if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+				data, err = base64.StdEncoding.DecodeString(strings.NewReplacer("\r", "", "\n", "").Replace(string(data)))
+				if err != nil {
+					return "", "", nil, err
+				}
+			}
+			attachments = append(attachments, EmailAttachment{Filename: filename, ContentType: partType, Data: data})
+			continue
+		}
+
+		innerHTML, innerText, innerAttachments, err := splitMessageParts(partType, string(data))
+		if err != nil {
+			return "", "", nil, err
+		}
+		if innerHTML != "" {
+			html = innerHTML
+		}
+		if innerText != "" {
+			text = innerText
+		}
+		attachments = append(attachments, innerAttachments...)
+	}
+	return html, text, attachments, nil
+}
+
+// CaptureMailer keeps sent messages instead of delivering them. With Dir set each
+// message is also written there as an .eml file that mail clients can open.
+type CaptureMailer struct {
+	Dir string
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (m *CaptureMailer) Configured() bool {
+	return true
+}
+
+func (m *CaptureMailer) Send(msg Message) error {
+	m.mu.Lock()
+	m.messages = append(m.messages, msg)
+	count := len(m.messages)
+	m.mu.Unlock()
+
+	if m.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().Format("20060102-150405"), count)
+	return os.WriteFile(filepath.Join(m.Dir, name), msg.Bytes(), 0o644)
+}
+
+// Messages returns a copy of the captured messages
+func (m *CaptureMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+// Reset forgets all captured messages
+func (m *CaptureMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
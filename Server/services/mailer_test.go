@@ -0,0 +1,348 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// invoicePDF is an attachment long enough to be wrapped over several base64 lines
+var invoicePDF = EmailAttachment{Filename: "invoice-42.pdf", ContentType: "application/pdf", Data: bytes.Repeat([]byte("%PDF-1.4 injera "), 20)}
+
+// testMessage builds a message the way EmailService does, from its HTML, text and attachments
+func testMessage(t *testing.T, html, text string, attachments ...EmailAttachment) Message {
+	t.Helper()
+	var body bytes.Buffer
+	contentType, err := writeEmailBody(&body, html, text, attachments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Message{
+		From:        "eGebeya <noreply@egebeya.et>",
+		To:          "almaz@example.com",
+		Subject:     "Your order ተልኳል",
+		ContentType: contentType,
+		Body:        body.String(),
+	}
+}
+
+func TestSplitMessageParts(t *testing.T) {
+	tests := []struct {
+		name            string
+		text            string
+		attachments     []EmailAttachment
+		wantAttachments []EmailAttachment
+	}{
+		{name: "HTML only"},
+		{name: "HTML and text", text: "Your order has shipped"},
+		{name: "HTML with an attachment", attachments: []EmailAttachment{invoicePDF}, wantAttachments: []EmailAttachment{invoicePDF}},
+		{name: "HTML, text and an attachment", text: "Your invoice is attached", attachments: []EmailAttachment{invoicePDF}, wantAttachments: []EmailAttachment{invoicePDF}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := testMessage(t, "<p>Your order has shipped</p>", tt.text, tt.attachments...)
+			html, text, attachments, err := splitMessageParts(msg.ContentType, msg.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if html != "<p>Your order has shipped</p>" || text != tt.text {
+				t.Errorf("got html %q text %q", html, text)
+			}
+			if !reflect.DeepEqual(attachments, tt.wantAttachments) {
+				t.Errorf("got attachments %+v, want %+v", attachments, tt.wantAttachments)
+			}
+		})
+	}
+
+	if _, text, _, err := splitMessageParts("text/plain; charset=UTF-8", "plain"); err != nil || text != "plain" {
+		t.Errorf("plaintext body: got %q, %v", text, err)
+	}
+	if _, _, _, err := splitMessageParts("multipart/mixed", "no boundary"); err == nil {
+		t.Error("multipart body without a boundary: expected an error")
+	}
+}
+
+// capturedRequest is what an HTTP email API received
+type capturedRequest struct {
+	header http.Header
+	body   []byte
+	form   map[string][]string
+	files  map[string][]byte
+}
+
+// newEmailAPI starts a server standing in for a provider's API, answering with status
+func newEmailAPI(t *testing.T, status int) (*httptest.Server, *capturedRequest) {
+	t.Helper()
+	captured := &capturedRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured.header = r.Header
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Errorf("parse form: %v", err)
+			}
+			captured.form = r.MultipartForm.Value
+			captured.files = map[string][]byte{}
+			for name, headers := range r.MultipartForm.File {
+				f, _ := headers[0].Open()
+				captured.files[name], _ = io.ReadAll(f)
+				f.Close()
+			}
+		} else {
+			captured.body, _ = io.ReadAll(r.Body)
+		}
+		w.WriteHeader(status)
+		if status >= 300 {
+			w.Write([]byte(`{"errors":[{"message":"The provided authorization grant is invalid"}]}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, captured
+}
+
+func TestSendGridMailer(t *testing.T) {
+	server, captured := newEmailAPI(t, 202)
+	mailer := &HTTPMailer{Provider: "sendgrid", APIKey: "SG.key", Endpoint: server.URL}
+	if err := mailer.Send(testMessage(t, "<p>Invoice</p>", "Invoice", invoicePDF)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := captured.header.Get("Authorization"); got != "Bearer SG.key" {
+		t.Errorf("Authorization %q", got)
+	}
+	var payload struct {
+		Personalizations []struct {
+			To []struct{ Email string } `json:"to"`
+		} `json:"personalizations"`
+		From struct {
+			Email string `json:"email"`
+			Name  string `json:"name"`
+		} `json:"from"`
+		Subject string `json:"subject"`
+		Content []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"content"`
+		Attachments []struct {
+			Content     string `json:"content"`
+			Filename    string `json:"filename"`
+			Type        string `json:"type"`
+			Disposition string `json:"disposition"`
+		} `json:"attachments"`
+	}
+	if err := json.Unmarshal(captured.body, &payload); err != nil {
+		t.Fatalf("payload isn't JSON: %v\n%s", err, captured.body)
+	}
+	if len(payload.Personalizations) != 1 || len(payload.Personalizations[0].To) != 1 || payload.Personalizations[0].To[0].Email != "almaz@example.com" {
+		t.Errorf("recipients %+v", payload.Personalizations)
+	}
+	if payload.From.Email != "noreply@egebeya.et" || payload.From.Name != "eGebeya" || payload.Subject != "Your order ተልኳል" {
+		t.Errorf("from %+v subject %q", payload.From, payload.Subject)
+	}
+	// SendGrid wants the plaintext part before the HTML one
+	if len(payload.Content) != 2 || payload.Content[0].Type != "text/plain" || payload.Content[0].Value != "Invoice" ||
+		payload.Content[1].Type != "text/html" || payload.Content[1].Value != "<p>Invoice</p>" {
+		t.Errorf("content %+v", payload.Content)
+	}
+	if len(payload.Attachments) != 1 {
+		t.Fatalf("attachments %+v", payload.Attachments)
+	}
+	attachment := payload.Attachments[0]
+	data, _ := base64.StdEncoding.DecodeString(attachment.Content)
+	if attachment.Filename != invoicePDF.Filename || attachment.Type != invoicePDF.ContentType ||
+		attachment.Disposition != "attachment" || !bytes.Equal(data, invoicePDF.Data) {
+		t.Errorf("attachment %s (%s, %s) with %d bytes", attachment.Filename, attachment.Type, attachment.Disposition, len(data))
+	}
+}
+
+func TestMailgunMailer(t *testing.T) {
+	server, captured := newEmailAPI(t, 200)
+	mailer := &HTTPMailer{Provider: "mailgun", APIKey: "key-mg", Endpoint: server.URL}
+	msg := testMessage(t, "<p>Invoice</p>", "Invoice", invoicePDF)
+	if err := mailer.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := captured.header.Get("Authorization"); got != "Basic "+base64.StdEncoding.EncodeToString([]byte("api:key-mg")) {
+		t.Errorf("Authorization %q", got)
+	}
+	if to := captured.form["to"]; len(to) != 1 || to[0] != "almaz@example.com" {
+		t.Errorf("to %q", to)
+	}
+	// Mailgun gets the MIME message as is
+	eml := string(captured.files["message"])
+	if !strings.Contains(eml, "To: almaz@example.com\r\n") || !strings.Contains(eml, "Content-Type: "+msg.ContentType+"\r\n") ||
+		!strings.HasSuffix(eml, "\r\n\r\n"+msg.Body) {
+		t.Errorf("message.eml isn't the full message:\n%s", eml)
+	}
+}
+
+func TestHTTPMailerErrors(t *testing.T) {
+	server, _ := newEmailAPI(t, 401)
+	err := (&HTTPMailer{Provider: "sendgrid", APIKey: "wrong", Endpoint: server.URL}).Send(testMessage(t, "<p>Hi</p>", ""))
+	if err == nil || !strings.Contains(err.Error(), "sendgrid returned 401") || !strings.Contains(err.Error(), "authorization grant is invalid") {
+		t.Errorf("rejected request: got %v", err)
+	}
+
+	if err := (&HTTPMailer{Provider: "postmark", APIKey: "key"}).Send(testMessage(t, "<p>Hi</p>", "")); err == nil {
+		t.Error("unknown provider: expected an error")
+	}
+	if (&HTTPMailer{Provider: "mailgun"}).Configured() {
+		t.Error("configured without an API key")
+	}
+}
+
+// smtpSession is what the fake SMTP server was told during one connection
+type smtpSession struct {
+	auth string // Decoded AUTH PLAIN credentials
+	from string
+	rcpt []string
+	data string
+}
+
+// newSMTPServer accepts one connection and plays an SMTP server offering AUTH PLAIN but
+// not STARTTLS, sending what the client said on the returned channel
+func newSMTPServer(t *testing.T) (host, port string, sessions <-chan smtpSession) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	done := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var session smtpSession
+		defer func() { done <- session }()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 mail.test ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch {
+			case command == "EHLO":
+				reply("250-mail.test")
+				reply("250 AUTH PLAIN")
+			case strings.HasPrefix(strings.ToUpper(line), "AUTH PLAIN "):
+				decoded, _ := base64.StdEncoding.DecodeString(line[len("AUTH PLAIN "):])
+				session.auth = string(decoded)
+				reply("235 2.7.0 Authentication successful")
+			case command == "MAIL":
+				session.from = line
+				reply("250 OK")
+			case command == "RCPT":
+				session.rcpt = append(session.rcpt, line)
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil || dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				session.data = data.String()
+				reply("250 OK queued")
+			case command == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+
+	host, port, _ = net.SplitHostPort(listener.Addr().String())
+	return host, port, done
+}
+
+func TestSMTPMailer(t *testing.T) {
+	host, port, sessions := newSMTPServer(t)
+	mailer := &SMTPMailer{Host: host, Port: port, Username: "egebeya", Password: "app-password", TLS: "none"}
+	msg := testMessage(t, "<p>Your order has shipped</p>", "Your order has shipped")
+	if err := mailer.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	session := <-sessions
+	if session.auth != "\x00egebeya\x00app-password" {
+		t.Errorf("AUTH PLAIN %q", session.auth)
+	}
+	// The envelope sender is the bare address from the From header
+	if session.from != "MAIL FROM:<noreply@egebeya.et>" && !strings.HasPrefix(session.from, "MAIL FROM:<noreply@egebeya.et> ") {
+		t.Errorf("sender %q", session.from)
+	}
+	if !reflect.DeepEqual(session.rcpt, []string{"RCPT TO:<almaz@example.com>"}) {
+		t.Errorf("recipients %q", session.rcpt)
+	}
+	if !strings.Contains(session.data, "From: eGebeya <noreply@egebeya.et>\r\n") ||
+		!strings.Contains(session.data, "Subject: =?utf-8?q?") || !strings.Contains(session.data, "Your order has shipped") {
+		t.Errorf("message data:\n%s", session.data)
+	}
+}
+
+func TestSMTPMailerRequiresSTARTTLS(t *testing.T) {
+	host, port, _ := newSMTPServer(t)
+	mailer := &SMTPMailer{Host: host, Port: port, Username: "egebeya", Password: "app-password", TLS: "starttls"}
+	err := mailer.Send(testMessage(t, "<p>Hi</p>", ""))
+	if err == nil || !strings.Contains(err.Error(), "does not support STARTTLS") {
+		t.Errorf("got %v, want a refusal to send without STARTTLS", err)
+	}
+}
+
+func TestCaptureMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := &CaptureMailer{Dir: dir}
+	first, second := testMessage(t, "<p>One</p>", ""), testMessage(t, "<p>Two</p>", "")
+	second.To = "hana@example.com"
+	for _, msg := range []Message{first, second} {
+		if err := mailer.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := mailer.Messages()
+	if len(messages) != 2 || messages[0].Body != "<p>One</p>" || messages[1].To != "hana@example.com" {
+		t.Fatalf("captured %+v", messages)
+	}
+	messages[0].Body = "changed"
+	if mailer.Messages()[0].Body != "<p>One</p>" {
+		t.Error("Messages returned the captured slice itself")
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("got %d .eml files, %v", len(files), err)
+	}
+	eml, _ := os.ReadFile(filepath.Join(dir, files[1].Name()))
+	if !strings.HasSuffix(files[1].Name(), "-0002.eml") || !strings.Contains(string(eml), "To: hana@example.com\r\n") {
+		t.Errorf("%s:\n%s", files[1].Name(), eml)
+	}
+
+	mailer.Reset()
+	if len(mailer.Messages()) != 0 {
+		t.Error("messages kept after Reset")
+	}
+}
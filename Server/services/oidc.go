@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider is an OpenID Connect identity provider users can sign in with.
+// Providers are configured from the environment:
+//
+//	google - GOOGLE_CLIENT_ID and GOOGLE_CLIENT_SECRET
+//	oidc   - OIDC_ISSUER_URL, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET and OIDC_PROVIDER_NAME
+//	         for any other issuer, such as a company Keycloak or a local mock issuer
+//
+// Both send users back to OIDC_REDIRECT_URL, a page of the frontend that posts the
+// code and state to /api/auth/oidc/callback.
+type OIDCProvider struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	IssuerURL    string `json:"-"`
+	ClientID     string `json:"-"`
+	ClientSecret string `json:"-"`
+}
+
+// OIDCClaims is what a provider tells us about the user who signed in
+type OIDCClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+var (
+	oidcProvidersMu sync.Mutex
+	oidcProviders   = map[string]*oidc.Provider{} // Discovered providers by issuer URL
+)
+
+// OIDCProviders returns the providers that have their settings configured
+func OIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	if clientID := os.Getenv("GOOGLE_CLIENT_ID"); clientID != "" {
+		providers = append(providers, OIDCProvider{
+			ID:           "google",
+			Name:         "Google",
+			IssuerURL:    "https://accounts.google.com",
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		})
+	}
+	if issuer := os.Getenv("OIDC_ISSUER_URL"); issuer != "" {
+		providers = append(providers, OIDCProvider{
+			ID:           "oidc",
+			Name:         getEnv("OIDC_PROVIDER_NAME", "Single sign-on"),
+			IssuerURL:    strings.TrimSuffix(issuer, "/"),
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		})
+	}
+	return providers
+}
+
+// FindOIDCProvider returns the configured provider with the given ID
+func FindOIDCProvider(id string) (OIDCProvider, bool) {
+	for _, p := range OIDCProviders() {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return OIDCProvider{}, false
+}
+
+// AuthCodeURL is where to send the user to sign in. The nonce comes back inside the ID
+// token, and the PKCE verifier has to be passed to Exchange.
+func (p OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	config, _, err := p.oauth2Config(ctx)
+	if err != nil {
+		return "", err
+	}
+	return config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange trades the authorization code for tokens and verifies the ID token's
+// signature, issuer, audience, expiry and nonce before trusting its claims
+func (p OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCClaims, error) {
+	config, provider, err := p.oauth2Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %v", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	var claims struct {
+		Email         string          `json:"email"`
+		EmailVerified json.RawMessage `json:"email_verified"`
+		Name          string          `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	return &OIDCClaims{
+		Subject: idToken.Subject,
+		Email:   strings.ToLower(strings.TrimSpace(claims.Email)),
+		// Some providers send "true" as a string
+		EmailVerified: strings.Trim(string(claims.EmailVerified), `"`) == "true",
+		Name:          strings.TrimSpace(claims.Name),
+	}, nil
+}
+
+// oauth2Config discovers the provider's endpoints, once per issuer, and returns its client config
+func (p OIDCProvider) oauth2Config(ctx context.Context) (*oauth2.Config, *oidc.Provider, error) {
+	oidcProvidersMu.Lock()
+	provider, ok := oidcProviders[p.IssuerURL]
+	oidcProvidersMu.Unlock()
+	if !ok {
+		discovered, err := oidc.NewProvider(ctx, p.IssuerURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discovery for %s failed: %v", p.IssuerURL, err)
+		}
+		oidcProvidersMu.Lock()
+		oidcProviders[p.IssuerURL] = discovered
+		oidcProvidersMu.Unlock()
+		provider = discovered
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  getEnv("OIDC_REDIRECT_URL", getEnv("FRONTEND_URL", "http://localhost:5174")+"/auth/callback"),
+		Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+	}, provider, nil
+}
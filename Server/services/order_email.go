@@ -0,0 +1,130 @@
+package services
+
+// Transactional emails for the order lifecycle. Templates are in templates/email,
+// each with a plaintext alternative for mail clients that don't render HTML.
+
+// OrderEmailItem is one line of an order as listed in an email
+type OrderEmailItem struct {
+	Name     string
+	Variant  string
+	Quantity int
+	Total    float64
+}
+
+// SendOrderConfirmationEmail sends the buyer their order summary with the PDF invoice attached
+func (es *EmailService) SendOrderConfirmationEmail(email, name, orderNumber string, orderID uint, total float64, invoicePDF []byte) error {
+	data := struct {
+		Name        string
+		OrderNumber string
+		OrderID     uint
+		Total       float64
+		FrontendURL string
+	}{
+		Name:        name,
+		OrderNumber: orderNumber,
+		OrderID:     orderID,
+		Total:       total,
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
+	}
+
+	var attachments []EmailAttachment
+	if len(invoicePDF) > 0 {
+		attachments = append(attachments, EmailAttachment{
+			Filename:    "invoice-" + orderNumber + ".pdf",
+			ContentType: "application/pdf",
+			Data:        invoicePDF,
+		})
+	}
+
+	return es.sendEmail(email, "order-confirmation", data, attachments...)
+}
+
+// SendNewOrderSellerEmail tells a seller which of their items were ordered
+func (es *EmailService) SendNewOrderSellerEmail(email, name, shopName, orderNumber, shippingCity string, items []OrderEmailItem) error {
+	total := 0.0
+	for _, item := range items {
+		total += item.Total
+	}
+
+	data := struct {
+		Name         string
+		ShopName     string
+		OrderNumber  string
+		ShippingCity string
+		Items        []OrderEmailItem
+		Total        float64
+		FrontendURL  string
+	}{
+		Name:         name,
+		ShopName:     shopName,
+		OrderNumber:  orderNumber,
+		ShippingCity: shippingCity,
+		Items:        items,
+		Total:        total,
+		FrontendURL:  getEnv("FRONTEND_URL", "http://localhost:5174"),
+	}
+
+	return es.sendEmail(email, "new-order", data)
+}
+
+// orderStatusEmails are the statuses buyers are emailed about
+var orderStatusEmails = map[string]bool{"confirmed": true, "shipped": true, "delivered": true, "cancelled": true}
+
+// SendOrderStatusEmail tells the buyer their order was confirmed, shipped, delivered or cancelled
+func (es *EmailService) SendOrderStatusEmail(email, name, orderNumber string, orderID uint, status string) error {
+	if !orderStatusEmails[status] {
+		return nil
+	}
+
+	data := struct {
+		Name        string
+		OrderNumber string
+		OrderID     uint
+		Status      string
+		FrontendURL string
+	}{
+		Name:        name,
+		OrderNumber: orderNumber,
+		OrderID:     orderID,
+		Status:      status,
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
+	}
+
+	return es.sendEmail(email, "order-status", data)
+}
+
+// SendPaymentFailedEmail tells the buyer a payment attempt did not go through
+func (es *EmailService) SendPaymentFailedEmail(email, name, reference string, amount float64) error {
+	data := struct {
+		Name        string
+		Reference   string
+		Amount      float64
+		FrontendURL string
+	}{
+		Name:        name,
+		Reference:   reference,
+		Amount:      amount,
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
+	}
+
+	return es.sendEmail(email, "payment-failed", data)
+}
+
+// SendRefundIssuedEmail tells the buyer a refund was issued for their order
+func (es *EmailService) SendRefundIssuedEmail(email, name, orderNumber string, orderID uint, amount float64) error {
+	data := struct {
+		Name        string
+		OrderNumber string
+		OrderID     uint
+		Amount      float64
+		FrontendURL string
+	}{
+		Name:        name,
+		OrderNumber: orderNumber,
+		OrderID:     orderID,
+		Amount:      amount,
+		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5174"),
+	}
+
+	return es.sendEmail(email, "refund-issued", data)
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	outboxPollInterval = 10 * time.Second
+	outboxBatchSize    = 20
+	outboxBaseBackoff  = 30 * time.Second
+	outboxMaxBackoff   = 6 * time.Hour
+	// outboxClaimTimeout is how long a claimed batch is left to its worker, well beyond
+	// the 30 second send timeouts of every message in it
+	outboxClaimTimeout = 30 * time.Minute
+)
+
+// Queue returns a copy of the service that writes emails to the outbox through db
+// (usually the caller's transaction) instead of sending them immediately
+func (es *EmailService) Queue(db *gorm.DB) *EmailService {
+	queued := *es
+	queued.outbox = db
+	return &queued
+}
+
+func enqueueEmail(db *gorm.DB, templateName, to, subject, contentType, body string) error {
+	return db.Create(&models.EmailOutbox{
+		Template:      templateName,
+		To:            to,
+		Subject:       subject,
+		ContentType:   contentType,
+		Body:          body,
+		Status:        models.EmailStatusPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// outboxBackoff is the wait before the next attempt: 30s, 1m, 2m, 4m, ... capped at 6h
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	return backoff
+}
+
+// StartEmailOutboxWorker delivers queued emails in the background until the process exits
+func StartEmailOutboxWorker(db *gorm.DB) {
+	es := NewEmailService()
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if !es.IsEmailConfigured() {
+				// Leave messages pending until SMTP is configured
+				continue
+			}
+			// Keep going while full batches come back, so a backlog drains quickly
+			for es.processOutboxBatch(db) == outboxBatchSize {
+			}
+		}
+	}()
+}
+
+// processOutboxBatch sends due messages and returns how many it picked up. Rows are
+// claimed with SKIP LOCKED so several server instances can share the outbox, and the
+// claim is committed before sending so no locks are held while the mail server talks.
+func (es *EmailService) processOutboxBatch(db *gorm.DB) int {
+	messages, err := claimOutboxBatch(db)
+	if err != nil {
+		log.Printf("❌ Email outbox worker error: %v", err)
+		return 0
+	}
+
+	for _, msg := range messages {
+		updates := map[string]interface{}{}
+		if err := es.deliver(msg.To, msg.Subject, msg.ContentType, msg.Body); err != nil {
+			updates["last_error"] = err.Error()
+			if msg.Attempts >= models.MaxEmailAttempts {
+				updates["status"] = models.EmailStatusDead
+				log.Printf("💀 %s email to %s dead-lettered after %d attempts: %v", msg.Template, msg.To, msg.Attempts, err)
+			} else {
+				updates["next_attempt_at"] = time.Now().Add(outboxBackoff(msg.Attempts))
+				log.Printf("⚠️ %s email to %s failed (attempt %d), will retry: %v", msg.Template, msg.To, msg.Attempts, err)
+			}
+		} else {
+			now := time.Now()
+			updates["status"] = models.EmailStatusSent
+			updates["sent_at"] = &now
+			updates["last_error"] = ""
+			// Verification, reset and sign-in codes shouldn't outlive delivery in the database
+			updates["body"] = ""
+			log.Printf("✅ %s email sent to: %s", msg.Template, msg.To)
+		}
+
+		// Matching the attempt count leaves alone a row another worker claimed after ours expired
+		if err := db.Model(&models.EmailOutbox{}).
+			Where("id = ? AND attempts = ?", msg.ID, msg.Attempts).
+			Updates(updates).Error; err != nil {
+			log.Printf("❌ Failed to record delivery of email %d: %v", msg.ID, err)
+		}
+	}
+	return len(messages)
+}
+
+// claimOutboxBatch takes up to a batch of due messages for this worker by counting the
+// attempt and moving them out of reach for outboxClaimTimeout. If the worker dies
+// while sending, the messages become due again once the claim runs out.
+func claimOutboxBatch(db *gorm.DB) ([]models.EmailOutbox, error) {
+	var messages []models.EmailOutbox
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.EmailStatusPending, time.Now()).
+			Order("next_attempt_at ASC").
+			Limit(outboxBatchSize).
+			Find(&messages).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(messages))
+		for i := range messages {
+			ids[i] = messages[i].ID
+			messages[i].Attempts++
+		}
+		return tx.Model(&models.EmailOutbox{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": time.Now().Add(outboxClaimTimeout),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type failingMailer struct{}
+
+func (failingMailer) Configured() bool       { return true }
+func (failingMailer) Send(msg Message) error { return errors.New("connection refused") }
+
+func TestOutboxClearsSentBodies(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AutoMigrate(&models.EmailOutbox{})
+
+	es := NewEmailService()
+	es.mailer = &CaptureMailer{}
+	if err := es.Queue(db).SendTwoFactorCodeEmail("buyer@example.com", "Abebe", "123456", 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	failing := *es
+	failing.mailer = failingMailer{}
+	if err := failing.Queue(db).SendTwoFactorCodeEmail("seller@example.com", "Almaz", "654321", 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first message goes out; the second fails and stays queued with its body for the retry
+	db.Model(&models.EmailOutbox{}).Where("\"to\" = ?", "seller@example.com").Update("next_attempt_at", time.Now().Add(time.Hour))
+	if picked := es.processOutboxBatch(db); picked != 1 {
+		t.Fatalf("picked %d messages, want 1", picked)
+	}
+	db.Model(&models.EmailOutbox{}).Where("\"to\" = ?", "seller@example.com").Update("next_attempt_at", time.Now())
+	failing.processOutboxBatch(db)
+
+	var sent, pending models.EmailOutbox
+	db.Where("\"to\" = ?", "buyer@example.com").First(&sent)
+	db.Where("\"to\" = ?", "seller@example.com").First(&pending)
+	if sent.Status != models.EmailStatusSent || sent.Body != "" {
+		t.Errorf("sent email: status %s, body kept: %v", sent.Status, sent.Body != "")
+	}
+	if pending.Status != models.EmailStatusPending || pending.Body == "" {
+		t.Errorf("failed email: status %s, body kept: %v", pending.Status, pending.Body != "")
+	}
+	if captured := es.mailer.(*CaptureMailer).Messages(); len(captured) != 1 || captured[0].Body == "" {
+		t.Errorf("captured %d messages", len(captured))
+	}
+
+	// Rows sent before bodies were cleared on delivery
+	db.Model(&pending).Updates(map[string]interface{}{"status": models.EmailStatusSent})
+	models.RedactSentEmails(db)
+	db.First(&pending, pending.ID)
+	if pending.Body != "" {
+		t.Error("RedactSentEmails kept the body of a sent email")
+	}
+}
+
+// reentrantMailer runs the worker again from inside Send, as a second server instance
+// would, then fails with err or keeps the message
+type reentrantMailer struct {
+	CaptureMailer
+	during func()
+	err    error
+}
+
+func (m *reentrantMailer) Send(msg Message) error {
+	m.during()
+	if m.err != nil {
+		return m.err
+	}
+	return m.CaptureMailer.Send(msg)
+}
+
+func TestOutboxClaimsBeforeSending(t *testing.T) {
+	db := openTestDB(t, &models.EmailOutbox{})
+	es := NewEmailService()
+	if err := es.Queue(db).SendTwoFactorCodeEmail("buyer@example.com", "Abebe", "123456", 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	var claimed models.EmailOutbox
+	secondWorker := -1
+	mailer := &reentrantMailer{during: func() {
+		// The claim is committed, so it's visible here and keeps other workers off the message
+		db.First(&claimed)
+		other := *es
+		other.mailer = &CaptureMailer{}
+		secondWorker = other.processOutboxBatch(db)
+	}}
+	es.mailer = mailer
+
+	if picked := es.processOutboxBatch(db); picked != 1 {
+		t.Fatalf("picked %d messages, want 1", picked)
+	}
+	if claimed.Attempts != 1 || !claimed.NextAttemptAt.After(time.Now().Add(outboxClaimTimeout/2)) {
+		t.Errorf("while sending: attempts %d, next attempt %s", claimed.Attempts, claimed.NextAttemptAt)
+	}
+	if secondWorker != 0 {
+		t.Errorf("second worker picked %d messages while the first was sending", secondWorker)
+	}
+
+	var sent models.EmailOutbox
+	db.First(&sent)
+	if sent.Status != models.EmailStatusSent || sent.Attempts != 1 || len(mailer.Messages()) != 1 {
+		t.Errorf("after sending: status %s, attempts %d, %d sent", sent.Status, sent.Attempts, len(mailer.Messages()))
+	}
+}
+
+func TestOutboxIgnoresExpiredClaim(t *testing.T) {
+	db := openTestDB(t, &models.EmailOutbox{})
+	es := NewEmailService()
+	if err := es.Queue(db).SendTwoFactorCodeEmail("buyer@example.com", "Abebe", "123456", 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first worker is so slow its claim runs out and a second worker delivers the
+	// message; the first one's failure, recorded late, must not undo that
+	es.mailer = &reentrantMailer{err: errors.New("i/o timeout"), during: func() {
+		db.Model(&models.EmailOutbox{}).Where("1 = 1").Update("next_attempt_at", time.Now())
+		other := *es
+		other.mailer = &CaptureMailer{}
+		other.processOutboxBatch(db)
+	}}
+	es.processOutboxBatch(db)
+
+	var sent models.EmailOutbox
+	db.First(&sent)
+	if sent.Status != models.EmailStatusSent || sent.Attempts != 2 || sent.LastError != "" {
+		t.Errorf("status %s after %d attempts, last error %q; want sent after 2", sent.Status, sent.Attempts, sent.LastError)
+	}
+}
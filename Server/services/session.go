@@ -0,0 +1,311 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// AccessTokenTTL is how long a JWT is accepted; after that the refresh token is needed
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a session lasts without being used
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	// refreshReuseGrace lets a just-rotated refresh token mint access tokens for a few
+	// seconds, so parallel requests racing to refresh don't look like a replay
+	refreshReuseGrace = 30 * time.Second
+)
+
+var (
+	ErrInvalidSession      = errors.New("session is invalid, expired or revoked")
+	ErrRefreshTokenReplay  = errors.New("refresh token was already used")
+	errMissingSessionClaim = errors.New("token has no session")
+)
+
+// SessionTokens are the credentials handed to the client when a session starts or is refreshed.
+// RefreshToken is empty when only a new access token was issued.
+type SessionTokens struct {
+	Session          models.Session
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// AccessClaims are what RequireAuth needs from a verified access token
+type AccessClaims struct {
+	UserID    uint
+	SessionID uint
+	Role      string
+}
+
+// JWTSecret is the HS256 key access tokens are signed with
+func JWTSecret() []byte {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = "supersecret"
+	}
+	return []byte(secret)
+}
+
+// StartSession records a new signed-in device for the user and issues its tokens
+func StartSession(db *gorm.DB, user models.User, userAgent, ip string) (*SessionTokens, error) {
+	refreshToken, refreshHash, err := NewSecureToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: refreshHash,
+		UserAgent:        userAgent,
+		Device:           DescribeDevice(userAgent),
+		IP:               ip,
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(RefreshTokenTTL),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	// Forget this user's sessions that ended a while ago
+	db.Unscoped().Where("user_id = ? AND (expires_at < ? OR revoked_at < ?)", user.ID, now, now.Add(-RefreshTokenTTL)).
+		Delete(&models.Session{})
+
+	return issueTokens(session, user, refreshToken)
+}
+
+// RefreshSession exchanges a refresh token for a new access token and a new refresh
+// token. Presenting a token that was already rotated out revokes the whole session,
+// since either the client or an attacker holds a stolen copy.
+func RefreshSession(db *gorm.DB, refreshToken, userAgent, ip string) (*SessionTokens, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidSession
+	}
+	hash := HashToken(refreshToken)
+
+	var tokens *SessionTokens
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var session models.Session
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("refresh_token_hash = ?", hash).First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			tokens, err = refreshRotatedToken(tx, hash)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if !session.Active() {
+			return ErrInvalidSession
+		}
+
+		var user models.User
+		if err := tx.Where("id = ?", session.UserID).First(&user).Error; err != nil {
+			return ErrInvalidSession
+		}
+
+		newToken, newHash, err := NewSecureToken()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		session.PreviousTokenHash = hash
+		session.RefreshTokenHash = newHash
+		session.RotatedAt = &now
+		session.LastSeenAt = now
+		session.ExpiresAt = now.Add(RefreshTokenTTL)
+		session.IP = ip
+		if userAgent != "" {
+			session.UserAgent = userAgent
+			session.Device = DescribeDevice(userAgent)
+		}
+		if err := tx.Save(&session).Error; err != nil {
+			return err
+		}
+
+		tokens, err = issueTokens(session, user, newToken)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReplay) {
+		// Revoke outside the transaction, which the error rolled back
+		db.Model(&models.Session{}).Where("previous_token_hash = ? AND revoked_at IS NULL", hash).
+			Update("revoked_at", time.Now())
+	}
+	return tokens, err
+}
+
+// refreshRotatedToken handles a refresh token that is no longer current. Within the
+// grace period it still yields an access token, otherwise it is treated as a replay.
+func refreshRotatedToken(tx *gorm.DB, hash string) (*SessionTokens, error) {
+	var session models.Session
+	if err := tx.Where("previous_token_hash = ?", hash).First(&session).Error; err != nil {
+		return nil, ErrInvalidSession
+	}
+	if !session.Active() {
+		return nil, ErrInvalidSession
+	}
+	if session.RotatedAt == nil || time.Since(*session.RotatedAt) > refreshReuseGrace {
+		return nil, ErrRefreshTokenReplay
+	}
+
+	var user models.User
+	if err := tx.Where("id = ?", session.UserID).First(&user).Error; err != nil {
+		return nil, ErrInvalidSession
+	}
+	return issueTokens(session, user, "")
+}
+
+// RevokeSession ends one of the user's sessions
+func RevokeSession(db *gorm.DB, userID, sessionID uint) (bool, error) {
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeRefreshToken ends the session a refresh token belongs to, if any
+func RevokeRefreshToken(db *gorm.DB, refreshToken string) error {
+	if refreshToken == "" {
+		return nil
+	}
+	return db.Model(&models.Session{}).
+		Where("refresh_token_hash = ? AND revoked_at IS NULL", HashToken(refreshToken)).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAllSessions signs the user out everywhere and returns how many sessions were ended
+func RevokeAllSessions(db *gorm.DB, userID uint) (int64, error) {
+	result := db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// ParseAccessToken verifies an access token's signature and expiry
+func ParseAccessToken(tokenStr string) (*AccessClaims, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return JWTSecret(), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid claims")
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("invalid user id in token")
+	}
+	// Tokens issued before sessions existed can't be revoked, so they are no longer accepted
+	sessionID, ok := claims["sid"].(float64)
+	if !ok {
+		return nil, errMissingSessionClaim
+	}
+	role, _ := claims["role"].(string)
+
+	return &AccessClaims{UserID: uint(userID), SessionID: uint(sessionID), Role: role}, nil
+}
+
+func issueTokens(session models.Session, user models.User, refreshToken string) (*SessionTokens, error) {
+	now := time.Now()
+	accessExpiry := now.Add(AccessTokenTTL)
+	claims := jwt.MapClaims{
+		"user_id": user.ID,
+		"sid":     session.ID,
+		"role":    user.Role,
+		"exp":     accessExpiry.Unix(),
+		"iat":     now.Unix(),
+	}
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(JWTSecret())
+	if err != nil {
+		return nil, err
+	}
+
+	return &SessionTokens{
+		Session:          session,
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiry,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// NewSecureToken returns a random URL-safe token and the hash to store in its place
+func NewSecureToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken is the SHA-256 hex digest tokens are stored and looked up by
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// DescribeDevice turns a User-Agent header into a short label like "Chrome on Android"
+func DescribeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "okhttp") || strings.Contains(ua, "dart"):
+		browser = "Mobile app"
+	case strings.Contains(ua, "curl") || strings.Contains(ua, "postman"):
+		browser = "API client"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		platform = "iOS"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
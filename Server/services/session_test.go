@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"injera-gebeya-platform/Server/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB returns a fresh in-memory database with tables for the given models. The
+// named shared cache keeps every pooled connection on the same database.
+func openTestDB(t *testing.T, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestRefreshSessionRotation(t *testing.T) {
+	db := openTestDB(t, &models.User{}, &models.Session{})
+	user := models.User{Name: "Abebe", Email: "abebe@example.com", Role: models.RoleBuyer, EmailVerified: true}
+	db.Create(&user)
+
+	started, err := StartSession(db, user, "Mozilla/5.0 (Android)", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims, err := ParseAccessToken(started.AccessToken); err != nil || claims.SessionID != started.Session.ID || claims.UserID != user.ID {
+		t.Fatalf("access token claims %+v, %v", claims, err)
+	}
+
+	// tokens holds every refresh token issued so far; steps present them by index
+	tokens := []string{started.RefreshToken}
+	steps := []struct {
+		name        string
+		present     int    // Index into tokens, -1 for a token we never issued
+		before      func() // Runs before the token is presented
+		wantErr     error  // nil when the refresh succeeds
+		wantRotated bool   // A new refresh token is issued
+	}{
+		{name: "current token rotates", present: 0, wantRotated: true},
+		{name: "previous token inside the grace period", present: 0},
+		{name: "rotated token rotates again", present: 1, wantRotated: true},
+		{name: "unknown token", present: -1, wantErr: ErrInvalidSession},
+		{name: "previous token after the grace period is a replay", present: 1, wantErr: ErrRefreshTokenReplay, before: func() {
+			db.Model(&models.Session{}).Where("id = ?", started.Session.ID).
+				Update("rotated_at", time.Now().Add(-2*refreshReuseGrace))
+		}},
+		{name: "replay revoked the current token too", present: 2, wantErr: ErrInvalidSession},
+	}
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		token := "not-a-refresh-token"
+		if step.present >= 0 {
+			token = tokens[step.present]
+		}
+
+		refreshed, err := RefreshSession(db, token, "", "10.0.0.2")
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: got error %v, want %v", step.name, err, step.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if refreshed.Session.ID != started.Session.ID || refreshed.AccessToken == "" {
+			t.Errorf("%s: got session %d, want %d with an access token", step.name, refreshed.Session.ID, started.Session.ID)
+		}
+		if rotated := refreshed.RefreshToken != ""; rotated != step.wantRotated {
+			t.Errorf("%s: rotated %v, want %v", step.name, rotated, step.wantRotated)
+		}
+		if refreshed.RefreshToken != "" {
+			tokens = append(tokens, refreshed.RefreshToken)
+		}
+	}
+
+	var session models.Session
+	db.First(&session, started.Session.ID)
+	if session.Active() {
+		t.Error("session still active after a refresh token replay")
+	}
+}
+
+func TestSessionRevocation(t *testing.T) {
+	db := openTestDB(t, &models.User{}, &models.Session{})
+	owner := models.User{Name: "Abebe", Email: "abebe@example.com", Role: models.RoleBuyer, EmailVerified: true}
+	other := models.User{Name: "Hana", Email: "hana@example.com", Role: models.RoleBuyer, EmailVerified: true}
+	db.Create(&owner)
+	db.Create(&other)
+
+	var sessions []*SessionTokens
+	for _, device := range []string{"phone", "laptop", "tablet"} {
+		started, err := StartSession(db, owner, device, "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, started)
+	}
+	phone, laptop, tablet := sessions[0], sessions[1], sessions[2]
+
+	if revoked, err := RevokeSession(db, other.ID, phone.Session.ID); err != nil || revoked {
+		t.Errorf("another user revoked the session: %v, %v", revoked, err)
+	}
+	if revoked, err := RevokeSession(db, owner.ID, phone.Session.ID); err != nil || !revoked {
+		t.Errorf("owner couldn't revoke the session: %v, %v", revoked, err)
+	}
+	if revoked, _ := RevokeSession(db, owner.ID, phone.Session.ID); revoked {
+		t.Error("revoked the same session twice")
+	}
+	if _, err := RefreshSession(db, phone.RefreshToken, "", "10.0.0.1"); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("refresh after revoking: got %v", err)
+	}
+
+	// Logging out revokes the session by its refresh token
+	if err := RevokeRefreshToken(db, laptop.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RefreshSession(db, laptop.RefreshToken, "", "10.0.0.1"); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("refresh after logout: got %v", err)
+	}
+
+	if ended, err := RevokeAllSessions(db, owner.ID); err != nil || ended != 1 {
+		t.Errorf("signing out everywhere ended %d sessions, want only the tablet's: %v", ended, err)
+	}
+	if _, err := RefreshSession(db, tablet.RefreshToken, "", "10.0.0.1"); !errors.Is(err, ErrInvalidSession) {
+		t.Errorf("refresh after signing out everywhere: got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ethiopianPhonePattern matches Ethiopian mobile numbers: 0912345678, 912345678 or +251912345678
+var ethiopianPhonePattern = regexp.MustCompile(`^(\+251|0)?9[0-9]{8}$`)
+
+// NormalizePhone turns an Ethiopian mobile number as typed, with or without spaces and
+// dashes, into the +2519XXXXXXXX form phone numbers are stored and texted in
+func NormalizePhone(phone string) (string, bool) {
+	phone = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(strings.TrimSpace(phone))
+	if !ethiopianPhonePattern.MatchString(phone) {
+		return "", false
+	}
+	return "+251" + phone[len(phone)-9:], true
+}
+
+// SMSMessage is a text message ready for delivery
+type SMSMessage struct {
+	To   string // +2519XXXXXXXX
+	Body string
+}
+
+// SMSGateway delivers text messages. The gateway is chosen with SMS_GATEWAY:
+//
+//	http   - POSTs {"from", "to", "message"} as JSON to SMS_API_URL with SMS_API_KEY as a bearer token
+//	log    - writes messages to the server log for local development (default)
+//	memory - keeps messages in CapturedSMS so tests can assert on them
+type SMSGateway interface {
+	Send(msg SMSMessage) error
+	// Configured reports whether the gateway has the settings it needs to send
+	Configured() bool
+}
+
+// CapturedSMS holds the messages sent with SMS_GATEWAY=memory
+var CapturedSMS = &CaptureSMSGateway{}
+
+var (
+	smsGatewayMu       sync.RWMutex
+	smsGatewayOverride SMSGateway
+)
+
+// UseSMSGateway makes SendSMS use g instead of the gateway from the environment.
+// Pass nil to go back to the environment's gateway.
+func UseSMSGateway(g SMSGateway) {
+	smsGatewayMu.Lock()
+	defer smsGatewayMu.Unlock()
+	smsGatewayOverride = g
+}
+
+// newSMSGateway returns the override set with UseSMSGateway or the gateway named by SMS_GATEWAY
+func newSMSGateway() SMSGateway {
+	smsGatewayMu.RLock()
+	override := smsGatewayOverride
+	smsGatewayMu.RUnlock()
+	if override != nil {
+		return override
+	}
+
+	switch strings.ToLower(getEnv("SMS_GATEWAY", "log")) {
+	case "http":
+		return &HTTPSMSGateway{
+			Endpoint: getEnv("SMS_API_URL", ""),
+			APIKey:   getEnv("SMS_API_KEY", ""),
+			Sender:   getEnv("SMS_SENDER", "eGebeya"),
+		}
+	case "memory":
+		return CapturedSMS
+	default:
+		return LogSMSGateway{}
+	}
+}
+
+// IsSMSConfigured reports whether text messages will actually reach phones
+func IsSMSConfigured() bool {
+	return newSMSGateway().Configured()
+}
+
+// SendSMS sends a text message through the configured gateway
+func SendSMS(to, body string) error {
+	if err := newSMSGateway().Send(SMSMessage{To: to, Body: body}); err != nil {
+		log.Printf("❌ Failed to send SMS to %s: %v", maskPhone(to), err)
+		return fmt.Errorf("failed to send SMS: %v", err)
+	}
+	return nil
+}
+
+// SendCodeSMS texts a one-time code in the user's language
+func SendCodeSMS(phone, locale, code string, expiresIn time.Duration) error {
+	return SendSMS(phone, translate(NormalizeLocale(locale), "sms.code", code, fmt.Sprint(int(expiresIn.Minutes()))))
+}
+
+// SendAccountLockedSMS tells a user without an email address that sign-in was locked
+// after repeated failed attempts
+func SendAccountLockedSMS(phone, locale string, lockedUntil time.Time) error {
+	return SendSMS(phone, translate(NormalizeLocale(locale), "sms.account_locked", lockedUntil.UTC().Format("2006-01-02 15:04 UTC")))
+}
+
+// maskPhone hides all but the last three digits for logging
+func maskPhone(phone string) string {
+	if len(phone) <= 3 {
+		return "***"
+	}
+	return strings.Repeat("*", len(phone)-3) + phone[len(phone)-3:]
+}
+
+// HTTPSMSGateway sends through a provider's HTTP API that takes a JSON message
+type HTTPSMSGateway struct {
+	Endpoint string
+	APIKey   string
+	Sender   string
+	Client   *http.Client
+}
+
+func (g *HTTPSMSGateway) Configured() bool {
+	return g.Endpoint != "" && g.APIKey != ""
+}
+
+func (g *HTTPSMSGateway) Send(msg SMSMessage) error {
+	if !g.Configured() {
+		return fmt.Errorf("SMS gateway not configured")
+	}
+	body, err := json.Marshal(map[string]string{
+		"from":    g.Sender,
+		"to":      msg.To,
+		"message": msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", g.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := g.Client
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("SMS gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+// LogSMSGateway writes messages to the log instead of sending them, so codes can be
+// read from the server output during development
+type LogSMSGateway struct{}
+
+func (LogSMSGateway) Configured() bool {
+	return false
+}
+
+func (LogSMSGateway) Send(msg SMSMessage) error {
+	log.Printf("📱 SMS gateway not configured. Message to %s: %s", msg.To, msg.Body)
+	return nil
+}
+
+// CaptureSMSGateway keeps sent messages instead of delivering them
+type CaptureSMSGateway struct {
+	mu       sync.Mutex
+	messages []SMSMessage
+}
+
+func (g *CaptureSMSGateway) Configured() bool {
+	return true
+}
+
+func (g *CaptureSMSGateway) Send(msg SMSMessage) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.messages = append(g.messages, msg)
+	return nil
+}
+
+// Messages returns a copy of the captured messages
+func (g *CaptureSMSGateway) Messages() []SMSMessage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]SMSMessage(nil), g.messages...)
+}
+
+// Reset forgets all captured messages
+func (g *CaptureSMSGateway) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.messages = nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+// totpOptions are the authenticator app defaults: 6 digits every 30 seconds with SHA-1
+var totpOptions = totp.ValidateOpts{
+	Period:    30,
+	Skew:      1,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+var errSealedSecret = errors.New("sealed secret is invalid")
+
+// TOTPSetup is what a user needs to add their account to an authenticator app
+type TOTPSetup struct {
+	Secret string // Base32, for typing in by hand
+	URL    string // otpauth:// URL encoded in the QR code
+	QRCode string // PNG data URL
+}
+
+// NewTOTPSetup generates a new TOTP secret for the account and its QR code
+func NewTOTPSetup(accountName string) (*TOTPSetup, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      getEnv("TOTP_ISSUER", "eGebeya"),
+		AccountName: accountName,
+		Period:      uint(totpOptions.Period),
+		Digits:      totpOptions.Digits,
+		Algorithm:   totpOptions.Algorithm,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return &TOTPSetup{
+		Secret: key.Secret(),
+		URL:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// ValidateTOTP checks a code against the secret, allowing one time step of clock drift.
+// Codes from the step of the last accepted code or earlier are refused so an observed
+// code can't be replayed. It returns the step the code belongs to.
+func ValidateTOTP(secret, code string, lastCounter int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpOptions.Digits.Length() {
+		return 0, false
+	}
+
+	now := time.Now()
+	period := int64(totpOptions.Period)
+	for skew := -int64(totpOptions.Skew); skew <= int64(totpOptions.Skew); skew++ {
+		counter := now.Unix()/period + skew
+		if counter <= lastCounter {
+			continue
+		}
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(counter*period, 0), totpOptions)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// NewRecoveryCodes returns count recovery codes like "k3vq7-m2x9p" and their hashes
+func NewRecoveryCodes(count int) (codes, hashes []string, err error) {
+	for i := 0; i < count; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, HashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode hashes a recovery code the way it was typed, ignoring case, dashes and spaces
+func HashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+	return HashToken(normalized)
+}
+
+// SealSecret encrypts a TOTP secret for storage with AES-GCM. The key comes from
+// TWO_FACTOR_KEY, falling back to JWT_SECRET.
+func SealSecret(secret string) (string, error) {
+	gcm, err := twoFactorCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenSecret decrypts a secret sealed by SealSecret
+func OpenSecret(sealed string) (string, error) {
+	gcm, err := twoFactorCipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errSealedSecret
+	}
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errSealedSecret
+	}
+	return string(secret), nil
+}
+
+// twoFactorCipher is the AES-256-GCM cipher TOTP secrets are sealed with
+func twoFactorCipher() (cipher.AEAD, error) {
+	keyMaterial := os.Getenv("TWO_FACTOR_KEY")
+	if keyMaterial == "" {
+		keyMaterial = string(JWTSecret())
+	}
+	key := sha256.Sum256([]byte("totp-secret:" + keyMaterial))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
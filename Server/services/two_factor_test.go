@@ -0,0 +1,111 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	setup, err := NewTOTPSetup("seller@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	period := int64(totpOptions.Period)
+	current := time.Now().Unix() / period
+	codeAt := func(counter int64) string {
+		code, err := totp.GenerateCodeCustom(setup.Secret, time.Unix(counter*period, 0), totpOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name        string
+		code        string
+		lastCounter int64
+		wantCounter int64
+		wantOK      bool
+	}{
+		{"current code", codeAt(current), 0, current, true},
+		{"code with spaces around it", " " + codeAt(current) + " ", 0, current, true},
+		{"previous step for clock drift", codeAt(current - 1), 0, current - 1, true},
+		{"next step for clock drift", codeAt(current + 1), 0, current + 1, true},
+		{"two steps old", codeAt(current - 2), 0, 0, false},
+		{"already accepted step", codeAt(current), current, 0, false},
+		{"step before the accepted one", codeAt(current - 1), current, 0, false},
+		{"wrong length", codeAt(current)[:5], 0, 0, false},
+	}
+	for _, tt := range tests {
+		counter, ok := ValidateTOTP(setup.Secret, tt.code, tt.lastCounter)
+		if ok != tt.wantOK || counter != tt.wantCounter {
+			t.Errorf("%s: got (%d, %v), want (%d, %v)", tt.name, counter, ok, tt.wantCounter, tt.wantOK)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("got %d codes and %d hashes, want 10 of each", len(codes), len(hashes))
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q isn't formatted like xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q issued twice", code)
+		}
+		seen[code] = true
+
+		typed := []string{code, "  " + code + " ", code[:5] + code[6:], code[:5] + " " + code[6:], strings.ToUpper(code)}
+		for _, variant := range typed {
+			if HashRecoveryCode(variant) != hashes[i] {
+				t.Errorf("%q typed as %q doesn't match its hash", code, variant)
+			}
+		}
+	}
+	if HashRecoveryCode(codes[0]) == HashRecoveryCode(codes[1]) {
+		t.Error("different codes share a hash")
+	}
+}
+
+func TestSealSecret(t *testing.T) {
+	t.Setenv("TWO_FACTOR_KEY", "first-key")
+	sealed, err := SealSecret("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := SealSecret("JBSWY3DPEHPK3PXP")
+	if sealed == again {
+		t.Error("sealing the same secret twice gave the same ciphertext")
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		sealed  string
+		wantErr bool
+	}{
+		{"same key", "first-key", sealed, false},
+		{"rotated key", "second-key", sealed, true},
+		{"tampered ciphertext", "first-key", sealed[:len(sealed)-4] + "AAAA", true},
+		{"not base64", "first-key", "not sealed!", true},
+		{"too short", "first-key", "AAAA", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TWO_FACTOR_KEY", tt.key)
+		secret, err := OpenSecret(tt.sealed)
+		if (err != nil) != tt.wantErr || (err == nil && secret != "JBSWY3DPEHPK3PXP") {
+			t.Errorf("%s: got (%q, %v)", tt.name, secret, err)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Minimal XLSX support for product import/export. Only the first worksheet is
+// read, and written workbooks contain a single sheet of plain values.
+
+// maxXLSXPartSize caps how much a single file inside the workbook may decompress to,
+// so a small zip bomb can't exhaust memory
+const maxXLSXPartSize = 64 << 20
+
+// maxXLSXColumns is the number of columns Excel allows, A to XFD
+const maxXLSXColumns = 16384
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt xlsxRichText) String() string {
+	if len(rt.Runs) == 0 {
+		return rt.Text
+	}
+	var sb strings.Builder
+	for _, run := range rt.Runs {
+		sb.WriteString(run.Text)
+	}
+	return sb.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Ref   int `xml:"r,attr"` // 1-based row number; blank rows are left out of the file
+		Cells []struct {
+			Ref    string       `xml:"r,attr"`
+			Type   string       `xml:"t,attr"`
+			Value  string       `xml:"v"`
+			Inline xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadXLSX returns the cell values of the first worksheet as rows of strings. Row i of
+// the result is sheet row i+1, with blank rows filled in, and sheets longer than
+// maxRows are rejected.
+func ReadXLSX(r io.ReaderAt, size int64, maxRows int) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xlsx file: %v", err)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var workbook xlsxWorkbook
+	if err := decodeZipXML(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("invalid xlsx file: workbook has no sheets")
+	}
+
+	var rels xlsxRelationships
+	if err := decodeZipXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].RID {
+			if strings.HasPrefix(rel.Target, "/") {
+				sheetPath = strings.TrimPrefix(rel.Target, "/")
+			} else {
+				sheetPath = path.Join("xl", rel.Target)
+			}
+		}
+	}
+	if sheetPath == "" {
+		return nil, fmt.Errorf("invalid xlsx file: first sheet not found")
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	var sheet xlsxSheet
+	if err := decodeZipXML(files, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		rowNum := len(rows) + 1
+		if row.Ref > 0 {
+			rowNum = row.Ref
+		}
+		if rowNum < len(rows)+1 {
+			return nil, fmt.Errorf("invalid xlsx file: row %d is out of order", rowNum)
+		}
+		if rowNum > maxRows {
+			return nil, fmt.Errorf("too many rows (max %d)", maxRows)
+		}
+		for len(rows) < rowNum-1 {
+			rows = append(rows, nil)
+		}
+
+		var values []string
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				var ok bool
+				if col, ok = columnIndex(cell.Ref); !ok {
+					return nil, fmt.Errorf("invalid xlsx file: bad cell reference %q", cell.Ref)
+				}
+			}
+			if col >= maxXLSXColumns {
+				return nil, fmt.Errorf("invalid xlsx file: more than %d columns in row %d", maxXLSXColumns, rowNum)
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err != nil || idx < 0 || idx >= len(shared.Items) {
+					return nil, fmt.Errorf("invalid xlsx file: bad shared string in cell %s", cell.Ref)
+				}
+				values[col] = shared.Items[idx].String()
+			case "inlineStr":
+				values[col] = cell.Inline.String()
+			default:
+				values[col] = cell.Value
+			}
+		}
+		rows = append(rows, values)
+	}
+	return rows, nil
+}
+
+// WriteXLSX writes rows as a single-sheet workbook. Data cells in numericColumns
+// are stored as numbers, everything else (and the header row) as inline strings.
+func WriteXLSX(w io.Writer, sheetName string, rows [][]string, numericColumns ...int) error {
+	zw := zip.NewWriter(w)
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="` + xmlEscape(sheetName) + `" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+		{"xl/worksheets/sheet1.xml", buildSheetXML(rows, numericColumns)},
+	}
+
+	for _, part := range parts {
+		fw, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, part.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func buildSheetXML(rows [][]string, numericColumns []int) string {
+	numeric := make(map[int]bool)
+	for _, col := range numericColumns {
+		numeric[col] = true
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(&sb, `<row r="%d">`, r+1)
+		for c, value := range row {
+			ref := columnName(c) + strconv.Itoa(r+1)
+			if _, err := strconv.ParseFloat(value, 64); err == nil && r > 0 && numeric[c] {
+				fmt.Fprintf(&sb, `<c r="%s"><v>%s</v></c>`, ref, value)
+			} else {
+				fmt.Fprintf(&sb, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, xmlEscape(value))
+			}
+		}
+		sb.WriteString(`</row>`)
+	}
+	sb.WriteString(`</sheetData></worksheet>`)
+	return sb.String()
+}
+
+func decodeZipXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("invalid xlsx file: missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("invalid xlsx file: %v", err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(&partReader{r: rc, remaining: maxXLSXPartSize}).Decode(v); err != nil {
+		return fmt.Errorf("invalid xlsx file: %s: %v", name, err)
+	}
+	return nil
+}
+
+// partReader fails once more than remaining bytes have been read. Unlike
+// io.LimitReader it reports the oversized part instead of quietly truncating it.
+type partReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (p *partReader) Read(b []byte) (int, error) {
+	if p.remaining <= 0 {
+		return 0, fmt.Errorf("part is larger than %d MB uncompressed", maxXLSXPartSize>>20)
+	}
+	if int64(len(b)) > p.remaining {
+		b = b[:p.remaining+1]
+	}
+	n, err := p.r.Read(b)
+	p.remaining -= int64(n)
+	if p.remaining < 0 {
+		return 0, fmt.Errorf("part is larger than %d MB uncompressed", maxXLSXPartSize>>20)
+	}
+	return n, err
+}
+
+// columnIndex converts a cell reference such as "C12" to a zero-based column index.
+// It reports false for references without column letters or past the last column, XFD.
+func columnIndex(ref string) (int, bool) {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+		if col > maxXLSXColumns {
+			return 0, false
+		}
+	}
+	return col - 1, col > 0
+}
+
+// columnName converts a zero-based column index to letters ("A", "B", ..., "AA")
+func columnName(col int) string {
+	name := ""
+	for col >= 0 {
+		name = string(rune('A'+col%26)) + name
+		col = col/26 - 1
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildXLSX zips a minimal workbook around the given sheet XML
+func buildXLSX(t *testing.T, sheetXML string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Products" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/worksheets/sheet1.xml": sheetXML,
+	}
+	for name, content := range parts {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadXLSXRoundTrip(t *testing.T) {
+	rows := [][]string{{"sku", "name", "price"}, {"A1", "Injera", "25"}, {"B2", "Berbere & Mitmita", "120.5"}}
+	var buf bytes.Buffer
+	if err := WriteXLSX(&buf, "Products", rows, 2); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("got %q, want %q", got, rows)
+	}
+}
+
+func TestReadXLSXKeepsSheetRowNumbers(t *testing.T) {
+	data := buildXLSX(t, `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>sku</t></is></c></row>
+<row r="4"><c r="B4"><v>7</v></c></row>
+</sheetData></worksheet>`)
+	got, err := ReadXLSX(bytes.NewReader(data), int64(len(data)), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"sku"}, nil, nil, {"", "7"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestReadXLSXLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		sheetXML string
+		wantErr  string
+	}{
+		{
+			name:     "row past the limit",
+			sheetXML: `<worksheet><sheetData><row r="1000000"><c r="A1000000"><v>1</v></c></row></sheetData></worksheet>`,
+			wantErr:  "too many rows",
+		},
+		{
+			name:     "rows out of order",
+			sheetXML: `<worksheet><sheetData><row r="3"></row><row r="2"></row></sheetData></worksheet>`,
+			wantErr:  "out of order",
+		},
+		{
+			name:     "cell reference without a column",
+			sheetXML: `<worksheet><sheetData><row r="1"><c r="1"><v>1</v></c></row></sheetData></worksheet>`,
+			wantErr:  "invalid xlsx",
+		},
+		{
+			name:     "cell reference past the last column",
+			sheetXML: `<worksheet><sheetData><row r="1"><c r="ZZZZZZZ1"><v>1</v></c></row></sheetData></worksheet>`,
+			wantErr:  "invalid xlsx",
+		},
+		{
+			name:     "cell reference one past XFD",
+			sheetXML: `<worksheet><sheetData><row r="1"><c r="XFE1"><v>1</v></c></row></sheetData></worksheet>`,
+			wantErr:  "invalid xlsx",
+		},
+		{
+			name:     "part decompresses past the cap",
+			sheetXML: `<worksheet><sheetData><row r="1"><c><v>` + strings.Repeat("9", maxXLSXPartSize) + `</v></c></row></sheetData></worksheet>`,
+			wantErr:  "larger than",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := buildXLSX(t, tt.sheetXML)
+			_, err := ReadXLSX(bytes.NewReader(data), int64(len(data)), 10)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}